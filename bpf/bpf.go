@@ -0,0 +1,311 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+// Package bpf analyses eBPF programs disassembled with CS_ARCH_BPF in
+// CS_MODE_BPF_EXTENDED: jump targets as instruction indices with labels,
+// subprograms split at BPF-to-BPF calls, ld_imm64 pseudo sources and helper
+// names.
+package bpf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/bpfsnoop/gapstone"
+)
+
+var (
+	ErrArch      = errors.New("engine is not CS_ARCH_BPF in CS_MODE_BPF_EXTENDED")
+	ErrTruncated = errors.New("code is not a whole number of instructions")
+)
+
+// Size of an instruction slot. ld_imm64 takes two.
+const InsnSize = 8
+
+// Instruction classes and jump codes
+const (
+	classMask  = 0x07
+	classJmp   = 0x05
+	classJmp32 = 0x06
+	codeMask   = 0xf0
+	jmpJa      = 0x00
+	jmpCall    = 0x80
+	jmpExit    = 0x90
+	opLdImm64  = 0x18 // BPF_LD | BPF_IMM | BPF_DW
+)
+
+// Source register values of ld_imm64
+const (
+	PseudoMapFD       = 1 // Imm is a map fd
+	PseudoMapValue    = 2 // Low half of Imm is a map fd, high half an offset into its value
+	PseudoBTFID       = 3 // Imm is a kernel BTF type id
+	PseudoFunc        = 4 // Imm is the index of a callback, relative to the next instruction
+	PseudoMapIdx      = 5 // As PseudoMapFD, with an index into the fd array
+	PseudoMapIdxValue = 6 // As PseudoMapValue, with an index into the fd array
+)
+
+// Source register values of call
+const (
+	PseudoCall      = 1 // BPF-to-BPF call, Imm is relative to the next instruction
+	PseudoKfuncCall = 2 // Imm is the BTF id of a kernel function
+)
+
+// An instruction with its encoded fields. Capstone's detail has no source
+// register for call and ld_imm64, and leaves jump offsets unsigned, so the
+// fields are decoded from the instruction bytes; with CS_OPT_DETAIL on the
+// embedded Instruction still has the decomposer's BPF operands.
+type Instruction struct {
+	gapstone.Instruction
+	Index   int // In 8 byte slots from the start of the code
+	Opcode  byte
+	Dst     uint8
+	Src     uint8
+	Off     int16
+	Imm     int64  // Sign extended, the whole 64 bit constant for ld_imm64
+	Target  int    // Index a jump, BPF-to-BPF call or PseudoFunc refers to, -1 for none
+	Label   string // Of Target, empty if Target isn't the start of an instruction
+	Helper  string // Name of the helper a helper call calls
+	Unknown bool   // Not decoded by Capstone
+}
+
+func (insn Instruction) class() byte { return insn.Opcode & classMask }
+
+func (insn Instruction) isJmpClass() bool {
+	return insn.class() == classJmp || insn.class() == classJmp32
+}
+
+// The 16 byte load of a 64 bit constant, possibly a pseudo source.
+func (insn Instruction) IsLdImm64() bool { return insn.Opcode == opLdImm64 }
+
+// A conditional or unconditional jump, not a call or exit.
+func (insn Instruction) IsJump() bool {
+	code := insn.Opcode & codeMask
+	return insn.isJmpClass() && code != jmpCall && code != jmpExit
+}
+
+func (insn Instruction) IsCall() bool {
+	return insn.class() == classJmp && insn.Opcode&codeMask == jmpCall
+}
+
+func (insn Instruction) IsHelperCall() bool { return insn.IsCall() && insn.Src == 0 }
+
+func (insn Instruction) IsPseudoCall() bool { return insn.IsCall() && insn.Src == PseudoCall }
+
+func (insn Instruction) IsKfuncCall() bool { return insn.IsCall() && insn.Src == PseudoKfuncCall }
+
+func (insn Instruction) IsExit() bool {
+	return insn.class() == classJmp && insn.Opcode&codeMask == jmpExit
+}
+
+// A function of the program: the main program, or a BPF-to-BPF call or
+// callback target. It covers the instructions [Start, End).
+type Subprog struct {
+	Name         string
+	Start        int
+	End          int
+	Instructions []Instruction
+}
+
+// An analysed eBPF program.
+type Program struct {
+	Instructions []Instruction
+	Subprogs     []Subprog      // Sorted by Start
+	Labels       map[int]string // By instruction index, for jump and call targets
+}
+
+// Disassemble and analyse code, a sequence of eBPF instructions starting at
+// index 0. Subprograms are named from syms, which is given byte offsets into
+// code and may be nil. Otherwise the first is "prog" and the others are
+// "subprog_N", N being their index.
+func Analyze(engine *gapstone.Engine, code []byte, syms gapstone.Symbolizer) (*Program, error) {
+	if engine.Arch() != gapstone.CS_ARCH_BPF || engine.Mode()&gapstone.CS_MODE_BPF_EXTENDED == 0 {
+		return nil, ErrArch
+	}
+	if len(code)%InsnSize != 0 {
+		return nil, ErrTruncated
+	}
+
+	var order binary.ByteOrder = binary.LittleEndian
+	if engine.Mode()&gapstone.CS_MODE_BIG_ENDIAN != 0 {
+		order = binary.BigEndian
+	}
+	p := &Program{
+		Instructions: disasm(engine, code, order),
+		Labels:       make(map[int]string),
+	}
+	p.split(syms)
+	p.label()
+	return p, nil
+}
+
+// Disassemble code, taking the slots Capstone can't decode, such as newer
+// opcodes, as Unknown instructions.
+func disasm(engine *gapstone.Engine, code []byte, order binary.ByteOrder) []Instruction {
+	var out []Instruction
+	for pos := 0; pos < len(code); {
+		// Nothing decoded is reported as an error, which is handled below
+		insns, _ := engine.Disasm(code[pos:], uint64(pos), 0)
+		for _, insn := range insns {
+			out = append(out, decode(insn, order))
+			pos = int(insn.Address + insn.Size)
+		}
+		if pos < len(code) {
+			size := InsnSize
+			if code[pos] == opLdImm64 && pos+2*InsnSize <= len(code) {
+				size *= 2
+			}
+			var insn gapstone.Instruction
+			insn.Id = gapstone.BPF_INS_INVALID
+			insn.Address = uint(pos)
+			insn.Size = uint(size)
+			insn.Bytes = code[pos : pos+size]
+			insn.Mnemonic = fmt.Sprintf("unknown_0x%02x", code[pos])
+			i := decode(insn, order)
+			i.Unknown = true
+			out = append(out, i)
+			pos += size
+		}
+	}
+	return out
+}
+
+// Decode the encoded fields from the instruction bytes.
+func decode(insn gapstone.Instruction, order binary.ByteOrder) Instruction {
+	b := insn.Bytes
+	i := Instruction{
+		Instruction: insn,
+		Index:       int(insn.Address) / InsnSize,
+		Opcode:      b[0],
+		Off:         int16(order.Uint16(b[2:])),
+		Imm:         int64(int32(order.Uint32(b[4:]))),
+		Target:      -1,
+	}
+	if order == binary.LittleEndian {
+		i.Dst, i.Src = b[1]&0xf, b[1]>>4
+	} else {
+		i.Dst, i.Src = b[1]>>4, b[1]&0xf
+	}
+	if i.IsLdImm64() && len(b) >= 2*InsnSize {
+		i.Imm = int64(uint64(uint32(i.Imm)) | uint64(order.Uint32(b[12:]))<<32)
+	}
+
+	switch {
+	case i.IsJump() && i.class() == classJmp32 && i.Opcode&codeMask == jmpJa:
+		// gotol, the offset is in Imm
+		i.Target = i.Index + int(i.Imm) + 1
+	case i.IsJump():
+		i.Target = i.Index + int(i.Off) + 1
+	case i.IsPseudoCall(), i.IsLdImm64() && i.Src == PseudoFunc:
+		i.Target = i.Index + int(int32(i.Imm)) + 1
+	case i.IsHelperCall():
+		i.Helper = HelperName(int32(i.Imm))
+	}
+	return i
+}
+
+// Position in p.Instructions of the instruction at index, or -1.
+func (p *Program) find(index int) int {
+	i := sort.Search(len(p.Instructions), func(i int) bool {
+		return p.Instructions[i].Index >= index
+	})
+	if i < len(p.Instructions) && p.Instructions[i].Index == index {
+		return i
+	}
+	return -1
+}
+
+// The instruction at index, in slots.
+func (p *Program) Instruction(index int) (Instruction, bool) {
+	if i := p.find(index); i >= 0 {
+		return p.Instructions[i], true
+	}
+	return Instruction{}, false
+}
+
+// Split the program at BPF-to-BPF call and callback targets.
+func (p *Program) split(syms gapstone.Symbolizer) {
+	starts := map[int]bool{0: true}
+	for _, insn := range p.Instructions {
+		if insn.IsPseudoCall() || insn.IsLdImm64() && insn.Src == PseudoFunc {
+			if p.find(insn.Target) >= 0 {
+				starts[insn.Target] = true
+			}
+		}
+	}
+	var sorted []int
+	for s := range starts {
+		sorted = append(sorted, s)
+	}
+	sort.Ints(sorted)
+
+	for i, start := range sorted {
+		sp := Subprog{Start: start, End: p.slots()}
+		if i+1 < len(sorted) {
+			sp.End = sorted[i+1]
+		}
+		if syms != nil {
+			if name, off, ok := syms.Lookup(uint64(start * InsnSize)); ok && off == 0 {
+				sp.Name = name
+			}
+		}
+		if sp.Name == "" && start == 0 {
+			sp.Name = "prog"
+		} else if sp.Name == "" {
+			sp.Name = fmt.Sprintf("subprog_%d", start)
+		}
+		from, to := p.find(sp.Start), len(p.Instructions)
+		if i+1 < len(sorted) {
+			to = p.find(sp.End)
+		}
+		if from >= 0 {
+			sp.Instructions = p.Instructions[from:to]
+		}
+		p.Subprogs = append(p.Subprogs, sp)
+		p.Labels[start] = sp.Name
+	}
+}
+
+// Give jump targets labels "L0", "L1"... in index order, and set Label on
+// every instruction with a Target.
+func (p *Program) label() {
+	var targets []int
+	for _, insn := range p.Instructions {
+		if insn.IsJump() && p.find(insn.Target) >= 0 {
+			if _, ok := p.Labels[insn.Target]; !ok {
+				p.Labels[insn.Target] = ""
+				targets = append(targets, insn.Target)
+			}
+		}
+	}
+	sort.Ints(targets)
+	for n, t := range targets {
+		p.Labels[t] = fmt.Sprintf("L%d", n)
+	}
+
+	for i := range p.Instructions {
+		insn := &p.Instructions[i]
+		if insn.Target >= 0 {
+			insn.Label = p.Labels[insn.Target]
+		}
+	}
+}
+
+// The subprogram containing the instruction at index.
+func (p *Program) Subprog(index int) (Subprog, bool) {
+	i := sort.Search(len(p.Subprogs), func(i int) bool {
+		return p.Subprogs[i].Start > index
+	})
+	if i == 0 || index >= p.Subprogs[i-1].End {
+		return Subprog{}, false
+	}
+	return p.Subprogs[i-1], true
+}
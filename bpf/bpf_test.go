@@ -0,0 +1,154 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package bpf
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bpfsnoop/gapstone"
+)
+
+// A program looking up map fd 5, calling a subprogram when the lookup
+// succeeds, and looping back with a negative jump.
+var testCode = []byte{
+	0xb7, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // 0: r1 = 0
+	0x18, 0x12, 0x00, 0x00, 0x05, 0x00, 0x00, 0x00, // 1: r2 = map_fd(5)
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x85, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, // 3: call bpf_map_lookup_elem
+	0x15, 0x00, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, // 4: if r0 == 0 goto 7
+	0x85, 0x10, 0x00, 0x00, 0x03, 0x00, 0x00, 0x00, // 5: call 9
+	0x05, 0x00, 0xfd, 0xff, 0x00, 0x00, 0x00, 0x00, // 6: goto 4
+	0xb7, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // 7: r0 = 0
+	0x95, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // 8: exit
+	0xb7, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, // 9: r0 = 1
+	0x95, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // 10: exit
+}
+
+func testEngine(t *testing.T) gapstone.Engine {
+	engine, err := gapstone.New(gapstone.CS_ARCH_BPF, gapstone.CS_MODE_BPF_EXTENDED)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return engine
+}
+
+func TestAnalyze(t *testing.T) {
+	engine := testEngine(t)
+	defer engine.Close()
+
+	p, err := Analyze(&engine, testCode, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Instructions) != 10 {
+		t.Fatalf("%d instructions, want 10", len(p.Instructions))
+	}
+
+	ld := p.Instructions[1]
+	if !ld.IsLdImm64() || ld.Src != PseudoMapFD || ld.Dst != 2 || ld.Imm != 5 || ld.Size != 16 {
+		t.Errorf("ld_imm64 = %+v", ld)
+	}
+	if got := p.Instructions[2].Index; got != 3 {
+		t.Errorf("instruction after ld_imm64 at index %d, want 3", got)
+	}
+
+	if call := p.Instructions[2]; !call.IsHelperCall() || call.Helper != "bpf_map_lookup_elem" {
+		t.Errorf("helper call = %q", call.Helper)
+	}
+
+	wantTargets := map[int]struct {
+		target int
+		label  string
+	}{
+		4: {7, "L1"},
+		5: {9, "subprog_9"},
+		6: {4, "L0"},
+	}
+	for _, insn := range p.Instructions {
+		want, ok := wantTargets[insn.Index]
+		if !ok {
+			want.target = -1
+		}
+		if insn.Target != want.target || insn.Label != want.label {
+			t.Errorf("%d: target %d %q, want %d %q", insn.Index, insn.Target, insn.Label, want.target, want.label)
+		}
+	}
+
+	type subprog struct {
+		name       string
+		start, end int
+		n          int
+	}
+	var got []subprog
+	for _, sp := range p.Subprogs {
+		got = append(got, subprog{sp.Name, sp.Start, sp.End, len(sp.Instructions)})
+	}
+	want := []subprog{{"prog", 0, 9, 8}, {"subprog_9", 9, 11, 2}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("subprogs = %+v, want %+v", got, want)
+	}
+	if sp, ok := p.Subprog(10); !ok || sp.Name != "subprog_9" {
+		t.Errorf("Subprog(10) = %q, %v", sp.Name, ok)
+	}
+}
+
+func TestAnalyzeSymbols(t *testing.T) {
+	engine := testEngine(t)
+	defer engine.Close()
+
+	syms := gapstone.NewSymbolTable([]gapstone.Symbol{
+		{Name: "handler", Addr: 0, Size: 9 * InsnSize},
+		{Name: "on_found", Addr: 9 * InsnSize, Size: 2 * InsnSize},
+	})
+	p, err := Analyze(&engine, testCode, syms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Subprogs[0].Name != "handler" || p.Subprogs[1].Name != "on_found" {
+		t.Errorf("subprogs %q, %q", p.Subprogs[0].Name, p.Subprogs[1].Name)
+	}
+	if l := p.Instructions[4].Label; l != "on_found" {
+		t.Errorf("call label %q", l)
+	}
+}
+
+func TestAnalyzeErrors(t *testing.T) {
+	engine := testEngine(t)
+	defer engine.Close()
+	if _, err := Analyze(&engine, testCode[:12], nil); err != ErrTruncated {
+		t.Errorf("truncated code: %v", err)
+	}
+
+	classic, err := gapstone.New(gapstone.CS_ARCH_BPF, gapstone.CS_MODE_BPF_CLASSIC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer classic.Close()
+	if _, err := Analyze(&classic, testCode, nil); err != ErrArch {
+		t.Errorf("classic BPF engine: %v", err)
+	}
+}
+
+func TestHelperName(t *testing.T) {
+	for id, want := range map[int32]string{
+		1:    "bpf_map_lookup_elem",
+		12:   "bpf_tail_call",
+		113:  "bpf_probe_read_kernel",
+		130:  "bpf_ringbuf_output",
+		211:  "bpf_cgrp_storage_delete",
+		9999: "bpf_helper#9999",
+	} {
+		if got := HelperName(id); got != want {
+			t.Errorf("HelperName(%d) = %q, want %q", id, got, want)
+		}
+	}
+}
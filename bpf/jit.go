@@ -0,0 +1,245 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package bpf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/bpfsnoop/gapstone"
+)
+
+var ErrJITMismatch = errors.New("JIT tables don't match the program")
+
+// A bpf_line_info record. The offsets point into the BTF string section.
+type LineInfo struct {
+	InsnOff     uint32 // BPF instruction index
+	FileNameOff uint32
+	LineOff     uint32
+	LineCol     uint32
+}
+
+func (l LineInfo) Line() uint32 { return l.LineCol >> 10 }
+func (l LineInfo) Col() uint32  { return l.LineCol & 0x3ff }
+
+// The JIT tables of bpf_prog_info, one entry per subprogram in Ksyms and
+// FuncLens, and one per LineInfo record in JitedLineInfo.
+type JITInfo struct {
+	Ksyms         []uint64 // jited_ksyms, where each image is loaded
+	FuncLens      []uint32 // jited_func_lens
+	LineInfo      []LineInfo
+	JitedLineInfo []uint64 // Native address of each LineInfo record
+	// Optional, the offset of the code for each BPF instruction into its
+	// image, as kept by the JIT. Without it instructions are mapped at the
+	// granularity of the line info.
+	InsnOffsets []uint32
+}
+
+// Parse an array of u64, such as jited_ksyms or jited_line_info.
+func ParseU64s(data []byte, order binary.ByteOrder) ([]uint64, error) {
+	if len(data)%8 != 0 {
+		return nil, fmt.Errorf("%d bytes of u64", len(data))
+	}
+	out := make([]uint64, len(data)/8)
+	for i := range out {
+		out[i] = order.Uint64(data[8*i:])
+	}
+	return out, nil
+}
+
+// Parse an array of u32, such as jited_func_lens.
+func ParseU32s(data []byte, order binary.ByteOrder) ([]uint32, error) {
+	if len(data)%4 != 0 {
+		return nil, fmt.Errorf("%d bytes of u32", len(data))
+	}
+	out := make([]uint32, len(data)/4)
+	for i := range out {
+		out[i] = order.Uint32(data[4*i:])
+	}
+	return out, nil
+}
+
+// Parse line_info, made of recSize byte records (line_info_rec_size).
+// Fields a newer kernel adds past bpf_line_info are skipped.
+func ParseLineInfo(data []byte, recSize uint32, order binary.ByteOrder) ([]LineInfo, error) {
+	if recSize < 16 || len(data)%int(recSize) != 0 {
+		return nil, fmt.Errorf("%d bytes of %d byte line info", len(data), recSize)
+	}
+	var out []LineInfo
+	for rec := data; len(rec) > 0; rec = rec[recSize:] {
+		out = append(out, LineInfo{
+			InsnOff:     order.Uint32(rec),
+			FileNameOff: order.Uint32(rec[4:]),
+			LineOff:     order.Uint32(rec[8:]),
+			LineCol:     order.Uint32(rec[12:]),
+		})
+	}
+	return out, nil
+}
+
+// A native instruction of a JITed program.
+type JITInstruction struct {
+	gapstone.Instruction
+	BPF     int // Index of the BPF instruction it was generated for, -1 if unknown
+	Subprog int // Into Program.Subprogs
+}
+
+// A native address where the code for a BPF instruction starts.
+type boundary struct {
+	addr  uint64
+	index int
+}
+
+// Disassemble image, the jited_prog_insns of p, with an engine for the JIT
+// arch, and tie each native instruction to the BPF instruction it came
+// from. The image holds the subprogram images back to back; each is
+// disassembled at its address from info.Ksyms.
+func (p *Program) MapJIT(engine *gapstone.Engine, image []byte, info *JITInfo) ([]JITInstruction, error) {
+	ksyms, lens := info.Ksyms, info.FuncLens
+	if len(ksyms) == 0 && len(lens) == 0 {
+		ksyms, lens = []uint64{0}, []uint32{uint32(len(image))}
+	}
+	if len(ksyms) != len(lens) || len(ksyms) != len(p.Subprogs) {
+		return nil, fmt.Errorf("%w: %d ksyms, %d lengths, %d subprograms", ErrJITMismatch, len(ksyms), len(lens), len(p.Subprogs))
+	}
+	if len(info.LineInfo) != len(info.JitedLineInfo) {
+		return nil, fmt.Errorf("%w: %d line info, %d jited", ErrJITMismatch, len(info.LineInfo), len(info.JitedLineInfo))
+	}
+	if info.InsnOffsets != nil && len(info.InsnOffsets) < p.slots() {
+		return nil, fmt.Errorf("%w: %d instruction offsets", ErrJITMismatch, len(info.InsnOffsets))
+	}
+
+	var out []JITInstruction
+	var off uint64
+	for i, sp := range p.Subprogs {
+		start, size := ksyms[i], uint64(lens[i])
+		if off+size > uint64(len(image)) {
+			return out, fmt.Errorf("%w: image is %d bytes", ErrJITMismatch, len(image))
+		}
+		mem := gapstone.NewBytesMemory(start, image[off:off+size], gapstone.PermRead|gapstone.PermExec)
+		off += size
+
+		var bounds []boundary
+		if info.InsnOffsets != nil {
+			for _, insn := range sp.Instructions {
+				bounds = append(bounds, boundary{start + uint64(info.InsnOffsets[insn.Index]), insn.Index})
+			}
+		} else {
+			for j, li := range info.LineInfo {
+				if addr := info.JitedLineInfo[j]; addr >= start && addr-start < size {
+					bounds = append(bounds, boundary{addr, int(li.InsnOff)})
+				}
+			}
+		}
+		// Code for instructions that emit none starts where the next one's
+		// does, the later boundary wins.
+		sort.SliceStable(bounds, func(a, b int) bool {
+			return bounds[a].addr < bounds[b].addr
+		})
+
+		insns, err := engine.DisasmRange(mem, start, start+size)
+		for _, insn := range insns {
+			ji := JITInstruction{Instruction: insn, BPF: -1, Subprog: i}
+			k := sort.Search(len(bounds), func(k int) bool {
+				return bounds[k].addr > uint64(insn.Address)
+			})
+			if k > 0 {
+				ji.BPF = bounds[k-1].index
+			}
+			out = append(out, ji)
+		}
+		if err != nil {
+			return out, fmt.Errorf("subprog %s: %w", sp.Name, err)
+		}
+	}
+	return out, nil
+}
+
+// Number of instruction slots.
+func (p *Program) slots() int {
+	n := len(p.Instructions)
+	if n == 0 {
+		return 0
+	}
+	last := p.Instructions[n-1]
+	return last.Index + int(last.Size)/InsnSize
+}
+
+// Write the native code interleaved with the BPF instructions it came from.
+// Each run of native instructions is preceded by the BPF instructions
+// mapped to it, as "; index: insn", with jump target labels.
+func (p *Program) WriteJITListing(w io.Writer, insns []JITInstruction) error {
+	var buf bytes.Buffer
+	for i, insn := range insns {
+		if i == 0 || insn.Subprog != insns[i-1].Subprog {
+			fmt.Fprintf(&buf, "\n%s:\n", p.Subprogs[insn.Subprog].Name)
+		}
+		if insn.BPF >= 0 && (i == 0 || insn.BPF != insns[i-1].BPF) {
+			// Up to the next BPF instruction with code of its own
+			end := p.Subprogs[insn.Subprog].End
+			for _, next := range insns[i+1:] {
+				if next.Subprog != insn.Subprog {
+					break
+				}
+				if next.BPF > insn.BPF {
+					end = next.BPF
+					break
+				}
+			}
+			p.writeBPF(&buf, insn.BPF, end)
+		}
+
+		hex := make([]string, len(insn.Bytes))
+		for i, b := range insn.Bytes {
+			hex[i] = fmt.Sprintf("%02x", b)
+		}
+		fmt.Fprintf(&buf, "%8x:\t%-20s\t%s\t%s\n", insn.Address, strings.Join(hex, " "), insn.Mnemonic, insn.OpStr)
+
+		if buf.Len() > 4096 {
+			if _, err := buf.WriteTo(w); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// Write the BPF instructions [from, to).
+func (p *Program) writeBPF(buf *bytes.Buffer, from, to int) {
+	for i := p.find(from); i >= 0 && i < len(p.Instructions); i++ {
+		insn := p.Instructions[i]
+		if insn.Index >= to {
+			break
+		}
+		if label, ok := p.Labels[insn.Index]; ok && insn.Index != p.subprogStart(insn.Index) {
+			fmt.Fprintf(buf, "; %s:\n", label)
+		}
+		fmt.Fprintf(buf, "; %d: %s\t%s", insn.Index, insn.Mnemonic, insn.OpStr)
+		switch {
+		case insn.Helper != "":
+			fmt.Fprintf(buf, "\t; %s", insn.Helper)
+		case insn.Label != "":
+			fmt.Fprintf(buf, "\t; %s", insn.Label)
+		}
+		buf.WriteByte('\n')
+	}
+}
+
+func (p *Program) subprogStart(index int) int {
+	sp, _ := p.Subprog(index)
+	return sp.Start
+}
@@ -0,0 +1,191 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package bpf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bpfsnoop/gapstone"
+)
+
+func readFixture(t *testing.T, name string) []byte {
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// The program and JIT tables from testdata, see jit.s.
+func loadJIT(t *testing.T) (*Program, []byte, *JITInfo) {
+	le := binary.LittleEndian
+	info := &JITInfo{}
+	var err error
+	if info.Ksyms, err = ParseU64s(readFixture(t, "prog.ksyms"), le); err != nil {
+		t.Fatal(err)
+	}
+	if info.FuncLens, err = ParseU32s(readFixture(t, "prog.func_lens"), le); err != nil {
+		t.Fatal(err)
+	}
+	if info.LineInfo, err = ParseLineInfo(readFixture(t, "prog.line_info"), 16, le); err != nil {
+		t.Fatal(err)
+	}
+	if info.JitedLineInfo, err = ParseU64s(readFixture(t, "prog.jited_line_info"), le); err != nil {
+		t.Fatal(err)
+	}
+
+	engine := testEngine(t)
+	defer engine.Close()
+	xlated := readFixture(t, "prog.xlated")
+	if !bytes.Equal(xlated, testCode) {
+		t.Fatal("prog.xlated doesn't match testCode")
+	}
+	p, err := Analyze(&engine, xlated, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p, readFixture(t, "prog.jited"), info
+}
+
+func x86Engine(t *testing.T) gapstone.Engine {
+	engine, err := gapstone.New(gapstone.CS_ARCH_X86, gapstone.CS_MODE_64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return engine
+}
+
+// BPF instruction of the native instruction at addr
+func bpfAt(insns []JITInstruction, addr uint64) (int, bool) {
+	for _, insn := range insns {
+		if uint64(insn.Address) == addr {
+			return insn.BPF, true
+		}
+	}
+	return 0, false
+}
+
+func TestParseLineInfo(t *testing.T) {
+	_, _, info := loadJIT(t)
+	if len(info.LineInfo) != 5 {
+		t.Fatalf("%d line info records, want 5", len(info.LineInfo))
+	}
+	if li := info.LineInfo[2]; li.InsnOff != 4 || li.Line() != 12 || li.Col() != 5 {
+		t.Errorf("line info 2 = %+v, line %d col %d", li, li.Line(), li.Col())
+	}
+	if _, err := ParseLineInfo(make([]byte, 20), 16, binary.LittleEndian); err == nil {
+		t.Error("ParseLineInfo of a partial record succeeded")
+	}
+	if _, err := ParseU64s(make([]byte, 12), binary.LittleEndian); err == nil {
+		t.Error("ParseU64s of 12 bytes succeeded")
+	}
+}
+
+func TestMapJITLineInfo(t *testing.T) {
+	p, image, info := loadJIT(t)
+	engine := x86Engine(t)
+	defer engine.Close()
+
+	insns, err := p.MapJIT(&engine, image, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(insns) != 23 {
+		t.Fatalf("%d native instructions, want 23", len(insns))
+	}
+
+	// The line info for insn 1 also covers the call for insn 3
+	for addr, want := range map[uint64]int{
+		0xffffffffc0001000: 0, // The prologue, the function's first line
+		0xffffffffc000100b: 0,
+		0xffffffffc000100d: 1,
+		0xffffffffc0001017: 1,
+		0xffffffffc000101c: 4,
+		0xffffffffc0001021: 4,
+		0xffffffffc0001028: 7,
+		0xffffffffc0003000: 9,
+		0xffffffffc0003011: 9,
+	} {
+		if got, ok := bpfAt(insns, addr); !ok || got != want {
+			t.Errorf("0x%x: BPF %d (%v), want %d", addr, got, ok, want)
+		}
+	}
+	if last := insns[len(insns)-1]; last.Subprog != 1 {
+		t.Errorf("last instruction in subprog %d", last.Subprog)
+	}
+}
+
+func TestMapJITInsnOffsets(t *testing.T) {
+	p, image, info := loadJIT(t)
+	var err error
+	if info.InsnOffsets, err = ParseU32s(readFixture(t, "prog.insn_offs"), binary.LittleEndian); err != nil {
+		t.Fatal(err)
+	}
+	engine := x86Engine(t)
+	defer engine.Close()
+
+	insns, err := p.MapJIT(&engine, image, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for addr, want := range map[uint64]int{
+		0xffffffffc0001000: -1, // Prologue
+		0xffffffffc000100b: 0,
+		0xffffffffc000100d: 1,
+		0xffffffffc0001017: 3,
+		0xffffffffc000101c: 4,
+		0xffffffffc000101f: 4,
+		0xffffffffc0001021: 5,
+		0xffffffffc0001026: 6,
+		0xffffffffc000102b: 8,
+		0xffffffffc000300b: 9,
+		0xffffffffc0003010: 10,
+	} {
+		if got, ok := bpfAt(insns, addr); !ok || got != want {
+			t.Errorf("0x%x: BPF %d (%v), want %d", addr, got, ok, want)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := p.WriteJITListing(&buf, insns); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"\nprog:\n",
+		"\nsubprog_9:\n",
+		"; 3: ",
+		"; bpf_map_lookup_elem\n",
+		"; L0:\n; 4: ",
+		"; subprog_9\n",
+		"ffffffffc000300b:\tb8 01 00 00 00      \tmov\t",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("listing has no %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestMapJITMismatch(t *testing.T) {
+	p, image, info := loadJIT(t)
+	engine := x86Engine(t)
+	defer engine.Close()
+
+	info.Ksyms = info.Ksyms[:1]
+	if _, err := p.MapJIT(&engine, image, info); err == nil {
+		t.Error("MapJIT with one ksym for two subprograms succeeded")
+	}
+}
@@ -0,0 +1,53 @@
+# Write the bpf_prog_info arrays matching jit.o, see jit.s.
+import struct
+import subprocess
+import sys
+
+KSYMS = [0xffffffffc0001000, 0xffffffffc0003000]
+STARTS = [0, 9]  # First BPF instruction of each subprogram
+SLOTS = 11
+# The program in bpf_test.go
+XLATED = bytes.fromhex(
+    "b701000000000000" "1812000005000000" "0000000000000000"
+    "8500000001000000" "1500020000000000" "8510000003000000"
+    "0500fdff00000000" "b700000000000000" "9500000000000000"
+    "b700000001000000" "9500000000000000"
+)
+LINES = {0: 10, 1: 11, 4: 12, 7: 14, 9: 20}  # BPF instruction -> source line
+
+labels = {}
+for line in subprocess.check_output(["nm", sys.argv[1]], text=True).splitlines():
+    addr, _, name = line.split()
+    labels[name] = int(addr, 16)
+
+funcs = [labels["prog"], labels["subprog_9"]]
+size = funcs[1] + (labels["bpf10"] + 3 - labels["subprog_9"])
+lens = [funcs[1] - funcs[0], size - funcs[1]]
+
+
+def func_of(insn):
+    return 1 if insn >= STARTS[1] else 0
+
+
+def offset(insn):
+    """Offset of the code for insn from the start of its image."""
+    while "bpf%d" % insn not in labels:
+        insn -= 1  # Second half of ld_imm64
+    return labels["bpf%d" % insn] - funcs[func_of(insn)]
+
+
+with open("prog.xlated", "wb") as f:
+    f.write(XLATED)
+with open("prog.ksyms", "wb") as f:
+    f.write(struct.pack("<%dQ" % len(KSYMS), *KSYMS))
+with open("prog.func_lens", "wb") as f:
+    f.write(struct.pack("<%dI" % len(lens), *lens))
+with open("prog.line_info", "wb") as f:
+    for n, (insn, line) in enumerate(sorted(LINES.items())):
+        f.write(struct.pack("<4I", insn, 1, 1 + 16 * n, line << 10 | 5))
+with open("prog.jited_line_info", "wb") as f:
+    for insn in sorted(LINES):
+        off = 0 if insn in STARTS else offset(insn)
+        f.write(struct.pack("<Q", KSYMS[func_of(insn)] + off))
+with open("prog.insn_offs", "wb") as f:
+    f.write(struct.pack("<%dI" % SLOTS, *[offset(i) for i in range(SLOTS)]))
@@ -0,0 +1,36 @@
+# x86-64 JIT image of the program in bpf_test.go, as the kernel lays it out:
+# one image per subprogram, each with the 5 byte fentry nop and a prologue.
+# The prog.* files are the matching bpf_prog_info arrays, little endian,
+# plus prog.insn_offs, the offset of each BPF instruction into its image:
+#
+#	llvm-mc -triple=x86_64 -filetype=obj jit.s -o jit.o
+#	objcopy -O binary -j .text jit.o prog.jited
+#	python3 gen.py jit.o
+#
+# bpfN labels mark where the code for BPF instruction N starts.
+	.text
+prog:
+	.byte 0x0f, 0x1f, 0x44, 0x00, 0x00 # nopl 0(%rax,%rax,1)
+	xorl %eax, %eax
+	pushq %rbp
+	movq %rsp, %rbp
+bpf0:	xorl %edi, %edi
+bpf1:	movabsq $0xffff888003a1c000, %rsi
+bpf3:	callq bpf0+0x1000
+bpf4:	testq %rax, %rax
+	je bpf7
+bpf5:	callq bpf0+0x2000
+bpf6:	jmp bpf4
+bpf7:	xorl %eax, %eax
+bpf8:	leave
+	retq
+	int3
+subprog_9:
+	.byte 0x0f, 0x1f, 0x44, 0x00, 0x00 # nopl 0(%rax,%rax,1)
+	xchgw %ax, %ax
+	pushq %rbp
+	movq %rsp, %rbp
+bpf9:	movl $1, %eax
+bpf10:	leave
+	retq
+	int3
@@ -0,0 +1,127 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package gapstone
+
+// #cgo LDFLAGS: -lcapstone
+// #cgo freebsd CFLAGS: -I/usr/local/include
+// #cgo freebsd LDFLAGS: -L/usr/local/lib
+// #include <stdlib.h>
+// #include <capstone/capstone.h>
+import "C"
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+// Accessed via insn.BPF.XXX
+type BPFInstruction struct {
+	OpCnt    uint8
+	Operands []BPFOperand
+}
+
+// Number of Operands of a given BPF_OP_* type
+func (insn BPFInstruction) OpCount(optype uint) int {
+	count := 0
+	for _, op := range insn.Operands {
+		if op.Type == optype {
+			count++
+		}
+	}
+	return count
+}
+
+type BPFOperand struct {
+	Type   uint // BPF_OP_* - determines which field is set below
+	Reg    uint
+	Imm    uint64
+	Off    uint32 // Jump offset in instructions, as encoded: not sign extended
+	Mem    BPFMemoryOperand
+	MMem   uint32 // M[k] of classic BPF
+	Msh    uint32 // 4*([k]&0xf) of classic BPF
+	Ext    uint32 // BPF_EXT_*
+	Access uint8  // CS_AC_*
+}
+
+type BPFMemoryOperand struct {
+	Base uint
+	Disp uint32
+}
+
+func fillBPFHeader(raw C.cs_insn, insn *Instruction) {
+
+	if raw.detail == nil {
+		return
+	}
+
+	// Cast the cs_detail union
+	cs_bpf := (*C.cs_bpf)(unsafe.Pointer(&raw.detail.anon0[0]))
+
+	bpf := BPFInstruction{
+		OpCnt: uint8(cs_bpf.op_count),
+	}
+
+	// Cast the op_info to a []C.cs_bpf_op
+	var ops []C.cs_bpf_op
+	oih := (*reflect.SliceHeader)(unsafe.Pointer(&ops))
+	oih.Data = uintptr(unsafe.Pointer(&cs_bpf.operands[0]))
+	oih.Len = int(cs_bpf.op_count)
+	oih.Cap = int(cs_bpf.op_count)
+
+	// Create the Go object for each operand
+	for _, cop := range ops {
+
+		if cop._type == BPF_OP_INVALID {
+			break
+		}
+
+		gop := new(BPFOperand)
+		gop.Type = uint(cop._type)
+		gop.Access = uint8(cop.access)
+
+		switch cop._type {
+		// fake a union by setting only the correct struct member
+		case BPF_OP_REG:
+			gop.Reg = uint(*(*C.uint8_t)(unsafe.Pointer(&cop.anon0[0])))
+		case BPF_OP_IMM:
+			gop.Imm = uint64(*(*C.uint64_t)(unsafe.Pointer(&cop.anon0[0])))
+		case BPF_OP_OFF:
+			gop.Off = uint32(*(*C.uint32_t)(unsafe.Pointer(&cop.anon0[0])))
+		case BPF_OP_MEM:
+			cmop := (*C.bpf_op_mem)(unsafe.Pointer(&cop.anon0[0]))
+			gop.Mem = BPFMemoryOperand{
+				Base: uint(cmop.base),
+				Disp: uint32(cmop.disp),
+			}
+		case BPF_OP_MMEM:
+			gop.MMem = uint32(*(*C.uint32_t)(unsafe.Pointer(&cop.anon0[0])))
+		case BPF_OP_MSH:
+			gop.Msh = uint32(*(*C.uint32_t)(unsafe.Pointer(&cop.anon0[0])))
+		case BPF_OP_EXT:
+			gop.Ext = uint32(*(*C.uint32_t)(unsafe.Pointer(&cop.anon0[0])))
+		}
+
+		bpf.Operands = append(bpf.Operands, *gop)
+
+	}
+	insn.BPF = &bpf
+}
+
+func decomposeBPF(e *Engine, raws []C.cs_insn) []Instruction {
+	decomposed := []Instruction{}
+	for _, raw := range raws {
+		decomp := new(Instruction)
+		fillGenericHeader(e, raw, decomp)
+		fillBPFHeader(raw, decomp)
+		decomposed = append(decomposed, *decomp)
+	}
+	return decomposed
+}
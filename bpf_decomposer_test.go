@@ -0,0 +1,79 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package gapstone
+
+import "testing"
+
+func TestBPFDecomposer(t *testing.T) {
+
+	t.Parallel()
+
+	engine, err := New(CS_ARCH_BPF, CS_MODE_BPF_EXTENDED)
+	if err != nil {
+		t.Fatalf("Failed to initialize engine %v", err)
+	}
+	defer engine.Close()
+	engine.SetOption(CS_OPT_DETAIL, CS_OPT_ON)
+
+	code := []byte{
+		0xb7, 0x00, 0x00, 0x00, 0x2a, 0x00, 0x00, 0x00, // mov64 r0, 0x2a
+		0x05, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, // ja +1
+		0x95, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // exit
+	}
+	insns, err := engine.Disasm(code, 0, 0)
+	if err != nil {
+		t.Fatalf("Disassembly error: %v", err)
+	}
+	if len(insns) != 3 {
+		t.Fatalf("Got %d instructions, want 3", len(insns))
+	}
+
+	mov := insns[0].BPF
+	if mov == nil || mov.OpCount(BPF_OP_REG) != 1 || mov.OpCount(BPF_OP_IMM) != 1 {
+		t.Fatalf("mov64 operands: %+v", mov)
+	}
+	assertEqual(t, "mov64 dst %v, want %v", mov.Operands[0].Reg, uint(BPF_REG_R0))
+	assertEqual(t, "mov64 imm 0x%x, want 0x%x", mov.Operands[1].Imm, uint64(0x2a))
+
+	ja := insns[1].BPF
+	if ja == nil || ja.OpCount(BPF_OP_OFF) != 1 {
+		t.Fatalf("ja operands: %+v", ja)
+	}
+	assertEqual(t, "ja off %v, want %v", ja.Operands[0].Off, uint32(1))
+
+	if exit := insns[2].BPF; exit == nil || len(exit.Operands) != 0 {
+		t.Errorf("exit operands: %+v", exit)
+	}
+}
+
+func TestBPFDisasmIter(t *testing.T) {
+	engine, err := New(CS_ARCH_BPF, CS_MODE_BPF_EXTENDED)
+	if err != nil {
+		t.Fatalf("Failed to initialize engine %v", err)
+	}
+	defer engine.Close()
+	engine.SetOption(CS_OPT_DETAIL, CS_OPT_ON)
+
+	code := []byte{
+		0xb7, 0x00, 0x00, 0x00, 0x2a, 0x00, 0x00, 0x00, // mov64 r0, 0x2a
+		0x95, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // exit
+	}
+	var insns []Instruction
+	for insn := range engine.DisasmIter(code, 0) {
+		insns = append(insns, insn)
+	}
+	if len(insns) != 2 {
+		t.Fatalf("Got %d instructions, want 2", len(insns))
+	}
+	if insns[0].BPF == nil || len(insns[0].BPF.Operands) != 2 {
+		t.Errorf("mov64 details: %+v", insns[0].BPF)
+	}
+}
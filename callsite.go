@@ -0,0 +1,335 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package gapstone
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"slices"
+	"strings"
+)
+
+// How a call site reaches its target, see FindCallSites
+type CallKind int
+
+const (
+	CallDirect   CallKind = iota // call target, bl target
+	CallThunk                    // call __x86_indirect_thunk_*, the register loaded with target
+	CallRegister                 // call reg or blr, the register loaded with target
+	CallGOT                      // call [rip+disp], the slot holding target
+	CallPLT                      // Direct call to a PLT stub jumping through a slot holding target
+)
+
+func (k CallKind) String() string {
+	switch k {
+	case CallDirect:
+		return "direct"
+	case CallThunk:
+		return "thunk"
+	case CallRegister:
+		return "register"
+	case CallGOT:
+		return "got"
+	case CallPLT:
+		return "plt"
+	}
+	return "unknown"
+}
+
+// A call to the target of FindCallSites.
+type CallSite struct {
+	Addr uint64
+	Size uint64
+	Kind CallKind
+	Slot uint64 // The GOT slot read, for CallGOT, CallPLT and loads from memory
+}
+
+// Registers retpoline thunks are named after
+var x86ThunkRegs = map[string]uint{
+	"rax": X86_REG_RAX, "rbx": X86_REG_RBX, "rcx": X86_REG_RCX, "rdx": X86_REG_RDX,
+	"rsi": X86_REG_RSI, "rdi": X86_REG_RDI, "rbp": X86_REG_RBP,
+	"r8": X86_REG_R8, "r9": X86_REG_R9, "r10": X86_REG_R10, "r11": X86_REG_R11,
+	"r12": X86_REG_R12, "r13": X86_REG_R13, "r14": X86_REG_R14, "r15": X86_REG_R15,
+}
+
+// A register known to hold an address
+type regValue struct {
+	value uint64
+	slot  uint64 // Where it was loaded from, 0 if not loaded
+}
+
+// Find the calls to target in insns: direct calls, x86 calls through a
+// retpoline thunk or a register loaded with target (mov, lea or a load
+// through a GOT slot) and calls through a RIP-relative GOT slot or a PLT
+// stub, and arm64 bl and blr of a register set up with adrp+add or
+// adrp+ldr. Register values are only tracked within straight-line code,
+// they are forgotten at branches and at the targets of the branches in insns.
+// mem is read for GOT slots and PLT stubs, which are assumed to be 64 bit
+// little endian; s tells the retpoline thunks by name. Either may be nil,
+// leaving only the call sites that can be resolved without them. Needs
+// CS_OPT_DETAIL.
+func FindCallSites(insns []Instruction, target uint64, mem Memory, s Symbolizer) []CallSite {
+	var sites []CallSite
+	regs := make(map[uint]regValue)
+	holds := func(reg uint) bool {
+		v, ok := regs[reg]
+		return ok && v.value == target
+	}
+	labels := make(map[uint64]bool)
+	for _, insn := range insns {
+		if f := insn.Flow(); f.Direct && f.Kind != FlowCall {
+			labels[f.Target] = true
+		}
+	}
+	for _, insn := range insns {
+		// Reached from elsewhere, with other values
+		if labels[uint64(insn.Address)] {
+			clear(regs)
+		}
+		site := CallSite{Addr: uint64(insn.Address), Size: uint64(insn.Size)}
+		flow := insn.Flow()
+		found := false
+		switch {
+		case flow.Kind != FlowCall:
+		case flow.Direct && flow.Target == target:
+			site.Kind, found = CallDirect, true
+		case flow.Direct && insn.X86 != nil:
+			if reg, ok := x86Thunk(flow.Target, s); ok && holds(reg) {
+				site.Kind, site.Slot, found = CallThunk, regs[reg].slot, true
+			} else if slot, ok := x86PLTSlot(mem, flow.Target); ok && readPointer(mem, slot) == target {
+				site.Kind, site.Slot, found = CallPLT, slot, true
+			}
+		case insn.X86 != nil && len(insn.X86.Operands) == 1:
+			op := insn.X86.Operands[0]
+			switch {
+			case op.Type == X86_OP_REG && holds(op.Reg):
+				site.Kind, site.Slot, found = CallRegister, regs[op.Reg].slot, true
+			case op.Type == X86_OP_MEM && op.Mem.Base == X86_REG_RIP && op.Mem.Index == X86_REG_INVALID:
+				slot := uint64(insn.Address+insn.Size) + uint64(op.Mem.Disp)
+				if readPointer(mem, slot) == target {
+					site.Kind, site.Slot, found = CallGOT, slot, true
+				}
+			}
+		case insn.Arm64 != nil && insn.Id == ARM64_INS_BLR && len(insn.Arm64.Operands) == 1:
+			reg := insn.Arm64.Operands[0].Reg
+			if holds(reg) {
+				site.Kind, site.Slot, found = CallRegister, regs[reg].slot, true
+			}
+		}
+		if found {
+			sites = append(sites, site)
+		}
+
+		switch {
+		case flow.Kind != FlowNone:
+			clear(regs)
+		case insn.X86 != nil:
+			trackX86(regs, insn, mem)
+		case insn.Arm64 != nil:
+			trackArm64(regs, insn, mem)
+		}
+	}
+	return sites
+}
+
+// The register of a retpoline thunk at addr
+func x86Thunk(addr uint64, s Symbolizer) (uint, bool) {
+	if s == nil {
+		return 0, false
+	}
+	name, off, ok := s.Lookup(addr)
+	if !ok || off != 0 || !strings.HasPrefix(name, "__x86_indirect_thunk_") {
+		return 0, false
+	}
+	reg, ok := x86ThunkRegs[strings.TrimPrefix(name, "__x86_indirect_thunk_")]
+	return reg, ok
+}
+
+// x86-64 PLT stub: [endbr64] [bnd] jmp *disp(%rip)
+var (
+	x86Endbr64   = []byte{0xf3, 0x0f, 0x1e, 0xfa}
+	x86JmpRIP    = []byte{0xff, 0x25}
+	x86BndJmpRIP = []byte{0xf2, 0xff, 0x25}
+)
+
+// The GOT slot the PLT stub at addr jumps through
+func x86PLTSlot(mem Memory, addr uint64) (uint64, bool) {
+	if mem == nil {
+		return 0, false
+	}
+	code, err := mem.ReadAt(addr, 11)
+	if err != nil {
+		return 0, false
+	}
+	pos := 0
+	if bytes.HasPrefix(code, x86Endbr64) {
+		pos += len(x86Endbr64)
+	}
+	switch {
+	case bytes.HasPrefix(code[pos:], x86JmpRIP):
+		pos += len(x86JmpRIP)
+	case bytes.HasPrefix(code[pos:], x86BndJmpRIP):
+		pos += len(x86BndJmpRIP)
+	default:
+		return 0, false
+	}
+	if len(code) < pos+4 {
+		return 0, false
+	}
+	disp := int32(binary.LittleEndian.Uint32(code[pos:]))
+	return addr + uint64(pos+4) + uint64(int64(disp)), true
+}
+
+// Read a 64 bit little endian pointer, 0 if it isn't mapped.
+func readPointer(mem Memory, addr uint64) uint64 {
+	if mem == nil {
+		return 0
+	}
+	b, err := mem.ReadAt(addr, 8)
+	if err != nil || len(b) < 8 {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(b)
+}
+
+func isX86GPR64(reg uint) bool {
+	for _, r := range x86ThunkRegs {
+		if r == reg {
+			return true
+		}
+	}
+	return false
+}
+
+// Follow mov reg, imm, lea reg, [rip+disp] and mov reg, [rip+disp] into
+// 64 bit registers, forgetting the registers anything else writes.
+func trackX86(regs map[uint]regValue, insn Instruction, mem Memory) {
+	ops := insn.X86.Operands
+	if len(ops) == 2 && ops[0].Type == X86_OP_REG && isX86GPR64(ops[0].Reg) {
+		dst, src := ops[0].Reg, ops[1]
+		rip := src.Type == X86_OP_MEM && src.Mem.Base == X86_REG_RIP && src.Mem.Index == X86_REG_INVALID
+		addr := uint64(insn.Address+insn.Size) + uint64(src.Mem.Disp)
+		switch {
+		case insn.Id == X86_INS_MOV && src.Type == X86_OP_IMM,
+			insn.Id == X86_INS_MOVABS && src.Type == X86_OP_IMM:
+			regs[dst] = regValue{value: uint64(src.Imm)}
+			return
+		case insn.Id == X86_INS_LEA && rip:
+			regs[dst] = regValue{value: addr}
+			return
+		case insn.Id == X86_INS_MOV && rip:
+			regs[dst] = regValue{value: readPointer(mem, addr), slot: addr}
+			return
+		}
+	}
+
+	written := slices.Concat(insn.AllRegistersWritten, insn.RegistersWritten)
+	for _, op := range ops {
+		if op.Type == X86_OP_REG && op.Access&CS_AC_WRITE != 0 {
+			written = append(written, op.Reg)
+		}
+	}
+	for _, reg := range written {
+		// A write to eax or al changes rax
+		if info, ok := RegInfo(CS_ARCH_X86, reg); ok {
+			delete(regs, info.Full)
+			continue
+		}
+		// Something that can't be told apart
+		clear(regs)
+		return
+	}
+}
+
+// Follow adrp, add reg, reg, #imm and ldr reg, [reg, #imm] into x
+// registers, forgetting the registers anything else writes: w16 changes x16.
+func trackArm64(regs map[uint]regValue, insn Instruction, mem Memory) {
+	ops := insn.Arm64.Operands
+	if len(ops) > 0 && ops[0].Type == ARM64_OP_REG && Canonical(CS_ARCH_ARM64, ops[0].Reg) == ops[0].Reg {
+		dst := ops[0].Reg
+		switch {
+		case insn.Id == ARM64_INS_ADRP && len(ops) == 2 && ops[1].Type == ARM64_OP_IMM:
+			regs[dst] = regValue{value: uint64(ops[1].Imm)}
+			return
+		case insn.Id == ARM64_INS_ADD && len(ops) == 3 && ops[1].Type == ARM64_OP_REG && ops[2].Type == ARM64_OP_IMM:
+			if v, ok := regs[ops[1].Reg]; ok && v.slot == 0 {
+				regs[dst] = regValue{value: v.value + uint64(ops[2].Imm)}
+				return
+			}
+		case insn.Id == ARM64_INS_LDR && len(ops) == 2 && ops[1].Type == ARM64_OP_MEM && ops[1].Mem.Index == ARM64_REG_INVALID:
+			if v, ok := regs[ops[1].Mem.Base]; ok && v.slot == 0 {
+				slot := v.value + uint64(int64(ops[1].Mem.Disp))
+				regs[dst] = regValue{value: readPointer(mem, slot), slot: slot}
+				return
+			}
+		}
+	}
+
+	written := slices.Concat(insn.AllRegistersWritten, insn.RegistersWritten)
+	for i, op := range ops {
+		switch {
+		// Capstone doesn't always say, so the first register counts as
+		// written unless it is known to be only read
+		case op.Type == ARM64_OP_REG && (op.Access&CS_AC_WRITE != 0 || i == 0 && op.Access != CS_AC_READ):
+			written = append(written, op.Reg)
+		case op.Type == ARM64_OP_MEM && insn.Arm64.Writeback:
+			written = append(written, op.Mem.Base)
+		}
+	}
+	for _, reg := range written {
+		delete(regs, Canonical(CS_ARCH_ARM64, reg))
+	}
+}
+
+// Minimum instruction size, by which FindImageCallSites skips bytes that
+// don't decode.
+func (e *Engine) insnAlign() uint64 {
+	switch {
+	case e.arch == CS_ARCH_X86:
+		return 1
+	case e.mode&CS_MODE_THUMB != 0:
+		return 2
+	}
+	return 4
+}
+
+// Find the calls to target in every executable Region of mem, see
+// FindCallSites. Regions are swept linearly, stepping over bytes that don't
+// decode.
+func (e *Engine) FindImageCallSites(mem Memory, target uint64, s Symbolizer) ([]CallSite, error) {
+	var sites []CallSite
+	for _, r := range mem.Regions() {
+		if r.Perm&PermExec == 0 {
+			continue
+		}
+		for addr := r.Start; addr < r.End(); {
+			insns, err := e.DisasmRange(mem, addr, r.End())
+			sites = append(sites, FindCallSites(insns, target, mem, s)...)
+			if err == nil {
+				break
+			}
+			if !errors.Is(err, ErrInvalidInstruction) {
+				// The last instruction runs past the Region
+				if errors.Is(err, ErrUnmapped) {
+					break
+				}
+				return sites, err
+			}
+			if len(insns) > 0 {
+				last := insns[len(insns)-1]
+				addr = uint64(last.Address + last.Size)
+			}
+			addr += e.insnAlign()
+		}
+	}
+	return sites, nil
+}
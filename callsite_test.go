@@ -0,0 +1,183 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package gapstone
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// A GOT slot at 0x1800 holding 0x2000
+func callSiteMemory(t *testing.T, code, stub []byte) Memory {
+	var mem SegmentedMemory
+	got := binary.LittleEndian.AppendUint64(nil, 0x2000)
+	for _, m := range []Memory{
+		NewBytesMemory(0x1000, code, PermRead|PermExec),
+		NewBytesMemory(0x1700, stub, PermRead|PermExec),
+		NewBytesMemory(0x1800, got, PermRead|PermWrite),
+	} {
+		if err := mem.Map(m); err != nil {
+			t.Fatalf("Map failed: %v", err)
+		}
+	}
+	return &mem
+}
+
+func TestFindCallSitesX86(t *testing.T) {
+	engine := entryEngine(t, CS_ARCH_X86, CS_MODE_64)
+	defer engine.Close()
+
+	code := []byte("\xe8\xfb\x0f\x00\x00" + // call 0x2000
+		"\x48\x8b\x05\xf4\x07\x00\x00" + // mov rax, [rip + 0x7f4]
+		"\xe8\xef\x1f\x00\x00" + // call __x86_indirect_thunk_rax
+		"\xff\x15\xe9\x07\x00\x00" + // call [rip + 0x7e9]
+		"\x48\xc7\xc1\x00\x20\x00\x00" + // mov rcx, 0x2000
+		"\xff\xd1" + // call rcx
+		"\xe8\xdb\x06\x00\x00" + // call 0x1700, the PLT stub
+		"\x48\xc7\xc0\x00\x20\x00\x00" + // mov rax, 0x2000
+		"\x31\xc0" + // xor eax, eax
+		"\xff\xd0" + // call rax
+		"\xe8\xcf\x0f\x00\x00" + // call 0x2004
+		"\xc3") // ret
+	stub := []byte("\xf3\x0f\x1e\xfa" + // endbr64
+		"\xf2\xff\x25\xf5\x00\x00\x00") // bnd jmp [rip + 0xf5]
+	mem := callSiteMemory(t, code, stub)
+	syms := NewSymbolTable([]Symbol{{Name: "__x86_indirect_thunk_rax", Addr: 0x3000, Size: 0x10}})
+
+	want := []CallSite{
+		{Addr: 0x1000, Size: 5, Kind: CallDirect},
+		{Addr: 0x100c, Size: 5, Kind: CallThunk, Slot: 0x1800},
+		{Addr: 0x1011, Size: 6, Kind: CallGOT, Slot: 0x1800},
+		{Addr: 0x101e, Size: 2, Kind: CallRegister},
+		{Addr: 0x1020, Size: 5, Kind: CallPLT, Slot: 0x1800},
+	}
+	insns, err := engine.Disasm(code, 0x1000, 0)
+	if err != nil {
+		t.Fatalf("Disassembly error: %v", err)
+	}
+	if got := FindCallSites(insns, 0x2000, mem, syms); !reflect.DeepEqual(got, want) {
+		t.Errorf("FindCallSites:\n got %+v\nwant %+v", got, want)
+	}
+
+	got, err := engine.FindImageCallSites(mem, 0x2000, syms)
+	if err != nil {
+		t.Fatalf("FindImageCallSites failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FindImageCallSites:\n got %+v\nwant %+v", got, want)
+	}
+
+	// Without mem and s only what's in the code itself
+	if got := FindCallSites(insns, 0x2000, nil, nil); len(got) != 2 || got[1].Kind != CallRegister {
+		t.Errorf("FindCallSites without mem = %+v", got)
+	}
+}
+
+func TestFindCallSitesPartialWrite(t *testing.T) {
+	engine := entryEngine(t, CS_ARCH_X86, CS_MODE_64)
+	defer engine.Close()
+
+	// A varargs call: al holds the number of vector registers used
+	code := []byte("\x4c\x8b\x1d\xf9\x07\x00\x00" + // mov r11, [rip + 0x7f9]
+		"\x31\xc0" + // xor eax, eax
+		"\x41\xff\xd3" + // call r11
+		"\xc3") // ret
+	mem := callSiteMemory(t, code, nil)
+	insns, err := engine.Disasm(code, 0x1000, 0)
+	if err != nil {
+		t.Fatalf("Disassembly error: %v", err)
+	}
+	want := []CallSite{{Addr: 0x1009, Size: 3, Kind: CallRegister, Slot: 0x1800}}
+	if got := FindCallSites(insns, 0x2000, mem, nil); !reflect.DeepEqual(got, want) {
+		t.Errorf("FindCallSites:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestFindCallSitesBranchTarget(t *testing.T) {
+	engine := entryEngine(t, CS_ARCH_X86, CS_MODE_64)
+	defer engine.Close()
+
+	code := []byte("\x85\xff" + // test edi, edi
+		"\x74\x07" + // je 0x100b
+		"\x48\xc7\xc0\x00\x20\x00\x00" + // mov rax, 0x2000
+		"\xff\xd0" + // call rax
+		"\xc3") // ret
+	insns, err := engine.Disasm(code, 0x1000, 0)
+	if err != nil {
+		t.Fatalf("Disassembly error: %v", err)
+	}
+	// The je reaches the call without the mov
+	if got := FindCallSites(insns, 0x2000, nil, nil); len(got) != 0 {
+		t.Errorf("FindCallSites = %+v, want none", got)
+	}
+}
+
+func TestFindCallSitesArm64(t *testing.T) {
+	engine := entryEngine(t, CS_ARCH_ARM64, CS_MODE_ARM)
+	defer engine.Close()
+
+	code := []byte("\x70\x00\x00\xf0" + // adrp x16, 0x10000
+		"\x11\x06\x40\xf9" + // ldr x17, [x16, #8]
+		"\x20\x02\x3f\xd6" + // blr x17
+		"\x01\xfc\x00\x94" + // bl 0x40010
+		"\xe1\x01\x00\xf0" + // adrp x1, 0x40000
+		"\x21\x40\x00\x91" + // add x1, x1, #0x10
+		"\x20\x00\x3f\xd6" + // blr x1
+		"\xe2\x01\x00\xf0" + // adrp x2, 0x40000
+		"\x42\x40\x00\x91" + // add x2, x2, #0x10
+		"\xe2\x03\x03\xaa" + // mov x2, x3
+		"\x40\x00\x3f\xd6" + // blr x2
+		"\xc0\x03\x5f\xd6") // ret
+	var mem SegmentedMemory
+	mem.Map(NewBytesMemory(0x1000, code, PermRead|PermExec))
+	mem.Map(NewBytesMemory(0x10008, binary.LittleEndian.AppendUint64(nil, 0x40010), PermRead))
+
+	insns, err := engine.Disasm(code, 0x1000, 0)
+	if err != nil {
+		t.Fatalf("Disassembly error: %v", err)
+	}
+	want := []CallSite{
+		{Addr: 0x1008, Size: 4, Kind: CallRegister, Slot: 0x10008},
+		{Addr: 0x100c, Size: 4, Kind: CallDirect},
+		{Addr: 0x1018, Size: 4, Kind: CallRegister},
+	}
+	if got := FindCallSites(insns, 0x40010, &mem, nil); !reflect.DeepEqual(got, want) {
+		t.Errorf("FindCallSites:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestFindCallSitesArm64PartialWrite(t *testing.T) {
+	engine := entryEngine(t, CS_ARCH_ARM64, CS_MODE_ARM)
+	defer engine.Close()
+
+	code := []byte("\x70\x00\x00\xf0" + // adrp x16, 0x10000
+		"\x11\x06\x40\xf9" + // ldr x17, [x16, #8]
+		"\x31\x00\x80\x52" + // mov w17, #1
+		"\x20\x02\x3f\xd6" + // blr x17
+		"\x70\x00\x00\xf0" + // adrp x16, 0x10000
+		"\x11\x06\x40\xf9" + // ldr x17, [x16, #8]
+		"\xf0\x47\x40\xa9" + // ldp x16, x17, [sp]
+		"\x20\x02\x3f\xd6" + // blr x17
+		"\xc0\x03\x5f\xd6") // ret
+	var mem SegmentedMemory
+	mem.Map(NewBytesMemory(0x1000, code, PermRead|PermExec))
+	mem.Map(NewBytesMemory(0x10008, binary.LittleEndian.AppendUint64(nil, 0x40010), PermRead))
+
+	insns, err := engine.Disasm(code, 0x1000, 0)
+	if err != nil {
+		t.Fatalf("Disassembly error: %v", err)
+	}
+	// Both writes replace the loaded x17
+	if got := FindCallSites(insns, 0x40010, &mem, nil); len(got) != 0 {
+		t.Errorf("FindCallSites = %+v, want none", got)
+	}
+}
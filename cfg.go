@@ -0,0 +1,124 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package gapstone
+
+import "sort"
+
+// A straight-line run of instructions covering [Start, End). Calls don't end
+// a block.
+type BasicBlock struct {
+	Start        uint64
+	End          uint64
+	Instructions []Instruction
+	Succs        []int // Indices into CFG.Blocks: the branch target first, then the fall through
+	Preds        []int
+}
+
+// Control flow graph of a function, see BuildCFG.
+type CFG struct {
+	Blocks []BasicBlock // Sorted by Start, Blocks[0] is the entry
+}
+
+// Split insns, a function disassembled in address order, into basic blocks
+// and link them up along the direct branches and fall through edges.
+// Branches leaving the function, indirect jumps, returns and traps have no
+// successor inside it. On MIPS and SPARC a block ends with the delay slot
+// of its branch. Needs CS_OPT_DETAIL.
+func BuildCFG(insns []Instruction) *CFG {
+	g := &CFG{}
+	if len(insns) == 0 {
+		return g
+	}
+
+	flows := make([]Flow, len(insns))
+	starts := make(map[uint64]bool, len(insns))
+	for i, insn := range insns {
+		flows[i] = insn.Flow()
+		starts[uint64(insn.Address)] = true
+	}
+	// A branch with a delay slot takes effect after it, so the slot ends
+	// the block in its place
+	for i := 0; i+1 < len(insns); i++ {
+		if flows[i].Delay && insns[i+1].Address == insns[i].Address+insns[i].Size {
+			flows[i], flows[i+1] = Flow{}, flows[i]
+			i++
+		}
+	}
+	leaders := map[uint64]bool{uint64(insns[0].Address): true}
+	for i, insn := range insns {
+		f := flows[i]
+		if f.Direct && f.Kind != FlowCall && starts[f.Target] {
+			leaders[f.Target] = true
+		}
+		next := uint64(insn.Address + insn.Size)
+		if i+1 < len(insns) && (f.Kind != FlowNone && f.Kind != FlowCall || uint64(insns[i+1].Address) != next) {
+			leaders[uint64(insns[i+1].Address)] = true
+		}
+	}
+
+	var lasts []int // Index in insns of the last instruction of each block
+	for i := 0; i < len(insns); {
+		j := i + 1
+		for j < len(insns) && !leaders[uint64(insns[j].Address)] {
+			j++
+		}
+		last := insns[j-1]
+		g.Blocks = append(g.Blocks, BasicBlock{
+			Start:        uint64(insns[i].Address),
+			End:          uint64(last.Address + last.Size),
+			Instructions: insns[i:j],
+		})
+		lasts = append(lasts, j-1)
+		i = j
+	}
+
+	for b := range g.Blocks {
+		blk := &g.Blocks[b]
+		f := flows[lasts[b]]
+		if f.Direct && (f.Kind == FlowJump || f.Kind == FlowCondJump) {
+			if t, ok := g.Block(f.Target); ok && g.Blocks[t].Start == f.Target {
+				g.link(b, t)
+			}
+		}
+		if f.FallsThrough() && b+1 < len(g.Blocks) && g.Blocks[b+1].Start == blk.End {
+			g.link(b, b+1)
+		}
+	}
+	return g
+}
+
+func (g *CFG) link(from, to int) {
+	for _, s := range g.Blocks[from].Succs {
+		if s == to {
+			return
+		}
+	}
+	g.Blocks[from].Succs = append(g.Blocks[from].Succs, to)
+	g.Blocks[to].Preds = append(g.Blocks[to].Preds, from)
+}
+
+// Index of the block containing addr.
+func (g *CFG) Block(addr uint64) (int, bool) {
+	i := sort.Search(len(g.Blocks), func(i int) bool { return g.Blocks[i].Start > addr })
+	if i == 0 || addr >= g.Blocks[i-1].End {
+		return 0, false
+	}
+	return i - 1, true
+}
+
+// Number of edges between blocks.
+func (g *CFG) Edges() int {
+	n := 0
+	for _, b := range g.Blocks {
+		n += len(b.Succs)
+	}
+	return n
+}
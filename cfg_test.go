@@ -0,0 +1,65 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package gapstone
+
+import (
+	"reflect"
+	"testing"
+)
+
+// if (edi) eax = 2; else eax = 1; return
+const cfgCode = "\x85\xff" + // test edi, edi
+	"\x74\x07" + // je 0x100b
+	"\xb8\x01\x00\x00\x00" + // mov eax, 1
+	"\xeb\x05" + // jmp 0x1010
+	"\xb8\x02\x00\x00\x00" + // mov eax, 2
+	"\xc3" // ret
+
+func TestBuildCFG(t *testing.T) {
+	engine := entryEngine(t, CS_ARCH_X86, CS_MODE_64)
+	defer engine.Close()
+
+	insns, err := engine.Disasm([]byte(cfgCode), 0x1000, 0)
+	if err != nil {
+		t.Fatalf("Disassembly error: %v", err)
+	}
+	g := BuildCFG(insns)
+	want := []struct {
+		start, end   uint64
+		succs, preds []int
+	}{
+		{0x1000, 0x1004, []int{2, 1}, nil},
+		{0x1004, 0x100b, []int{3}, []int{0}},
+		{0x100b, 0x1010, []int{3}, []int{0}},
+		{0x1010, 0x1011, nil, []int{1, 2}},
+	}
+	if len(g.Blocks) != len(want) {
+		t.Fatalf("%d blocks, want %d", len(g.Blocks), len(want))
+	}
+	for i, w := range want {
+		b := g.Blocks[i]
+		if b.Start != w.start || b.End != w.end || !reflect.DeepEqual(b.Succs, w.succs) || !reflect.DeepEqual(b.Preds, w.preds) {
+			t.Errorf("block %d: [0x%x, 0x%x) succs %v preds %v, want %+v", i, b.Start, b.End, b.Succs, b.Preds, w)
+		}
+	}
+	if g.Edges() != 4 {
+		t.Errorf("%d edges, want 4", g.Edges())
+	}
+	if i, ok := g.Block(0x1005); !ok || i != 1 {
+		t.Errorf("Block(0x1005) = %d, %v", i, ok)
+	}
+	if _, ok := g.Block(0x1011); ok {
+		t.Error("Block(0x1011) found a block past the end")
+	}
+	if g := BuildCFG(nil); len(g.Blocks) != 0 {
+		t.Errorf("BuildCFG(nil) has %d blocks", len(g.Blocks))
+	}
+}
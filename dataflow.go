@@ -0,0 +1,358 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package gapstone
+
+import "math/bits"
+
+// A register definition: instruction Insn writes Reg
+type RegDef struct {
+	Insn int   // Index into Dataflow.Insns
+	Reg  uint  // Full register, rax for a write to eax
+	Uses []int // Instructions reading this value, indices into Dataflow.Insns
+}
+
+// Register dataflow of a function: liveness, reaching definitions and
+// def-use chains, see CFG.Dataflow.
+type Dataflow struct {
+	CFG   *CFG
+	Insns []Instruction // The instructions of the blocks, in order
+	Defs  []RegDef
+
+	first   []int      // Index in Insns of the first instruction of each block
+	block   []int      // Block of each instruction
+	reads   []bitSet   // Full registers read by each instruction
+	writes  [][]regDef // Full registers written by each instruction
+	reach   []bitSet   // Defs reaching each instruction
+	liveIn  []bitSet   // Per block
+	liveOut []bitSet
+}
+
+type regDef struct {
+	reg   uint
+	kills bool // Overwrites all of reg
+	def   int  // Index into Dataflow.Defs
+}
+
+// Compute the register dataflow of the function, from the registers each
+// instruction reads and writes according to cs_regs_access, so this needs
+// CS_OPT_DETAIL. Sub-registers are folded into their full register, see
+// RegInfo: a read of al is a read of rax, a write to eax, which zero
+// extends, kills rax, but a write to ax doesn't. Nothing is live on leaving
+// the function and calls only use and clobber what Capstone says they do,
+// there is no ABI model.
+func (g *CFG) Dataflow() *Dataflow {
+	d := &Dataflow{CFG: g}
+	for b, blk := range g.Blocks {
+		d.first = append(d.first, len(d.Insns))
+		for _, insn := range blk.Instructions {
+			d.Insns = append(d.Insns, insn)
+			d.block = append(d.block, b)
+		}
+	}
+
+	d.reads = make([]bitSet, len(d.Insns))
+	d.writes = make([][]regDef, len(d.Insns))
+	defsOf := make(map[uint][]int)
+	for i, insn := range d.Insns {
+		for _, r := range insn.AllRegistersRead {
+			if full, _, ok := fullReg(insn, r); ok {
+				d.reads[i].add(full)
+			}
+		}
+		for _, r := range insn.AllRegistersWritten {
+			full, kills, ok := fullReg(insn, r)
+			if !ok {
+				continue
+			}
+			w := regDef{reg: full, kills: kills, def: len(d.Defs)}
+			d.writes[i] = append(d.writes[i], w)
+			defsOf[full] = append(defsOf[full], w.def)
+			d.Defs = append(d.Defs, RegDef{Insn: i, Reg: full})
+		}
+	}
+
+	d.liveness()
+	d.reaching(defsOf)
+	for i := range d.Insns {
+		for _, def := range d.reach[i].members() {
+			if d.reads[i].has(d.Defs[def].Reg) {
+				d.Defs[def].Uses = append(d.Defs[def].Uses, i)
+			}
+		}
+	}
+	return d
+}
+
+// Apply instruction i to the live registers, going backwards
+func (d *Dataflow) liveStep(live *bitSet, i int) {
+	for _, w := range d.writes[i] {
+		if w.kills {
+			live.remove(w.reg)
+		}
+	}
+	live.union(d.reads[i])
+}
+
+func (d *Dataflow) blockRange(b int) (int, int) {
+	if b+1 < len(d.first) {
+		return d.first[b], d.first[b+1]
+	}
+	return d.first[b], len(d.Insns)
+}
+
+func (d *Dataflow) liveness() {
+	n := len(d.CFG.Blocks)
+	d.liveIn = make([]bitSet, n)
+	d.liveOut = make([]bitSet, n)
+	for changed := true; changed; {
+		changed = false
+		for b := n - 1; b >= 0; b-- {
+			var out bitSet
+			for _, s := range d.CFG.Blocks[b].Succs {
+				out.union(d.liveIn[s])
+			}
+			live := out.clone()
+			start, end := d.blockRange(b)
+			for i := end - 1; i >= start; i-- {
+				d.liveStep(&live, i)
+			}
+			d.liveOut[b] = out
+			if !live.equal(d.liveIn[b]) {
+				d.liveIn[b] = live
+				changed = true
+			}
+		}
+	}
+}
+
+func (d *Dataflow) reaching(defsOf map[uint][]int) {
+	n := len(d.CFG.Blocks)
+	out := make([]bitSet, n)
+	d.reach = make([]bitSet, len(d.Insns))
+	for changed := true; changed; {
+		changed = false
+		for b := 0; b < n; b++ {
+			var in bitSet
+			for _, p := range d.CFG.Blocks[b].Preds {
+				in.union(out[p])
+			}
+			start, end := d.blockRange(b)
+			for i := start; i < end; i++ {
+				d.reach[i] = in.clone()
+				for _, w := range d.writes[i] {
+					if w.kills {
+						for _, def := range defsOf[w.reg] {
+							in.remove(uint(def))
+						}
+					}
+				}
+				for _, w := range d.writes[i] {
+					in.add(uint(w.def))
+				}
+			}
+			if !in.equal(out[b]) {
+				out[b] = in
+				changed = true
+			}
+		}
+	}
+}
+
+// Full registers live on entry to block b.
+func (d *Dataflow) LiveIn(b int) []uint {
+	return d.liveIn[b].members()
+}
+
+// Full registers live on exit from block b.
+func (d *Dataflow) LiveOut(b int) []uint {
+	return d.liveOut[b].members()
+}
+
+// Full registers live right before instruction i executes, whose value may
+// still be read.
+func (d *Dataflow) LiveBefore(i int) []uint {
+	live := d.liveAfter(i)
+	d.liveStep(&live, i)
+	return live.members()
+}
+
+// Full registers live right after instruction i executes.
+func (d *Dataflow) LiveAfter(i int) []uint {
+	return d.liveAfter(i).members()
+}
+
+func (d *Dataflow) liveAfter(i int) bitSet {
+	b := d.block[i]
+	live := d.liveOut[b].clone()
+	_, end := d.blockRange(b)
+	for j := end - 1; j > i; j-- {
+		d.liveStep(&live, j)
+	}
+	return live
+}
+
+// Full registers live before the instruction at addr, such as a probe point.
+func (d *Dataflow) LiveAt(addr uint64) ([]uint, bool) {
+	i, ok := d.Index(addr)
+	if !ok {
+		return nil, false
+	}
+	return d.LiveBefore(i), true
+}
+
+// Index in Insns of the instruction at addr.
+func (d *Dataflow) Index(addr uint64) (int, bool) {
+	b, ok := d.CFG.Block(addr)
+	if !ok {
+		return 0, false
+	}
+	start, end := d.blockRange(b)
+	for i := start; i < end; i++ {
+		if uint64(d.Insns[i].Address) == addr {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// Definitions reaching instruction i, indices into Defs.
+func (d *Dataflow) Reaching(i int) []int {
+	var defs []int
+	for _, def := range d.reach[i].members() {
+		defs = append(defs, int(def))
+	}
+	return defs
+}
+
+// Definitions of reg, or of the full register containing it, reaching
+// instruction i: the use-def chain. None means the value is the one on
+// entry to the function.
+func (d *Dataflow) ReachingDefs(i int, reg uint) []int {
+	full, _, ok := fullReg(d.Insns[i], reg)
+	if !ok {
+		return nil
+	}
+	var defs []int
+	for _, def := range d.reach[i].members() {
+		if d.Defs[def].Reg == full {
+			defs = append(defs, int(def))
+		}
+	}
+	return defs
+}
+
+// The full register containing reg, for the arch of insn, and whether
+// writing reg overwrites all of it. Zero registers hold nothing.
+func fullReg(insn Instruction, reg uint) (full uint, kills, ok bool) {
+	if reg == 0 {
+		return 0, false, false
+	}
+	arch := insnArch(insn)
+	info, found := RegInfo(arch, reg)
+	if !found {
+		return reg, true, true
+	}
+	if arch == CS_ARCH_ARM64 && info.Full == ARM64_REG_XZR {
+		return 0, false, false
+	}
+	return info.Full, writeKills(arch, info), true
+}
+
+// Does a write to the register overwrite all of its full register? Writes
+// to x86 32-bit registers zero extend, as do all arm64 register writes.
+func writeKills(arch int, info RegisterInfo) bool {
+	switch {
+	case info.Offset != 0:
+		return false
+	case info.Width == regInfos[arch][info.Full].Width:
+		return true
+	case arch == CS_ARCH_X86:
+		return info.Class == RegGPR && info.Width == 32
+	case arch == CS_ARCH_ARM64:
+		return true
+	}
+	return false
+}
+
+// The arch of insn, from its details, or -1 without them
+func insnArch(insn Instruction) int {
+	switch {
+	case insn.X86 != nil:
+		return CS_ARCH_X86
+	case insn.Arm64 != nil:
+		return CS_ARCH_ARM64
+	case insn.Arm != nil:
+		return CS_ARCH_ARM
+	case insn.Mips != nil:
+		return CS_ARCH_MIPS
+	case insn.PPC != nil:
+		return CS_ARCH_PPC
+	case insn.Sparc != nil:
+		return CS_ARCH_SPARC
+	}
+	return -1
+}
+
+// Set of small non-negative integers
+type bitSet []uint64
+
+func (s *bitSet) add(v uint) {
+	for int(v/64) >= len(*s) {
+		*s = append(*s, 0)
+	}
+	(*s)[v/64] |= 1 << (v % 64)
+}
+
+func (s bitSet) remove(v uint) {
+	if int(v/64) < len(s) {
+		s[v/64] &^= 1 << (v % 64)
+	}
+}
+
+func (s bitSet) has(v uint) bool {
+	return int(v/64) < len(s) && s[v/64]&(1<<(v%64)) != 0
+}
+
+func (s *bitSet) union(o bitSet) {
+	for len(*s) < len(o) {
+		*s = append(*s, 0)
+	}
+	for i, w := range o {
+		(*s)[i] |= w
+	}
+}
+
+func (s bitSet) clone() bitSet {
+	return append(bitSet(nil), s...)
+}
+
+func (s bitSet) equal(o bitSet) bool {
+	if len(s) < len(o) {
+		s, o = o, s
+	}
+	for i, w := range s {
+		if i < len(o) && w != o[i] || i >= len(o) && w != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (s bitSet) members() []uint {
+	var vs []uint
+	for i, w := range s {
+		for w != 0 {
+			vs = append(vs, uint(i*64+bits.TrailingZeros64(w)))
+			w &= w - 1
+		}
+	}
+	return vs
+}
@@ -0,0 +1,101 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package gapstone
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func sortedRegs(regs ...uint) []uint {
+	slices.Sort(regs)
+	return regs
+}
+
+func TestDataflowX86(t *testing.T) {
+	engine := entryEngine(t, CS_ARCH_X86, CS_MODE_64)
+	defer engine.Close()
+
+	code := "\x89\xf8" + // mov eax, edi
+		"\x85\xf6" + // test esi, esi
+		"\x74\x03" + // je 0x1009
+		"\x66\x01\xd0" + // add ax, dx
+		"\xc3" // ret
+	insns, err := engine.Disasm([]byte(code), 0x1000, 0)
+	if err != nil {
+		t.Fatalf("Disassembly error: %v", err)
+	}
+	d := BuildCFG(insns).Dataflow()
+
+	// The write to eax kills rax, so only the arguments are live
+	live, ok := d.LiveAt(0x1000)
+	want := sortedRegs(X86_REG_RDI, X86_REG_RSI, X86_REG_RDX, X86_REG_RSP)
+	if !ok || !reflect.DeepEqual(live, want) {
+		t.Errorf("LiveAt(0x1000) = %v, want %v", live, want)
+	}
+	// add ax, dx reads ax and only writes part of rax
+	want = sortedRegs(X86_REG_RAX, X86_REG_RSI, X86_REG_RDX, X86_REG_RSP)
+	if live := d.LiveAfter(0); !reflect.DeepEqual(live, want) {
+		t.Errorf("LiveAfter(0) = %v, want %v", live, want)
+	}
+	want = sortedRegs(X86_REG_RAX, X86_REG_RDX, X86_REG_RSP)
+	if live := d.LiveIn(1); !reflect.DeepEqual(live, want) {
+		t.Errorf("LiveIn(1) = %v, want %v", live, want)
+	}
+	if live := d.LiveIn(2); !reflect.DeepEqual(live, []uint{X86_REG_RSP}) {
+		t.Errorf("LiveIn(2) = %v", live)
+	}
+	if _, ok := d.LiveAt(0x1001); ok {
+		t.Error("LiveAt(0x1001) found an instruction")
+	}
+
+	// Both the mov and the add reach the ret
+	var from []int
+	for _, def := range d.ReachingDefs(4, X86_REG_AL) {
+		from = append(from, d.Defs[def].Insn)
+	}
+	if !reflect.DeepEqual(from, []int{0, 3}) {
+		t.Errorf("rax defined at %v, want [0 3]", from)
+	}
+	if defs := d.ReachingDefs(0, X86_REG_EDI); len(defs) != 0 {
+		t.Errorf("edi defined at %v inside the function", defs)
+	}
+	for _, def := range d.Defs {
+		if def.Insn == 0 && def.Reg == X86_REG_RAX && !reflect.DeepEqual(def.Uses, []int{3}) {
+			t.Errorf("mov eax, edi used by %v, want [3]", def.Uses)
+		}
+	}
+}
+
+func TestDataflowArm64(t *testing.T) {
+	engine := entryEngine(t, CS_ARCH_ARM64, CS_MODE_ARM)
+	defer engine.Close()
+
+	code := "\xe0\x03\x01\x2a" + // mov w0, w1
+		"\x00\x00\x02\x8b" + // add x0, x0, x2
+		"\xc0\x03\x5f\xd6" // ret
+	insns, err := engine.Disasm([]byte(code), 0x1000, 0)
+	if err != nil {
+		t.Fatalf("Disassembly error: %v", err)
+	}
+	d := BuildCFG(insns).Dataflow()
+	live, _ := d.LiveAt(0x1000)
+	if !slices.Contains(live, ARM64_REG_X1) || !slices.Contains(live, ARM64_REG_X2) {
+		t.Errorf("x1 and x2 not live in %v", live)
+	}
+	if slices.Contains(live, ARM64_REG_X0) || slices.Contains(live, ARM64_REG_XZR) {
+		t.Errorf("x0 or xzr live in %v", live)
+	}
+	if defs := d.ReachingDefs(1, ARM64_REG_X0); len(defs) != 1 || d.Defs[defs[0]].Insn != 0 {
+		t.Errorf("x0 defined by %v", defs)
+	}
+}
@@ -0,0 +1,317 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package gapstone
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"slices"
+)
+
+// What a DiffEdit does
+type DiffOp int
+
+const (
+	DiffMatch  DiffOp = iota // Same normalized instruction on both sides
+	DiffChange               // Same mnemonic, other operands
+	DiffInsert               // Only in the new function
+	DiffDelete               // Only in the old function
+)
+
+func (op DiffOp) String() string {
+	switch op {
+	case DiffMatch:
+		return "match"
+	case DiffChange:
+		return "change"
+	case DiffInsert:
+		return "insert"
+	case DiffDelete:
+		return "delete"
+	}
+	return fmt.Sprintf("DiffOp(%d)", int(op))
+}
+
+// One step of an edit script turning the old function into the new one. Old
+// is nil for an insertion and New for a deletion.
+type DiffEdit struct {
+	Op  DiffOp
+	Old *Instruction
+	New *Instruction
+}
+
+// Align two disassembled functions, such as the same function from two
+// builds, comparing their instructions by Normalize(insn, flags) so moved
+// code and changed displacements don't show. Unaligned instructions with
+// the same mnemonic are paired up as changes. The script lists old and new
+// instructions each in their original order.
+func DiffInstructions(old, new []Instruction, flags NormalizeFlags) []DiffEdit {
+	var edits []DiffEdit
+	diffRun(&edits, old, new, flags)
+	return edits
+}
+
+// Like DiffInstructions, but align the basic blocks of the two functions
+// first, in address order, and only compare instructions between matching
+// blocks. This keeps a change from being smeared over similar code in other
+// blocks.
+func DiffCFG(old, new *CFG, flags NormalizeFlags) []DiffEdit {
+	oldKeys := make([]uint64, len(old.Blocks))
+	for i, b := range old.Blocks {
+		oldKeys[i] = blockHash(b, flags)
+	}
+	newKeys := make([]uint64, len(new.Blocks))
+	for i, b := range new.Blocks {
+		newKeys[i] = blockHash(b, flags)
+	}
+
+	var edits []DiffEdit
+	var oldGap, newGap []Instruction
+	for _, s := range myers(oldKeys, newKeys) {
+		switch s.op {
+		case DiffDelete:
+			oldGap = append(oldGap, old.Blocks[s.i].Instructions...)
+		case DiffInsert:
+			newGap = append(newGap, new.Blocks[s.j].Instructions...)
+		default:
+			diffRun(&edits, oldGap, newGap, flags)
+			oldGap, newGap = nil, nil
+			diffRun(&edits, old.Blocks[s.i].Instructions, new.Blocks[s.j].Instructions, flags)
+		}
+	}
+	diffRun(&edits, oldGap, newGap, flags)
+	return edits
+}
+
+// Append the edit script from old to new, pairing up the deletions and
+// insertions between two matches by mnemonic
+func diffRun(edits *[]DiffEdit, old, new []Instruction, flags NormalizeFlags) {
+	oldKeys := make([]uint64, len(old))
+	for i, insn := range old {
+		oldKeys[i] = hashString(Normalize(insn, flags))
+	}
+	newKeys := make([]uint64, len(new))
+	for i, insn := range new {
+		newKeys[i] = hashString(Normalize(insn, flags))
+	}
+
+	steps := myers(oldKeys, newKeys)
+	for k := 0; k < len(steps); {
+		if steps[k].op == DiffMatch {
+			s := steps[k]
+			*edits = append(*edits, DiffEdit{Op: DiffMatch, Old: &old[s.i], New: &new[s.j]})
+			k++
+			continue
+		}
+		var a, b []int
+		for ; k < len(steps) && steps[k].op != DiffMatch; k++ {
+			if steps[k].op == DiffDelete {
+				a = append(a, steps[k].i)
+			} else {
+				b = append(b, steps[k].j)
+			}
+		}
+		aKeys := make([]uint64, len(a))
+		for i, n := range a {
+			aKeys[i] = hashString(old[n].Mnemonic)
+		}
+		bKeys := make([]uint64, len(b))
+		for i, n := range b {
+			bKeys[i] = hashString(new[n].Mnemonic)
+		}
+		for _, s := range myers(aKeys, bKeys) {
+			e := DiffEdit{Op: s.op}
+			switch s.op {
+			case DiffMatch:
+				e.Op, e.Old, e.New = DiffChange, &old[a[s.i]], &new[b[s.j]]
+			case DiffDelete:
+				e.Old = &old[a[s.i]]
+			case DiffInsert:
+				e.New = &new[b[s.j]]
+			}
+			*edits = append(*edits, e)
+		}
+	}
+}
+
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
+
+// A step of a shortest edit script: DiffMatch, DiffDelete of a[i] or
+// DiffInsert of b[j]
+type diffStep struct {
+	op   DiffOp
+	i, j int
+}
+
+// Myers' O(ND) shortest edit script from a to b, deletions before
+// insertions
+func myers(a, b []uint64) []diffStep {
+	n, m := len(a), len(b)
+	off := n + m
+	v := make([]int, 2*off+2)
+	// trace[d] is v[-d:d+1] before round d, enough to walk back from it
+	var trace [][]int
+	for d := 0; d <= off; d++ {
+		trace = append(trace, slices.Clone(v[off-d:off+d+1]))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[off+k-1] < v[off+k+1] {
+				x = v[off+k+1]
+			} else {
+				x = v[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				return myersPath(trace, n, m)
+			}
+		}
+	}
+	return nil
+}
+
+func myersPath(trace [][]int, x, y int) []diffStep {
+	var steps []diffStep
+	for d := len(trace) - 1; d >= 0; d-- {
+		var px, py int
+		if d > 0 {
+			v := trace[d] // v[k] is at v[k+d]
+			k := x - y
+			pk := k - 1
+			if k == -d || k != d && v[k-1+d] < v[k+1+d] {
+				pk = k + 1
+			}
+			px = v[pk+d]
+			py = px - pk
+		}
+		for x > px && y > py {
+			x--
+			y--
+			steps = append(steps, diffStep{op: DiffMatch, i: x, j: y})
+		}
+		if d > 0 {
+			if x == px {
+				steps = append(steps, diffStep{op: DiffInsert, j: py})
+			} else {
+				steps = append(steps, diffStep{op: DiffDelete, i: px})
+			}
+		}
+		x, y = px, py
+	}
+	slices.Reverse(steps)
+	return steps
+}
+
+// Write edits as a unified diff of the disassembly, in hunks of changes
+// with up to context matching instructions around them. Lines show the
+// address and the instruction as disassembled, old side for matches:
+//
+//	@@ -0x1000,3 +0x2000,3 @@
+//	 0x1000: push rbp
+//	-0x1001: mov eax, 1
+//	+0x2001: mov eax, 2
+//	 0x1006: ret
+func WriteDiff(w io.Writer, edits []DiffEdit, context int) error {
+	for k := 0; k < len(edits); {
+		if edits[k].Op == DiffMatch {
+			k++
+			continue
+		}
+		start := max(k-context, 0)
+		end := k
+		for end < len(edits) {
+			if edits[end].Op != DiffMatch {
+				end++
+				continue
+			}
+			run := end
+			for run < len(edits) && edits[run].Op == DiffMatch {
+				run++
+			}
+			if run == len(edits) || run-end > 2*context {
+				end = min(end+context, run)
+				break
+			}
+			end = run
+		}
+		if err := writeHunk(w, edits, start, end); err != nil {
+			return err
+		}
+		k = end
+	}
+	return nil
+}
+
+func writeHunk(w io.Writer, edits []DiffEdit, start, end int) error {
+	oldAddr, oldN := diffSide(edits, start, end, func(e DiffEdit) *Instruction { return e.Old })
+	newAddr, newN := diffSide(edits, start, end, func(e DiffEdit) *Instruction { return e.New })
+	if _, err := fmt.Fprintf(w, "@@ -%#x,%d +%#x,%d @@\n", oldAddr, oldN, newAddr, newN); err != nil {
+		return err
+	}
+	for _, e := range edits[start:end] {
+		var err error
+		switch e.Op {
+		case DiffMatch:
+			err = writeDiffLine(w, ' ', e.Old)
+		case DiffDelete:
+			err = writeDiffLine(w, '-', e.Old)
+		case DiffInsert:
+			err = writeDiffLine(w, '+', e.New)
+		case DiffChange:
+			if err = writeDiffLine(w, '-', e.Old); err == nil {
+				err = writeDiffLine(w, '+', e.New)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Address of the first instruction of one side of the hunk and their
+// number. An empty side is placed after the instructions before it.
+func diffSide(edits []DiffEdit, start, end int, side func(DiffEdit) *Instruction) (addr uint64, n int) {
+	for _, e := range edits[start:end] {
+		if insn := side(e); insn != nil {
+			if n == 0 {
+				addr = uint64(insn.Address)
+			}
+			n++
+		}
+	}
+	if n == 0 {
+		for k := start - 1; k >= 0; k-- {
+			if insn := side(edits[k]); insn != nil {
+				return uint64(insn.Address + insn.Size), 0
+			}
+		}
+	}
+	return addr, n
+}
+
+func writeDiffLine(w io.Writer, prefix byte, insn *Instruction) error {
+	text := insn.Mnemonic
+	if insn.OpStr != "" {
+		text += " " + insn.OpStr
+	}
+	_, err := fmt.Fprintf(w, "%c%#x: %s\n", prefix, insn.Address, text)
+	return err
+}
@@ -0,0 +1,118 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package gapstone
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func diffOps(edits []DiffEdit) []DiffOp {
+	var ops []DiffOp
+	for _, e := range edits {
+		ops = append(ops, e.Op)
+	}
+	return ops
+}
+
+func TestDiffInstructions(t *testing.T) {
+	engine := entryEngine(t, CS_ARCH_X86, CS_MODE_64)
+	defer engine.Close()
+
+	old, err := engine.Disasm([]byte(
+		"\x55"+ // push rbp
+			"\x48\x89\xe5"+ // mov rbp, rsp
+			"\xb8\x01\x00\x00\x00"+ // mov eax, 1
+			"\x01\xf8"+ // add eax, edi
+			"\x5d"+ // pop rbp
+			"\xc3"), // ret
+		0x1000, 0)
+	if err != nil {
+		t.Fatalf("Disassembly error: %v", err)
+	}
+	new, err := engine.Disasm([]byte(
+		"\x55"+ // push rbp
+			"\xb8\x02\x00\x00\x00"+ // mov eax, 2
+			"\x01\xf0"+ // add eax, esi
+			"\x90"+ // nop
+			"\x5d"+ // pop rbp
+			"\xc3"), // ret
+		0x2000, 0)
+	if err != nil {
+		t.Fatalf("Disassembly error: %v", err)
+	}
+
+	edits := DiffInstructions(old, new, 0)
+	want := []DiffOp{DiffMatch, DiffDelete, DiffMatch, DiffChange, DiffInsert, DiffMatch, DiffMatch}
+	if ops := diffOps(edits); !reflect.DeepEqual(ops, want) {
+		t.Fatalf("ops = %v, want %v", ops, want)
+	}
+	if e := edits[3]; e.Old.Address != 0x1009 || e.New.Address != 0x2006 {
+		t.Errorf("change pairs 0x%x with 0x%x", e.Old.Address, e.New.Address)
+	}
+	if e := edits[4]; e.Old != nil || e.New.Mnemonic != "nop" {
+		t.Errorf("insert = %+v", e)
+	}
+
+	// add eax, edi and add eax, esi only differ by register
+	edits = DiffInstructions(old, new, NormalizeRegs)
+	if edits[3].Op != DiffMatch {
+		t.Errorf("NormalizeRegs: edits[3] is a %v", edits[3].Op)
+	}
+
+	var b strings.Builder
+	if err := WriteDiff(&b, DiffInstructions(old, new, 0), 1); err != nil {
+		t.Fatalf("WriteDiff failed: %v", err)
+	}
+	wantDiff := "@@ -0x1000,5 +0x2000,5 @@\n" +
+		" 0x1000: push rbp\n" +
+		"-0x1001: mov rbp, rsp\n" +
+		" 0x1004: mov eax, 1\n" +
+		"-0x1009: add eax, edi\n" +
+		"+0x2006: add eax, esi\n" +
+		"+0x2008: nop\n" +
+		" 0x100b: pop rbp\n"
+	if b.String() != wantDiff {
+		t.Errorf("got\n%s\nwant\n%s", b.String(), wantDiff)
+	}
+
+	b.Reset()
+	if err := WriteDiff(&b, DiffInstructions(old, new, 0), 0); err != nil {
+		t.Fatalf("WriteDiff failed: %v", err)
+	}
+	if !strings.HasPrefix(b.String(), "@@ -0x1001,1 +0x2001,0 @@\n-0x1001: mov rbp, rsp\n@@ -0x1009,1 +0x2006,2 @@\n") {
+		t.Errorf("no context:\n%s", b.String())
+	}
+}
+
+func TestDiffCFG(t *testing.T) {
+	engine := entryEngine(t, CS_ARCH_X86, CS_MODE_64)
+	defer engine.Close()
+
+	old, err := engine.Disasm([]byte(cfgCode), 0x1000, 0)
+	if err != nil {
+		t.Fatalf("Disassembly error: %v", err)
+	}
+	// Same function elsewhere, testing esi instead
+	new, err := engine.Disasm([]byte("\x85\xf6"+cfgCode[2:]), 0x2000, 0)
+	if err != nil {
+		t.Fatalf("Disassembly error: %v", err)
+	}
+	edits := DiffCFG(BuildCFG(old), BuildCFG(new), 0)
+	want := []DiffOp{DiffChange, DiffMatch, DiffMatch, DiffMatch, DiffMatch, DiffMatch}
+	if ops := diffOps(edits); !reflect.DeepEqual(ops, want) {
+		t.Errorf("ops = %v, want %v", ops, want)
+	}
+	if edits := DiffCFG(BuildCFG(old), BuildCFG(old), 0); len(edits) != len(old) {
+		t.Errorf("%d edits diffing with itself", len(edits))
+	}
+}
@@ -0,0 +1,66 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package elfdis
+
+import (
+	"sort"
+
+	"github.com/bpfsnoop/gapstone"
+)
+
+// An instruction together with what the ELF file knows about it.
+type Instruction struct {
+	gapstone.Instruction
+	Relocs []Reloc     // Relocations patching this instruction, by address
+	Source *SourceLine // From DWARF, nil without debug info
+	Jump   *JumpEntry  // The static key patching this instruction, see JumpTable
+}
+
+// Attach the relocations that land inside each instruction, matching each
+// one to the operand that holds the relocated field. When the field is the
+// target of a direct branch, OpStr is rewritten to name the target, so that
+// `call 0x28` in a kernel module reads `call printk`. With DWARF debug info
+// each instruction also gets its source line, see SourceLine, and static key
+// patch sites get their __jump_table entry. Both are optional: debug info or
+// a __jump_table that doesn't parse is left out, SourceLine and JumpTable
+// report why. Only failing to read the relocations is an error.
+func (f *File) Annotate(insns []gapstone.Instruction) ([]Instruction, error) {
+	relocs, err := f.Relocs()
+	if err != nil {
+		return nil, err
+	}
+	lines, err := f.lineTable()
+	if err != nil {
+		lines = &lineTable{}
+	}
+
+	out := make([]Instruction, len(insns))
+	for i, insn := range insns {
+		out[i].Instruction = insn
+		start, end := uint64(insn.Address), uint64(insn.Address+insn.Size)
+		j := sort.Search(len(relocs), func(j int) bool { return relocs[j].Addr >= start })
+		for ; j < len(relocs) && relocs[j].Addr < end; j++ {
+			r := relocs[j]
+			r.Operand = relocOperand(&insn, r.Addr-start)
+			out[i].Relocs = append(out[i].Relocs, r)
+			if name, ok := f.branchName(&insn, r); ok {
+				out[i].OpStr = replaceLastOperand(out[i].OpStr, name)
+			}
+		}
+		if sl, ok := lines.lookup(start); ok {
+			out[i].Source = &sl
+		}
+		if e, ok := f.JumpEntry(start); ok {
+			out[i].Jump = &e
+		}
+	}
+	return out, nil
+}
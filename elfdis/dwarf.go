@@ -0,0 +1,374 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package elfdis
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"debug/elf"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Where an instruction came from, according to DWARF.
+type SourceLine struct {
+	File     string // As recorded by the compiler, possibly relative
+	Line     int    // 0 for compiler generated code
+	Function string // Innermost function, which may have been inlined
+	// The functions Function was inlined into, innermost first. Each frame
+	// carries the call site of the frame before it.
+	Inlined []InlineFrame
+}
+
+// A function an inlined call was expanded into, with the file and line of
+// the call.
+type InlineFrame struct {
+	Function string
+	File     string
+	Line     int
+}
+
+type lineRow struct {
+	addr uint64
+	file string
+	line int
+	end  bool // End of sequence, addr is one past the last instruction
+}
+
+// A subprogram or inlined subroutine.
+type scope struct {
+	name     string
+	ranges   [][2]uint64
+	callFile string
+	callLine int
+	parent   int // Index into lineTable.scopes, -1 for subprograms
+}
+
+// Address range of a scope, flattened for lookup.
+type scopeRange struct {
+	lo, hi uint64
+	scope  int
+}
+
+type lineTable struct {
+	rows   []lineRow    // Sorted by address
+	scopes []scope      // Parents come before their children
+	ranges []scopeRange // Sorted by lo
+}
+
+// The DWARF source line of addr. For relocatable objects, kernel modules
+// included, the relocations of the debug sections are applied against the
+// File layout first; only the absolute ones are, which is enough for x86
+// and arm64 but not for the add and sub pairs RISC-V uses in .debug_line.
+func (f *File) SourceLine(addr uint64) (SourceLine, bool, error) {
+	t, err := f.lineTable()
+	if err != nil {
+		return SourceLine{}, false, err
+	}
+	sl, ok := t.lookup(addr)
+	return sl, ok, nil
+}
+
+// Parse the DWARF line tables and scopes on first use. A File without debug
+// info yields an empty table.
+func (f *File) lineTable() (*lineTable, error) {
+	if f.lines != nil || f.linesErr != nil {
+		return f.lines, f.linesErr
+	}
+	f.lines = &lineTable{}
+	if f.elf.Section(".debug_info") == nil {
+		return f.lines, nil
+	}
+
+	var d *dwarf.Data
+	var err error
+	if f.elf.Type == elf.ET_REL {
+		d, err = f.relocatedDWARF()
+	} else {
+		d, err = f.elf.DWARF()
+	}
+	if err == nil {
+		err = f.lines.load(d)
+	}
+	if err != nil {
+		f.lines, f.linesErr = nil, fmt.Errorf("DWARF: %w", err)
+	}
+	return f.lines, f.linesErr
+}
+
+// debug/elf relocates the debug sections of an ET_REL object with section
+// relative symbol values, so the addresses wouldn't match the File layout.
+// Do it here instead.
+func (f *File) relocatedDWARF() (*dwarf.Data, error) {
+	syms, err := f.elf.Symbols()
+	if err != nil {
+		return nil, err
+	}
+	sections := make(map[string][]byte)
+	for i, sec := range f.elf.Sections {
+		name, ok := strings.CutPrefix(sec.Name, ".debug_")
+		if !ok {
+			continue
+		}
+		data, err := sec.Data()
+		if err != nil {
+			return nil, fmt.Errorf("section %s: %w", sec.Name, err)
+		}
+		for _, rs := range f.elf.Sections {
+			if rs.Type != elf.SHT_RELA && rs.Type != elf.SHT_REL || int(rs.Info) != i {
+				continue
+			}
+			if err := f.applyRelocs(data, rs, syms); err != nil {
+				return nil, fmt.Errorf("section %s: %w", rs.Name, err)
+			}
+		}
+		sections[name] = data
+	}
+
+	d, err := dwarf.New(sections["abbrev"], sections["aranges"], sections["frame"],
+		sections["info"], sections["line"], sections["pubnames"], sections["ranges"], sections["str"])
+	if err != nil {
+		return nil, err
+	}
+	// DWARF 5 sections
+	for _, name := range []string{"addr", "line_str", "loclists", "rnglists", "str_offsets"} {
+		if data, ok := sections[name]; ok {
+			if err := d.AddSection(".debug_"+name, data); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return d, nil
+}
+
+func (t *lineTable) load(d *dwarf.Data) error {
+	r := d.Reader()
+	var files []*dwarf.LineFile
+	// Innermost enclosing scope of each open entry, -1 outside functions.
+	var stack []int
+
+	for {
+		e, err := r.Next()
+		if err != nil {
+			return err
+		}
+		if e == nil {
+			break
+		}
+		if e.Tag == 0 {
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+			continue
+		}
+
+		enclosing := -1
+		if len(stack) > 0 {
+			enclosing = stack[len(stack)-1]
+		}
+
+		switch e.Tag {
+		case dwarf.TagCompileUnit, dwarf.TagPartialUnit:
+			if files, err = t.loadRows(d, e); err != nil {
+				return err
+			}
+		case dwarf.TagSubprogram, dwarf.TagInlinedSubroutine:
+			ranges, err := d.Ranges(e)
+			if err != nil {
+				return err
+			}
+			if len(ranges) == 0 || (e.Tag == dwarf.TagInlinedSubroutine && enclosing < 0) {
+				break
+			}
+			s := scope{name: entryName(d, e, 0), ranges: ranges, parent: -1}
+			if e.Tag == dwarf.TagInlinedSubroutine {
+				s.parent = enclosing
+				if i, ok := e.Val(dwarf.AttrCallFile).(int64); ok && i >= 0 && int(i) < len(files) && files[i] != nil {
+					s.callFile = files[i].Name
+				}
+				if line, ok := e.Val(dwarf.AttrCallLine).(int64); ok {
+					s.callLine = int(line)
+				}
+			}
+			enclosing = len(t.scopes)
+			t.scopes = append(t.scopes, s)
+			for _, rg := range ranges {
+				t.ranges = append(t.ranges, scopeRange{rg[0], rg[1], enclosing})
+			}
+		}
+
+		if e.Children {
+			stack = append(stack, enclosing)
+		}
+	}
+
+	sort.SliceStable(t.rows, func(i, j int) bool {
+		if t.rows[i].addr != t.rows[j].addr {
+			return t.rows[i].addr < t.rows[j].addr
+		}
+		// A sequence ending where the next one starts must not hide it.
+		return t.rows[i].end && !t.rows[j].end
+	})
+	sort.SliceStable(t.ranges, func(i, j int) bool {
+		return t.ranges[i].lo < t.ranges[j].lo
+	})
+	return nil
+}
+
+// Append the line table rows of a compilation unit and return its file
+// table.
+func (t *lineTable) loadRows(d *dwarf.Data, cu *dwarf.Entry) ([]*dwarf.LineFile, error) {
+	lr, err := d.LineReader(cu)
+	if err != nil || lr == nil {
+		return nil, err
+	}
+	var le dwarf.LineEntry
+	for {
+		if err := lr.Next(&le); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		row := lineRow{addr: le.Address, line: le.Line, end: le.EndSequence}
+		if le.File != nil {
+			row.file = le.File.Name
+		}
+		t.rows = append(t.rows, row)
+	}
+	return lr.Files(), nil
+}
+
+// Name of a subprogram, following DW_AT_abstract_origin and
+// DW_AT_specification for inlined and out of line definitions.
+func entryName(d *dwarf.Data, e *dwarf.Entry, depth int) string {
+	if name, ok := e.Val(dwarf.AttrName).(string); ok {
+		return name
+	}
+	if depth > 4 {
+		return ""
+	}
+	for _, attr := range []dwarf.Attr{dwarf.AttrAbstractOrigin, dwarf.AttrSpecification} {
+		off, ok := e.Val(attr).(dwarf.Offset)
+		if !ok {
+			continue
+		}
+		r := d.Reader()
+		r.Seek(off)
+		if origin, err := r.Next(); err == nil && origin != nil {
+			return entryName(d, origin, depth+1)
+		}
+	}
+	return ""
+}
+
+func (t *lineTable) lookup(addr uint64) (SourceLine, bool) {
+	i := sort.Search(len(t.rows), func(i int) bool {
+		return t.rows[i].addr > addr
+	})
+	if i == 0 || t.rows[i-1].end {
+		return SourceLine{}, false
+	}
+	row := t.rows[i-1]
+	sl := SourceLine{File: row.file, Line: row.line}
+
+	// Find the innermost scope, ranges may nest or be split so check every
+	// range starting at or below addr. Children come after their parents.
+	inner := -1
+	j := sort.Search(len(t.ranges), func(j int) bool {
+		return t.ranges[j].lo > addr
+	})
+	for j--; j >= 0; j-- {
+		r := t.ranges[j]
+		if addr < r.hi && r.scope > inner {
+			inner = r.scope
+		}
+		if t.scopes[r.scope].parent < 0 && addr < r.hi {
+			// Reached the enclosing subprogram.
+			break
+		}
+	}
+	if inner < 0 {
+		return sl, true
+	}
+
+	s := &t.scopes[inner]
+	sl.Function = s.name
+	for s.parent >= 0 {
+		parent := &t.scopes[s.parent]
+		sl.Inlined = append(sl.Inlined, InlineFrame{parent.name, s.callFile, s.callLine})
+		s = parent
+	}
+	return sl, true
+}
+
+// Write an objdump -S style listing: whenever the function or source line
+// changes, a "function():" and "file:line" header are printed, followed by
+// the source text when readFile can fetch it. readFile defaults to
+// os.ReadFile. Relocations are listed below the instruction they patch.
+func WriteListing(w io.Writer, insns []Instruction, readFile func(name string) ([]byte, error)) error {
+	if readFile == nil {
+		readFile = os.ReadFile
+	}
+	sources := make(map[string][]string)
+	source := func(name string, line int) (string, bool) {
+		lines, ok := sources[name]
+		if !ok {
+			if data, err := readFile(name); err == nil {
+				lines = strings.Split(string(data), "\n")
+			}
+			sources[name] = lines
+		}
+		if line < 1 || line > len(lines) {
+			return "", false
+		}
+		return lines[line-1], true
+	}
+
+	var buf bytes.Buffer
+	var last *SourceLine
+	for _, insn := range insns {
+		if sl := insn.Source; sl != nil {
+			if last == nil || sl.Function != last.Function {
+				fmt.Fprintf(&buf, "\n%s():\n", sl.Function)
+			}
+			if last == nil || sl.File != last.File || sl.Line != last.Line || sl.Function != last.Function {
+				fmt.Fprintf(&buf, "%s:%d\n", sl.File, sl.Line)
+				for _, fr := range sl.Inlined {
+					fmt.Fprintf(&buf, " (inlined by) %s() at %s:%d\n", fr.Function, fr.File, fr.Line)
+				}
+				if text, ok := source(sl.File, sl.Line); ok {
+					fmt.Fprintf(&buf, "%s\n", text)
+				}
+			}
+			last = sl
+		}
+
+		hex := make([]string, len(insn.Bytes))
+		for i, b := range insn.Bytes {
+			hex[i] = fmt.Sprintf("%02x", b)
+		}
+		fmt.Fprintf(&buf, "%8x:\t%-20s\t%s\t%s\n", insn.Address, strings.Join(hex, " "), insn.Mnemonic, insn.OpStr)
+		for _, r := range insn.Relocs {
+			fmt.Fprintf(&buf, "\t\t\t%x: %s\n", r.Addr, r)
+		}
+
+		if buf.Len() > 4096 {
+			if _, err := buf.WriteTo(w); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
@@ -0,0 +1,185 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package elfdis
+
+import (
+	"bytes"
+	"debug/elf"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSourceLine(t *testing.T) {
+	f, err := Open("testdata/dwarf.elf")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	tests := []struct {
+		addr     uint64
+		line     int
+		function string
+		inlined  []InlineFrame
+	}{
+		{0x401000, 12, "load", []InlineFrame{{"scale", "dwarf.c", 17}}},
+		{0x401006, 12, "load", []InlineFrame{{"scale", "dwarf.c", 17}}},
+		{0x401009, 18, "scale", nil},
+		{0x40100b, 19, "scale", nil},
+		{0x40100c, 24, "_start", nil},
+		{0x40101d, 23, "_start", nil},
+	}
+	for _, tt := range tests {
+		sl, ok, err := f.SourceLine(tt.addr)
+		if err != nil || !ok {
+			t.Errorf("0x%x: no source line (%v)", tt.addr, err)
+			continue
+		}
+		if filepath.Base(sl.File) != "dwarf.c" || sl.Line != tt.line || sl.Function != tt.function {
+			t.Errorf("0x%x: want %s at dwarf.c:%d, got %s at %s:%d", tt.addr, tt.function, tt.line, sl.Function, sl.File, sl.Line)
+		}
+		if len(sl.Inlined) != len(tt.inlined) {
+			t.Errorf("0x%x: want inlined into %+v, got %+v", tt.addr, tt.inlined, sl.Inlined)
+			continue
+		}
+		for i, fr := range sl.Inlined {
+			fr.File = filepath.Base(fr.File)
+			if fr != tt.inlined[i] {
+				t.Errorf("0x%x: want inlined into %+v, got %+v", tt.addr, tt.inlined[i], fr)
+			}
+		}
+	}
+	if _, ok, _ := f.SourceLine(0x500000); ok {
+		t.Errorf("want no source line outside .text")
+	}
+}
+
+func TestSourceLineRelocatable(t *testing.T) {
+	f, err := Open("testdata/dwarf.o")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	// The DWARF addresses are relative to .text.scale and .text._start,
+	// which the File lays out one after the other
+	scale, err := f.LookupSymbol("scale")
+	if err != nil {
+		t.Fatalf("LookupSymbol failed: %v", err)
+	}
+	start, err := f.LookupSymbol("_start")
+	if err != nil {
+		t.Fatalf("LookupSymbol failed: %v", err)
+	}
+	tests := []struct {
+		addr     uint64
+		line     int
+		function string
+	}{
+		{scale.Addr, 12, "load"},
+		{scale.Addr + 9, 18, "scale"},
+		{start.Addr, 24, "_start"},
+		{start.Addr + 0x11, 23, "_start"},
+	}
+	for _, tt := range tests {
+		sl, ok, err := f.SourceLine(tt.addr)
+		if err != nil || !ok {
+			t.Errorf("0x%x: no source line (%v)", tt.addr, err)
+			continue
+		}
+		if filepath.Base(sl.File) != "dwarf.c" || sl.Line != tt.line || sl.Function != tt.function {
+			t.Errorf("0x%x: want %s at dwarf.c:%d, got %s at %s:%d", tt.addr, tt.function, tt.line, sl.Function, sl.File, sl.Line)
+		}
+	}
+}
+
+func TestAnnotateBadDWARF(t *testing.T) {
+	data, err := os.ReadFile("testdata/dwarf.o")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := elf.NewFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("elf.NewFile failed: %v", err)
+	}
+	// Zero the DWARF version of the first unit, after its length
+	data[e.Section(".debug_info").Offset+4] = 0
+	f, err := NewFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewFile failed: %v", err)
+	}
+	defer f.Close()
+
+	insns, err := f.DisasmSymbol("_start")
+	if err != nil {
+		t.Fatalf("DisasmSymbol failed: %v", err)
+	}
+	annotated, err := f.Annotate(insns)
+	if err != nil {
+		t.Fatalf("Annotate failed: %v", err)
+	}
+	relocs := 0
+	for _, insn := range annotated {
+		relocs += len(insn.Relocs)
+		if insn.Source != nil {
+			t.Errorf("0x%x: source line from broken DWARF", insn.Address)
+		}
+	}
+	if relocs == 0 {
+		t.Errorf("no relocations annotated")
+	}
+	if _, _, err := f.SourceLine(uint64(insns[0].Address)); err == nil {
+		t.Errorf("SourceLine accepted broken DWARF")
+	}
+}
+
+func TestWriteListing(t *testing.T) {
+	f, err := Open("testdata/dwarf.elf")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	insns, err := f.DisasmSymbol("scale")
+	if err != nil {
+		t.Fatalf("DisasmSymbol failed: %v", err)
+	}
+	annotated, err := f.Annotate(insns)
+	if err != nil {
+		t.Fatalf("Annotate failed: %v", err)
+	}
+	if annotated[0].Source == nil || annotated[0].Source.Function != "load" {
+		t.Fatalf("want the first instruction inlined from load, got %+v", annotated[0].Source)
+	}
+
+	var buf bytes.Buffer
+	readFile := func(name string) ([]byte, error) {
+		return os.ReadFile(filepath.Join("testdata", filepath.Base(name)))
+	}
+	if err := WriteListing(&buf, annotated, readFile); err != nil {
+		t.Fatalf("WriteListing failed: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"load():\n",
+		" (inlined by) scale() at ",
+		"\treturn sink * 3;\n",
+		"scale():\n",
+		"\treturn a + b;\n",
+		"  40100b:\tc3",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("listing lacks %q:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,346 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+// Package elfdis disassembles ELF executables, shared objects, relocatable
+// objects and kernel modules, picking the Engine arch and mode from the ELF
+// header.
+package elfdis
+
+import (
+	"debug/elf"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/bpfsnoop/gapstone"
+)
+
+var (
+	ErrNoSymbol = errors.New("symbol not found")
+	ErrMachine  = errors.New("unsupported ELF machine")
+)
+
+// A function or object symbol, with its address resolved against the layout
+// of the File.
+type Symbol struct {
+	Name    string
+	Addr    uint64
+	Size    uint64
+	Type    elf.SymType
+	Bind    elf.SymBind
+	Section elf.SectionIndex
+	Thumb   bool // ARM symbol with the Thumb bit set, cleared from Addr
+}
+
+// An ELF file opened for disassembly. Relocatable objects have all their
+// sections at address 0, so their SHF_ALLOC sections are laid out one after
+// the other starting from 0, the way a linker would place them.
+type File struct {
+	elf     *elf.File
+	closer  io.Closer
+	engine  gapstone.Engine
+	thumb   *gapstone.Engine
+	mem     gapstone.SegmentedMemory
+	bases   []uint64 // Load address of each section, by index
+	symbols []Symbol // Sorted by address
+	byName  map[string]Symbol
+
+	relocs   []Reloc // Loaded on first use
+	relocErr error
+	lines    *lineTable // Loaded on first use
+	linesErr error
+	jumps    []JumpEntry // Loaded on first use
+	jumpsErr error
+}
+
+// Open the named ELF file for disassembly.
+func Open(name string) (*File, error) {
+	fd, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := NewFile(fd)
+	if err != nil {
+		fd.Close()
+		return nil, err
+	}
+	f.closer = fd
+	return f, nil
+}
+
+// Create a File from an ELF image. The Engine is created with CS_OPT_DETAIL
+// turned on.
+func NewFile(r io.ReaderAt) (*File, error) {
+	ef, err := elf.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+
+	arch, mode, err := ArchMode(&ef.FileHeader)
+	if err != nil {
+		return nil, err
+	}
+	engine, err := gapstone.New(arch, mode)
+	if err != nil {
+		return nil, err
+	}
+	if err := engine.SetOption(gapstone.CS_OPT_DETAIL, gapstone.CS_OPT_ON); err != nil {
+		engine.Close()
+		return nil, err
+	}
+
+	f := &File{elf: ef, engine: engine}
+	f.layout()
+	f.loadSymbols()
+	return f, nil
+}
+
+// Pick the Engine arch and mode for an ELF header.
+func ArchMode(h *elf.FileHeader) (arch, mode int, err error) {
+	if h.Data == elf.ELFDATA2MSB {
+		mode = gapstone.CS_MODE_BIG_ENDIAN
+	}
+
+	switch h.Machine {
+	case elf.EM_X86_64:
+		return gapstone.CS_ARCH_X86, gapstone.CS_MODE_64, nil
+	case elf.EM_386:
+		return gapstone.CS_ARCH_X86, gapstone.CS_MODE_32, nil
+	case elf.EM_AARCH64:
+		return gapstone.CS_ARCH_ARM64, mode, nil
+	case elf.EM_ARM:
+		return gapstone.CS_ARCH_ARM, mode | gapstone.CS_MODE_ARM, nil
+	case elf.EM_MIPS:
+		if h.Class == elf.ELFCLASS64 {
+			return gapstone.CS_ARCH_MIPS, mode | gapstone.CS_MODE_MIPS64, nil
+		}
+		return gapstone.CS_ARCH_MIPS, mode | gapstone.CS_MODE_MIPS32, nil
+	case elf.EM_PPC64:
+		return gapstone.CS_ARCH_PPC, mode | gapstone.CS_MODE_64, nil
+	case elf.EM_PPC:
+		return gapstone.CS_ARCH_PPC, mode | gapstone.CS_MODE_32, nil
+	case elf.EM_S390:
+		return gapstone.CS_ARCH_SYSZ, gapstone.CS_MODE_BIG_ENDIAN, nil
+	case elf.EM_SPARC, elf.EM_SPARC32PLUS:
+		return gapstone.CS_ARCH_SPARC, gapstone.CS_MODE_BIG_ENDIAN, nil
+	case elf.EM_SPARCV9:
+		return gapstone.CS_ARCH_SPARC, gapstone.CS_MODE_BIG_ENDIAN | gapstone.CS_MODE_V9, nil
+	case elf.EM_RISCV:
+		// Linux distributions all assume RVC, and decoding compressed
+		// instructions costs nothing when there are none.
+		if h.Class == elf.ELFCLASS64 {
+			return gapstone.CS_ARCH_RISCV, gapstone.CS_MODE_RISCV64 | gapstone.CS_MODE_RISCVC, nil
+		}
+		return gapstone.CS_ARCH_RISCV, gapstone.CS_MODE_RISCV32 | gapstone.CS_MODE_RISCVC, nil
+	}
+	return 0, 0, fmt.Errorf("%w: %v", ErrMachine, h.Machine)
+}
+
+// Assign every section its load address and map the SHF_ALLOC ones.
+func (f *File) layout() {
+	f.bases = make([]uint64, len(f.elf.Sections))
+	var next uint64
+	for i, sec := range f.elf.Sections {
+		if sec.Flags&elf.SHF_ALLOC == 0 {
+			continue
+		}
+
+		base := sec.Addr
+		if f.elf.Type == elf.ET_REL {
+			if align := sec.Addralign; align > 1 {
+				next = (next + align - 1) &^ (align - 1)
+			}
+			base = next
+			next += sec.Size
+		}
+		f.bases[i] = base
+
+		if sec.Type == elf.SHT_NOBITS || sec.Size == 0 {
+			continue
+		}
+		perm := gapstone.PermRead
+		if sec.Flags&elf.SHF_WRITE != 0 {
+			perm |= gapstone.PermWrite
+		}
+		if sec.Flags&elf.SHF_EXECINSTR != 0 {
+			perm |= gapstone.PermExec
+		}
+		region := gapstone.Region{Start: base, Size: sec.Size, Perm: perm, Name: sec.Name}
+		// A section overlapping one mapped earlier can't be represented,
+		// first come first served.
+		f.mem.Map(gapstone.NewReaderAtMemory(sec.ReaderAt, 0, region))
+	}
+}
+
+// Collect the defined symbols of .symtab and .dynsym.
+func (f *File) loadSymbols() {
+	type key struct {
+		name string
+		addr uint64
+	}
+	seen := make(map[key]bool)
+	f.byName = make(map[string]Symbol)
+
+	symtab, _ := f.elf.Symbols()
+	dynsym, _ := f.elf.DynamicSymbols()
+	for _, s := range append(symtab, dynsym...) {
+		typ := elf.ST_TYPE(s.Info)
+		if s.Name == "" || typ == elf.STT_SECTION || typ == elf.STT_FILE {
+			continue
+		}
+		addr, ok := f.symbolAddr(s)
+		if !ok {
+			continue
+		}
+
+		sym := Symbol{
+			Name:    s.Name,
+			Addr:    addr,
+			Size:    s.Size,
+			Type:    typ,
+			Bind:    elf.ST_BIND(s.Info),
+			Section: s.Section,
+		}
+		if f.elf.Machine == elf.EM_ARM && typ == elf.STT_FUNC && sym.Addr&1 != 0 {
+			sym.Addr &^= 1
+			sym.Thumb = true
+		}
+
+		k := key{sym.Name, sym.Addr}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		f.symbols = append(f.symbols, sym)
+		if _, ok := f.byName[sym.Name]; !ok {
+			f.byName[sym.Name] = sym
+		}
+	}
+
+	sort.SliceStable(f.symbols, func(i, j int) bool {
+		return f.symbols[i].Addr < f.symbols[j].Addr
+	})
+}
+
+// Resolve the address of an ELF symbol against the File layout.
+func (f *File) symbolAddr(s elf.Symbol) (uint64, bool) {
+	switch {
+	case s.Section == elf.SHN_UNDEF || s.Section == elf.SHN_COMMON:
+		return 0, false
+	case s.Section == elf.SHN_ABS:
+		return s.Value, true
+	case int(s.Section) >= len(f.bases):
+		return 0, false
+	case f.elf.Type == elf.ET_REL:
+		return f.bases[s.Section] + s.Value, true
+	}
+	return s.Value, true
+}
+
+// Close the Engine and, for a File from Open, the underlying file.
+func (f *File) Close() error {
+	var err error
+	if cerr := f.engine.Close(); cerr != gapstone.ErrOK {
+		err = cerr
+	}
+	if f.thumb != nil {
+		f.thumb.Close()
+	}
+	if f.closer != nil {
+		if cerr := f.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// The parsed ELF file
+func (f *File) ELF() *elf.File { return f.elf }
+
+// The Engine matching the ELF machine. For ARM this is the ARM mode Engine,
+// Thumb symbols are handled by DisasmSymbol.
+func (f *File) Engine() *gapstone.Engine { return &f.engine }
+
+// Every SHF_ALLOC section with contents, at its load address. Region names
+// are the section names.
+func (f *File) Memory() gapstone.Memory { return &f.mem }
+
+// Load address of a section, which differs from Section.Addr for
+// relocatable objects.
+func (f *File) SectionAddr(i elf.SectionIndex) uint64 {
+	if int(i) >= len(f.bases) {
+		return 0
+	}
+	return f.bases[i]
+}
+
+// Defined symbols from .symtab and .dynsym, sorted by address.
+func (f *File) Symbols() []Symbol { return f.symbols }
+
+// Find a symbol by name, preferring .symtab over .dynsym.
+func (f *File) LookupSymbol(name string) (Symbol, error) {
+	if s, ok := f.byName[name]; ok {
+		return s, nil
+	}
+	return Symbol{}, fmt.Errorf("%w: %s", ErrNoSymbol, name)
+}
+
+// Map an address back to the function or object symbol covering it, which
+// makes a File a gapstone.Symbolizer.
+func (f *File) Lookup(addr uint64) (string, uint64, bool) {
+	s, off, ok := f.symbolContaining(addr)
+	return s.Name, off, ok
+}
+
+// Disassemble the function called name, using its symbol size.
+func (f *File) DisasmSymbol(name string) ([]gapstone.Instruction, error) {
+	sym, err := f.LookupSymbol(name)
+	if err != nil {
+		return nil, err
+	}
+	if sym.Size == 0 {
+		return nil, fmt.Errorf("symbol %s has no size", name)
+	}
+
+	engine := &f.engine
+	if sym.Thumb {
+		if engine, err = f.thumbEngine(); err != nil {
+			return nil, err
+		}
+	}
+	return engine.DisasmRange(&f.mem, sym.Addr, sym.Addr+sym.Size)
+}
+
+// Disassemble size bytes at addr.
+func (f *File) DisasmRange(addr, size uint64) ([]gapstone.Instruction, error) {
+	return f.engine.DisasmRange(&f.mem, addr, addr+size)
+}
+
+func (f *File) thumbEngine() (*gapstone.Engine, error) {
+	if f.thumb != nil {
+		return f.thumb, nil
+	}
+	mode := gapstone.CS_MODE_THUMB
+	if f.elf.Data == elf.ELFDATA2MSB {
+		mode |= gapstone.CS_MODE_BIG_ENDIAN
+	}
+	engine, err := gapstone.New(gapstone.CS_ARCH_ARM, mode)
+	if err != nil {
+		return nil, err
+	}
+	if err := engine.SetOption(gapstone.CS_OPT_DETAIL, gapstone.CS_OPT_ON); err != nil {
+		engine.Close()
+		return nil, err
+	}
+	f.thumb = &engine
+	return f.thumb, nil
+}
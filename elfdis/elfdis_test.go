@@ -0,0 +1,98 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package elfdis
+
+import (
+	"debug/elf"
+	"errors"
+	"testing"
+
+	"github.com/bpfsnoop/gapstone"
+)
+
+func TestArchMode(t *testing.T) {
+	tests := []struct {
+		h    elf.FileHeader
+		arch int
+		mode int
+	}{
+		{elf.FileHeader{Machine: elf.EM_X86_64, Class: elf.ELFCLASS64, Data: elf.ELFDATA2LSB}, gapstone.CS_ARCH_X86, gapstone.CS_MODE_64},
+		{elf.FileHeader{Machine: elf.EM_AARCH64, Class: elf.ELFCLASS64, Data: elf.ELFDATA2LSB}, gapstone.CS_ARCH_ARM64, gapstone.CS_MODE_LITTLE_ENDIAN},
+		{elf.FileHeader{Machine: elf.EM_ARM, Class: elf.ELFCLASS32, Data: elf.ELFDATA2LSB}, gapstone.CS_ARCH_ARM, gapstone.CS_MODE_ARM},
+		{elf.FileHeader{Machine: elf.EM_MIPS, Class: elf.ELFCLASS64, Data: elf.ELFDATA2MSB}, gapstone.CS_ARCH_MIPS, gapstone.CS_MODE_MIPS64 | gapstone.CS_MODE_BIG_ENDIAN},
+		{elf.FileHeader{Machine: elf.EM_PPC64, Class: elf.ELFCLASS64, Data: elf.ELFDATA2LSB}, gapstone.CS_ARCH_PPC, gapstone.CS_MODE_64},
+		{elf.FileHeader{Machine: elf.EM_S390, Class: elf.ELFCLASS64, Data: elf.ELFDATA2MSB}, gapstone.CS_ARCH_SYSZ, gapstone.CS_MODE_BIG_ENDIAN},
+		{elf.FileHeader{Machine: elf.EM_SPARCV9, Class: elf.ELFCLASS64, Data: elf.ELFDATA2MSB}, gapstone.CS_ARCH_SPARC, gapstone.CS_MODE_BIG_ENDIAN | gapstone.CS_MODE_V9},
+		{elf.FileHeader{Machine: elf.EM_RISCV, Class: elf.ELFCLASS64, Data: elf.ELFDATA2LSB}, gapstone.CS_ARCH_RISCV, gapstone.CS_MODE_RISCV64 | gapstone.CS_MODE_RISCVC},
+	}
+
+	for _, tt := range tests {
+		arch, mode, err := ArchMode(&tt.h)
+		if err != nil {
+			t.Errorf("%v: %v", tt.h.Machine, err)
+			continue
+		}
+		if arch != tt.arch || mode != tt.mode {
+			t.Errorf("%v: want %d/0x%x, got %d/0x%x", tt.h.Machine, tt.arch, tt.mode, arch, mode)
+		}
+	}
+
+	if _, _, err := ArchMode(&elf.FileHeader{Machine: elf.EM_VAX}); !errors.Is(err, ErrMachine) {
+		t.Errorf("want ErrMachine, got %v", err)
+	}
+}
+
+func TestDisasmSymbol(t *testing.T) {
+	f, err := Open("testdata/x86_64.elf")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	insns, err := f.DisasmSymbol("_start")
+	if err != nil {
+		t.Fatalf("DisasmSymbol failed: %v", err)
+	}
+	if len(insns) != 5 {
+		t.Fatalf("want 5 instructions, got %d", len(insns))
+	}
+	call := insns[2]
+	if call.Address != 0x40100f || call.Mnemonic != "call" {
+		t.Errorf("want call at 0x40100f, got %s at 0x%x", call.Mnemonic, call.Address)
+	}
+	if flow := call.Flow(); flow.Target != 0x401000 {
+		t.Errorf("want call target 0x401000, got 0x%x", flow.Target)
+	}
+
+	add, err := f.LookupSymbol("add")
+	if err != nil {
+		t.Fatalf("LookupSymbol failed: %v", err)
+	}
+	insns, err = f.DisasmRange(add.Addr, add.Size)
+	if err != nil || len(insns) != 2 || insns[1].Mnemonic != "ret" {
+		t.Errorf("DisasmRange: want lea; ret, got %v (%v)", insns, err)
+	}
+
+	if name, off, ok := f.Lookup(0x401010); !ok || name != "_start" || off != 0xc {
+		t.Errorf("Lookup: want _start+0xc, got %s+0x%x (%v)", name, off, ok)
+	}
+	if s := gapstone.Symbolize(call, f); s != "add" {
+		t.Errorf("Symbolize: want add, got %s", s)
+	}
+
+	if _, err := f.DisasmSymbol("missing"); !errors.Is(err, ErrNoSymbol) {
+		t.Errorf("want ErrNoSymbol, got %v", err)
+	}
+
+	if r, ok := gapstone.FindRegion(f.Memory(), 0x401000); !ok || r.Name != ".text" || r.Perm.String() != "r-x" {
+		t.Errorf("want .text r-x at 0x401000, got %+v", r)
+	}
+}
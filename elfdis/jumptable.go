@@ -0,0 +1,203 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package elfdis
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/bpfsnoop/gapstone"
+)
+
+var ErrJumpTable = errors.New("malformed __jump_table")
+
+// A static key (jump label) patch site from __jump_table. The kernel
+// rewrites the instruction at Code between a nop and a jmp to Target when
+// the key is toggled, so the bytes in the file are only one of the two.
+type JumpEntry struct {
+	Code    uint64
+	Target  uint64
+	Key     uint64 // The struct static_key, without the flag bits
+	KeyName string // Symbol of Key, empty when unknown
+	Branch  bool   // JUMP_TYPE_TRUE, set by static_branch_likely() and friends
+}
+
+// Whether the site jumps to Target for the key's state: the kernel patches
+// in the jmp when enabled differs from Branch.
+func (e JumpEntry) Jumps(enabled bool) bool { return enabled != e.Branch }
+
+// Key flag bits, JUMP_TYPE_TRUE and JUMP_TYPE_LINKED
+const jumpTypeMask = 3
+
+// The entries of __jump_table, in the relative format of
+// CONFIG_HAVE_ARCH_JUMP_LABEL_RELATIVE: 32 bit offsets to the code and
+// target, then a pointer sized offset to the key, each relative to the
+// field itself. Relocations are applied for relocatable objects and kernel
+// modules. Sorted by Code, empty without a __jump_table.
+func (f *File) JumpTable() ([]JumpEntry, error) {
+	if f.jumps != nil || f.jumpsErr != nil {
+		return f.jumps, f.jumpsErr
+	}
+	f.jumps, f.jumpsErr = f.loadJumpTable()
+	if f.jumps == nil && f.jumpsErr == nil {
+		f.jumps = []JumpEntry{}
+	}
+	return f.jumps, f.jumpsErr
+}
+
+func (f *File) loadJumpTable() ([]JumpEntry, error) {
+	var sec *elf.Section
+	var index int
+	for i, s := range f.elf.Sections {
+		if s.Name == "__jump_table" && s.Flags&elf.SHF_ALLOC != 0 {
+			sec, index = s, i
+			break
+		}
+	}
+	if sec == nil {
+		return nil, nil
+	}
+
+	ptrSize := 4
+	if f.elf.Class == elf.ELFCLASS64 {
+		ptrSize = 8
+	}
+	size := 8 + ptrSize
+	data, err := sec.Data()
+	if err != nil {
+		return nil, fmt.Errorf("section %s: %w", sec.Name, err)
+	}
+	if len(data)%size != 0 {
+		return nil, fmt.Errorf("%w: %d bytes is not a whole number of %d byte entries", ErrJumpTable, len(data), size)
+	}
+	relocs, err := f.Relocs()
+	if err != nil {
+		return nil, err
+	}
+
+	order := f.elf.ByteOrder
+	base := f.bases[index]
+	// The address a field at off refers to
+	field := func(off, n int) (uint64, string) {
+		addr := base + uint64(off)
+		i := sort.Search(len(relocs), func(i int) bool { return relocs[i].Addr >= addr })
+		if i < len(relocs) && relocs[i].Addr == addr {
+			r := relocs[i]
+			if !r.defined {
+				return 0, r.Symbol
+			}
+			return uint64(int64(r.symAddr) + r.Addend), ""
+		}
+		if n == 4 {
+			return addr + uint64(int64(int32(order.Uint32(data[off:])))), ""
+		}
+		return addr + order.Uint64(data[off:]), ""
+	}
+
+	entries := make([]JumpEntry, 0, len(data)/size)
+	for off := 0; off < len(data); off += size {
+		var e JumpEntry
+		e.Code, _ = field(off, 4)
+		e.Target, _ = field(off+4, 4)
+		key, undef := field(off+8, ptrSize)
+		if ptrSize == 4 {
+			key = uint64(uint32(key))
+		}
+		e.Branch = key&1 != 0
+		e.Key = key &^ jumpTypeMask
+		switch {
+		case undef != "":
+			// A key defined elsewhere, such as vmlinux for a module
+			e.Key, e.KeyName = 0, undef
+		case e.Key != 0:
+			if s, off, ok := f.symbolContaining(e.Key); ok {
+				e.KeyName = symOffset(s.Name, int64(off))
+			}
+		}
+		entries = append(entries, e)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Code < entries[j].Code
+	})
+	return entries, nil
+}
+
+// The jump table entry patching the instruction at addr.
+func (f *File) JumpEntry(addr uint64) (JumpEntry, bool) {
+	entries, err := f.JumpTable()
+	if err != nil {
+		return JumpEntry{}, false
+	}
+	i := sort.Search(len(entries), func(i int) bool { return entries[i].Code >= addr })
+	if i < len(entries) && entries[i].Code == addr {
+		return entries[i], true
+	}
+	return JumpEntry{}, false
+}
+
+// Encodings of the two states of a patch site
+var (
+	x86Nop2   = []byte{0x66, 0x90}
+	x86Nop5   = []byte{0x0f, 0x1f, 0x44, 0x00, 0x00}
+	arm64Nop  = uint32(0xd503201f)
+	arm64B    = uint32(0x14000000)
+	arm64BImm = uint32(0x03ffffff)
+)
+
+// Disassemble both states of the patch site of e, whichever of the two is
+// in the file: the nop, and the jmp (or b) to e.Target. The site size, 2 or
+// 5 bytes on x86, is that of the instruction in the file.
+func (f *File) JumpVariants(e JumpEntry) (nop, jmp gapstone.Instruction, err error) {
+	var nopCode, jmpCode []byte
+	switch f.elf.Machine {
+	case elf.EM_X86_64, elf.EM_386:
+		insns, err := f.engine.DisasmRange(&f.mem, e.Code, e.Code+1)
+		if len(insns) == 0 {
+			return nop, jmp, fmt.Errorf("patch site 0x%x: %w", e.Code, err)
+		}
+		rel := int64(e.Target) - int64(e.Code+uint64(insns[0].Size))
+		switch insns[0].Size {
+		case 2:
+			if rel != int64(int8(rel)) {
+				return nop, jmp, fmt.Errorf("%w: target 0x%x out of range of the 2 byte site at 0x%x", ErrJumpTable, e.Target, e.Code)
+			}
+			nopCode, jmpCode = x86Nop2, []byte{0xeb, byte(rel)}
+		case 5:
+			nopCode = x86Nop5
+			jmpCode = binary.LittleEndian.AppendUint32([]byte{0xe9}, uint32(rel))
+		default:
+			return nop, jmp, fmt.Errorf("%w: %d byte patch site at 0x%x", ErrJumpTable, insns[0].Size, e.Code)
+		}
+	case elf.EM_AARCH64:
+		// Instructions are little endian even on big endian kernels
+		rel := uint32((int64(e.Target)-int64(e.Code))/4) & arm64BImm
+		nopCode = binary.LittleEndian.AppendUint32(nil, arm64Nop)
+		jmpCode = binary.LittleEndian.AppendUint32(nil, arm64B|rel)
+	default:
+		return nop, jmp, fmt.Errorf("%w: %v", ErrMachine, f.elf.Machine)
+	}
+
+	for _, v := range []struct {
+		code []byte
+		insn *gapstone.Instruction
+	}{{nopCode, &nop}, {jmpCode, &jmp}} {
+		insns, err := f.engine.Disasm(v.code, e.Code, 1)
+		if err != nil {
+			return nop, jmp, err
+		}
+		*v.insn = insns[0]
+	}
+	return nop, jmp, nil
+}
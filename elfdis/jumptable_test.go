@@ -0,0 +1,114 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package elfdis
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestJumpTable(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		want []JumpEntry
+	}{
+		{"testdata/jump.elf", []JumpEntry{
+			{Code: 0x401000, Target: 0x401007, Key: 0x402040, KeyName: "key_off"},
+			{Code: 0x401011, Target: 0x401014, Key: 0x402000, KeyName: "key_on", Branch: true},
+		}},
+		// Through the relocations, with .data at 0x30 and .bss at 0x40
+		{"testdata/jump.o", []JumpEntry{
+			{Code: 0x0, Target: 0x7, Key: 0x50, KeyName: "key_off"},
+			{Code: 0x11, Target: 0x14, Key: 0x30, KeyName: "key_on", Branch: true},
+		}},
+	} {
+		f, err := Open(tt.name)
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		defer f.Close()
+
+		entries, err := f.JumpTable()
+		if err != nil {
+			t.Fatalf("%s: JumpTable failed: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(entries, tt.want) {
+			t.Errorf("%s:\n got %+v\nwant %+v", tt.name, entries, tt.want)
+		}
+	}
+}
+
+func TestJumpAnnotate(t *testing.T) {
+	f, err := Open("testdata/jump.elf")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	insns, err := f.DisasmSymbol("work")
+	if err != nil {
+		t.Fatalf("DisasmSymbol failed: %v", err)
+	}
+	annotated, err := f.Annotate(insns)
+	if err != nil {
+		t.Fatalf("Annotate failed: %v", err)
+	}
+	sites := 0
+	for _, insn := range annotated {
+		if insn.Jump == nil {
+			continue
+		}
+		sites++
+		if uint64(insn.Address) != insn.Jump.Code {
+			t.Errorf("0x%x: annotated with the entry for 0x%x", insn.Address, insn.Jump.Code)
+		}
+	}
+	if sites != 2 {
+		t.Errorf("want 2 patch sites, got %d", sites)
+	}
+}
+
+func TestJumpVariants(t *testing.T) {
+	f, err := Open("testdata/jump.elf")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	for _, tt := range []struct {
+		addr   uint64
+		size   uint
+		jmp    string
+		enable bool // Key state that patches in the jmp
+	}{
+		{0x401000, 5, "0x401007", true},  // nop in the file
+		{0x401011, 2, "0x401014", false}, // jmp in the file
+	} {
+		e, ok := f.JumpEntry(tt.addr)
+		if !ok {
+			t.Fatalf("no entry for 0x%x", tt.addr)
+		}
+		if !e.Jumps(tt.enable) || e.Jumps(!tt.enable) {
+			t.Errorf("0x%x: want the jmp only for Jumps(%v)", tt.addr, tt.enable)
+		}
+
+		nop, jmp, err := f.JumpVariants(e)
+		if err != nil {
+			t.Fatalf("0x%x: JumpVariants failed: %v", tt.addr, err)
+		}
+		if nop.Mnemonic != "nop" || nop.Size != tt.size || uint64(nop.Address) != tt.addr {
+			t.Errorf("0x%x: nop variant is %d byte %s %s", tt.addr, nop.Size, nop.Mnemonic, nop.OpStr)
+		}
+		if jmp.Mnemonic != "jmp" || jmp.OpStr != tt.jmp || jmp.Size != tt.size {
+			t.Errorf("0x%x: jmp variant is %d byte %s %s", tt.addr, jmp.Size, jmp.Mnemonic, jmp.OpStr)
+		}
+	}
+}
@@ -0,0 +1,467 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package elfdis
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bpfsnoop/gapstone"
+)
+
+// A pending relocation, as found in the SHT_RELA / SHT_REL sections.
+type Reloc struct {
+	Addr     uint64 // Address of the relocated field, in the File layout
+	Type     uint32 // Machine specific R_* type
+	TypeName string // eg. "R_X86_64_PLT32"
+	Symbol   string // Symbol name, or the section name for section symbols
+	Addend   int64  // Explicit addend, always 0 for SHT_REL
+	Operand  int    // Operand holding the field, -1 if unknown. Set by Annotate
+	section  bool
+	symAddr  uint64
+	defined  bool
+}
+
+func (r Reloc) String() string {
+	return fmt.Sprintf("%s %s", r.TypeName, symOffset(r.Symbol, r.Addend))
+}
+
+// Render name+0x10 / name-0x4 / name
+func symOffset(name string, off int64) string {
+	switch {
+	case off > 0:
+		return fmt.Sprintf("%s+0x%x", name, off)
+	case off < 0:
+		return fmt.Sprintf("%s-0x%x", name, -off)
+	}
+	return name
+}
+
+// Every relocation against an SHF_ALLOC section, sorted by address. Only
+// relocatable objects and kernel modules are expected to have any.
+func (f *File) Relocs() ([]Reloc, error) {
+	if f.relocs != nil || f.relocErr != nil {
+		return f.relocs, f.relocErr
+	}
+	f.relocs, f.relocErr = f.loadRelocs()
+	if f.relocs == nil && f.relocErr == nil {
+		f.relocs = []Reloc{}
+	}
+	return f.relocs, f.relocErr
+}
+
+func (f *File) loadRelocs() ([]Reloc, error) {
+	// sh_info is the section relocated, for ET_REL always and otherwise
+	// when it isn't 0, as .rela.dyn covers the whole image. Only SHF_ALLOC
+	// targets count: vmlinux linked with --emit-relocs relocates its debug
+	// sections too.
+	var secs []*elf.Section
+	for _, sec := range f.elf.Sections {
+		if sec.Type != elf.SHT_RELA && sec.Type != elf.SHT_REL {
+			continue
+		}
+		if sec.Info != 0 || f.elf.Type == elf.ET_REL {
+			if int(sec.Info) >= len(f.elf.Sections) ||
+				f.elf.Sections[sec.Info].Flags&elf.SHF_ALLOC == 0 {
+				continue
+			}
+		}
+		secs = append(secs, sec)
+	}
+	if len(secs) == 0 {
+		return nil, nil
+	}
+
+	symtab, err := f.elf.Symbols()
+	if err != nil && err != elf.ErrNoSymbols {
+		return nil, err
+	}
+	dynsym, err := f.elf.DynamicSymbols()
+	if err != nil && err != elf.ErrNoSymbols {
+		return nil, err
+	}
+
+	var relocs []Reloc
+	for _, sec := range secs {
+		// For ET_REL offsets are relative to the target section, otherwise
+		// they are plain addresses.
+		var base uint64
+		if f.elf.Type == elf.ET_REL {
+			base = f.bases[sec.Info]
+		}
+		syms := symtab
+		if int(sec.Link) < len(f.elf.Sections) && f.elf.Sections[sec.Link].Type == elf.SHT_DYNSYM {
+			syms = dynsym
+		}
+
+		data, err := sec.Data()
+		if err != nil {
+			return nil, fmt.Errorf("section %s: %w", sec.Name, err)
+		}
+		entries, err := f.decodeRelocs(data, sec.Type == elf.SHT_RELA)
+		if err != nil {
+			return nil, fmt.Errorf("section %s: %w", sec.Name, err)
+		}
+
+		for _, e := range entries {
+			r := Reloc{
+				Addr:     base + e.off,
+				Type:     e.typ,
+				TypeName: f.relocTypeName(e.typ),
+				Addend:   e.addend,
+				Operand:  -1,
+			}
+			// Symbol 0 is the null symbol, which debug/elf leaves out.
+			if e.sym > 0 && int(e.sym) <= len(syms) {
+				s := syms[e.sym-1]
+				r.Symbol = s.Name
+				if elf.ST_TYPE(s.Info) == elf.STT_SECTION && int(s.Section) < len(f.elf.Sections) {
+					r.Symbol = f.elf.Sections[s.Section].Name
+					r.section = true
+				}
+				r.symAddr, r.defined = f.symbolAddr(s)
+			}
+			relocs = append(relocs, r)
+		}
+	}
+
+	sort.SliceStable(relocs, func(i, j int) bool {
+		return relocs[i].Addr < relocs[j].Addr
+	})
+	return relocs, nil
+}
+
+type relocEntry struct {
+	off    uint64
+	sym    uint32
+	typ    uint32
+	addend int64
+}
+
+// Decode the raw REL / RELA entries for the File class and machine.
+func (f *File) decodeRelocs(data []byte, rela bool) ([]relocEntry, error) {
+	var entries []relocEntry
+	r := bytes.NewReader(data)
+	order := f.elf.ByteOrder
+
+	if f.elf.Class == elf.ELFCLASS64 {
+		for r.Len() > 0 {
+			var e elf.Rela64
+			var err error
+			if rela {
+				err = binary.Read(r, order, &e)
+			} else {
+				var rel elf.Rel64
+				err = binary.Read(r, order, &rel)
+				e.Off, e.Info = rel.Off, rel.Info
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			sym, typ := elf.R_SYM64(e.Info), elf.R_TYPE64(e.Info)
+			if f.elf.Machine == elf.EM_MIPS {
+				// MIPS64 packs r_sym, r_ssym and three r_types in r_info.
+				if order == binary.BigEndian {
+					sym, typ = uint32(e.Info>>32), uint32(e.Info&0xff)
+				} else {
+					sym, typ = uint32(e.Info), uint32(e.Info>>56)
+				}
+			}
+			entries = append(entries, relocEntry{e.Off, sym, typ, e.Addend})
+		}
+		return entries, nil
+	}
+
+	for r.Len() > 0 {
+		var e elf.Rela32
+		var err error
+		if rela {
+			err = binary.Read(r, order, &e)
+		} else {
+			var rel elf.Rel32
+			err = binary.Read(r, order, &rel)
+			e.Off, e.Info = rel.Off, rel.Info
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, relocEntry{uint64(e.Off), elf.R_SYM32(e.Info), elf.R_TYPE32(e.Info), int64(e.Addend)})
+	}
+	return entries, nil
+}
+
+// Apply the relocations in rs to data, the contents of the section they are
+// for, resolving symbols against the File layout. Only the absolute data
+// relocations are done, which are all debug sections use on most machines;
+// the others are left alone.
+func (f *File) applyRelocs(data []byte, rs *elf.Section, syms []elf.Symbol) error {
+	raw, err := rs.Data()
+	if err != nil {
+		return err
+	}
+	entries, err := f.decodeRelocs(raw, rs.Type == elf.SHT_RELA)
+	if err != nil {
+		return err
+	}
+
+	order := f.elf.ByteOrder
+	for _, e := range entries {
+		size := f.absRelocSize(e.typ)
+		if size == 0 || e.sym == 0 || int(e.sym) > len(syms) || e.off+uint64(size) > uint64(len(data)) {
+			continue
+		}
+		field := data[e.off : e.off+uint64(size)]
+		addend := uint64(e.addend)
+		if rs.Type == elf.SHT_REL {
+			// The addend is in the field itself
+			if size == 8 {
+				addend = order.Uint64(field)
+			} else {
+				addend = uint64(order.Uint32(field))
+			}
+		}
+		addr, _ := f.symbolAddr(syms[e.sym-1])
+		if size == 8 {
+			order.PutUint64(field, addr+addend)
+		} else {
+			order.PutUint32(field, uint32(addr+addend))
+		}
+	}
+	return nil
+}
+
+// Size of the field an absolute relocation type writes, 0 for other types.
+func (f *File) absRelocSize(t uint32) int {
+	switch f.elf.Machine {
+	case elf.EM_X86_64:
+		switch elf.R_X86_64(t) {
+		case elf.R_X86_64_64:
+			return 8
+		case elf.R_X86_64_32, elf.R_X86_64_32S:
+			return 4
+		}
+	case elf.EM_386:
+		if elf.R_386(t) == elf.R_386_32 {
+			return 4
+		}
+	case elf.EM_AARCH64:
+		switch elf.R_AARCH64(t) {
+		case elf.R_AARCH64_ABS64:
+			return 8
+		case elf.R_AARCH64_ABS32:
+			return 4
+		}
+	case elf.EM_ARM:
+		if elf.R_ARM(t) == elf.R_ARM_ABS32 {
+			return 4
+		}
+	case elf.EM_MIPS:
+		switch elf.R_MIPS(t) {
+		case elf.R_MIPS_64:
+			return 8
+		case elf.R_MIPS_32:
+			return 4
+		}
+	case elf.EM_PPC64:
+		switch elf.R_PPC64(t) {
+		case elf.R_PPC64_ADDR64:
+			return 8
+		case elf.R_PPC64_ADDR32:
+			return 4
+		}
+	case elf.EM_PPC:
+		if elf.R_PPC(t) == elf.R_PPC_ADDR32 {
+			return 4
+		}
+	case elf.EM_S390:
+		switch elf.R_390(t) {
+		case elf.R_390_64:
+			return 8
+		case elf.R_390_32:
+			return 4
+		}
+	case elf.EM_SPARC, elf.EM_SPARC32PLUS, elf.EM_SPARCV9:
+		switch elf.R_SPARC(t) {
+		case elf.R_SPARC_64, elf.R_SPARC_UA64:
+			return 8
+		case elf.R_SPARC_32, elf.R_SPARC_UA32:
+			return 4
+		}
+	case elf.EM_RISCV:
+		switch elf.R_RISCV(t) {
+		case elf.R_RISCV_64:
+			return 8
+		case elf.R_RISCV_32:
+			return 4
+		}
+	}
+	return 0
+}
+
+func (f *File) relocTypeName(t uint32) string {
+	switch f.elf.Machine {
+	case elf.EM_X86_64:
+		return elf.R_X86_64(t).String()
+	case elf.EM_386:
+		return elf.R_386(t).String()
+	case elf.EM_AARCH64:
+		return elf.R_AARCH64(t).String()
+	case elf.EM_ARM:
+		return elf.R_ARM(t).String()
+	case elf.EM_MIPS:
+		return elf.R_MIPS(t).String()
+	case elf.EM_PPC64:
+		return elf.R_PPC64(t).String()
+	case elf.EM_PPC:
+		return elf.R_PPC(t).String()
+	case elf.EM_S390:
+		return elf.R_390(t).String()
+	case elf.EM_SPARC, elf.EM_SPARC32PLUS, elf.EM_SPARCV9:
+		return elf.R_SPARC(t).String()
+	case elf.EM_RISCV:
+		return elf.R_RISCV(t).String()
+	}
+	return fmt.Sprintf("R_%d", t)
+}
+
+// Index of the operand encoded at byte offset off of insn, or -1. x86 gets
+// the exact answer from X86Encoding, fixed width archs relocate the whole
+// instruction word so the immediate, or failing that memory, operand wins.
+func relocOperand(insn *gapstone.Instruction, off uint64) int {
+	var types []uint
+	var imm, mem uint
+	switch {
+	case insn.X86 != nil:
+		enc := insn.X86.Encoding
+		want := uint(0)
+		switch {
+		case enc.ImmSize > 0 && off == uint64(enc.ImmOffset):
+			want = gapstone.X86_OP_IMM
+		case enc.DispSize > 0 && off == uint64(enc.DispOffset):
+			want = gapstone.X86_OP_MEM
+		default:
+			return -1
+		}
+		for i, op := range insn.X86.Operands {
+			if op.Type == want {
+				return i
+			}
+		}
+		return -1
+	case insn.Arm64 != nil:
+		for _, op := range insn.Arm64.Operands {
+			types = append(types, op.Type)
+		}
+		imm, mem = gapstone.ARM64_OP_IMM, gapstone.ARM64_OP_MEM
+	case insn.Arm != nil:
+		for _, op := range insn.Arm.Operands {
+			types = append(types, op.Type)
+		}
+		imm, mem = gapstone.ARM_OP_IMM, gapstone.ARM_OP_MEM
+	case insn.Mips != nil:
+		for _, op := range insn.Mips.Operands {
+			types = append(types, op.Type)
+		}
+		imm, mem = gapstone.MIPS_OP_IMM, gapstone.MIPS_OP_MEM
+	case insn.PPC != nil:
+		for _, op := range insn.PPC.Operands {
+			types = append(types, op.Type)
+		}
+		imm, mem = gapstone.PPC_OP_IMM, gapstone.PPC_OP_MEM
+	case insn.Sparc != nil:
+		for _, op := range insn.Sparc.Operands {
+			types = append(types, op.Type)
+		}
+		imm, mem = gapstone.SPARC_OP_IMM, gapstone.SPARC_OP_MEM
+	case insn.SysZ != nil:
+		for _, op := range insn.SysZ.Operands {
+			types = append(types, op.Type)
+		}
+		imm, mem = gapstone.SYSZ_OP_IMM, gapstone.SYSZ_OP_MEM
+	default:
+		return -1
+	}
+
+	for _, want := range []uint{imm, mem} {
+		for i, t := range types {
+			if t == want {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// Name the target of a direct branch whose displacement is relocated by r.
+func (f *File) branchName(insn *gapstone.Instruction, r Reloc) (string, bool) {
+	flow := insn.Flow()
+	if !flow.Direct || r.Operand < 0 {
+		return "", false
+	}
+
+	// Offset of the target from S+A
+	var adjust int64
+	switch f.elf.Machine {
+	case elf.EM_X86_64, elf.EM_386:
+		// rel32 is relative to the end of the instruction, the relocation
+		// to the field itself.
+		adjust = int64(uint64(insn.Address+insn.Size) - r.Addr)
+	case elf.EM_AARCH64:
+		switch elf.R_AARCH64(r.Type) {
+		case elf.R_AARCH64_CALL26, elf.R_AARCH64_JUMP26,
+			elf.R_AARCH64_CONDBR19, elf.R_AARCH64_TSTBR14:
+		default:
+			return "", false
+		}
+	default:
+		return "", false
+	}
+
+	off := r.Addend + adjust
+	if r.section && r.defined {
+		// Prefer the function symbol over .text.foo+0x40
+		if sym, symOff, ok := f.symbolContaining(uint64(int64(r.symAddr) + off)); ok {
+			return symOffset(sym.Name, int64(symOff)), true
+		}
+	}
+	return symOffset(r.Symbol, off), true
+}
+
+// Find the symbol with the highest address at or below addr that covers it.
+func (f *File) symbolContaining(addr uint64) (Symbol, uint64, bool) {
+	i := sort.Search(len(f.symbols), func(i int) bool {
+		return f.symbols[i].Addr > addr
+	})
+	for i--; i >= 0; i-- {
+		s := f.symbols[i]
+		if s.Type != elf.STT_FUNC && s.Type != elf.STT_OBJECT {
+			continue
+		}
+		if addr == s.Addr || addr-s.Addr < s.Size {
+			return s, addr - s.Addr, true
+		}
+		break
+	}
+	return Symbol{}, 0, false
+}
+
+// Swap the text of the last operand in an OpStr for s.
+func replaceLastOperand(opStr, s string) string {
+	if i := strings.LastIndex(opStr, ", "); i >= 0 {
+		return opStr[:i+2] + s
+	}
+	return s
+}
@@ -0,0 +1,93 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package elfdis
+
+import "testing"
+
+func TestRelocs(t *testing.T) {
+	f, err := Open("testdata/module.o")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	relocs, err := f.Relocs()
+	if err != nil {
+		t.Fatalf("Relocs failed: %v", err)
+	}
+	if len(relocs) != 5 {
+		t.Fatalf("want 5 relocations, got %d", len(relocs))
+	}
+
+	// Sections are laid out from 0: .text.helper, .rodata.str1.1, then
+	// .text.init_module at 0xb.
+	sym, err := f.LookupSymbol("init_module")
+	if err != nil || sym.Addr != 0xb {
+		t.Fatalf("want init_module at 0xb, got %+v (%v)", sym, err)
+	}
+	if r := relocs[0]; r.Addr != 0xe || r.String() != "R_X86_64_PC32 counter-0x4" {
+		t.Errorf("first relocation: got %s at 0x%x", r, r.Addr)
+	}
+
+	insns, err := f.DisasmSymbol("init_module")
+	if err != nil {
+		t.Fatalf("DisasmSymbol failed: %v", err)
+	}
+	annotated, err := f.Annotate(insns)
+	if err != nil {
+		t.Fatalf("Annotate failed: %v", err)
+	}
+
+	calls := map[uint]string{
+		0x14: "helper", // through the .text.helper section symbol
+		0x2e: "printk", // R_X86_64_PLT32 against an undefined symbol
+	}
+	for _, insn := range annotated {
+		switch insn.Address {
+		case 0xc: // mov ebx, dword ptr [rip]
+			if len(insn.Relocs) != 1 || insn.Relocs[0].Operand != 1 {
+				t.Errorf("mov: want a relocation on operand 1, got %+v", insn.Relocs)
+			}
+		case 0x22: // mov rdi, 0
+			if len(insn.Relocs) != 1 || insn.Relocs[0].Symbol != ".rodata.str1.1" {
+				t.Errorf("mov: want a relocation against .rodata.str1.1, got %+v", insn.Relocs)
+			}
+		}
+		if want, ok := calls[insn.Address]; ok {
+			if insn.Mnemonic != "call" || insn.OpStr != want {
+				t.Errorf("0x%x: want call %s, got %s %s", insn.Address, want, insn.Mnemonic, insn.OpStr)
+			}
+			if len(insn.Relocs) != 1 || insn.Relocs[0].Operand != 0 {
+				t.Errorf("0x%x: want a relocation on operand 0, got %+v", insn.Address, insn.Relocs)
+			}
+		}
+	}
+}
+
+func TestRelocsEmitRelocs(t *testing.T) {
+	f, err := Open("testdata/emitrelocs.elf")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	relocs, err := f.Relocs()
+	if err != nil {
+		t.Fatalf("Relocs failed: %v", err)
+	}
+	// Only .rela.text, not the .rela.debug_* sections
+	if len(relocs) != 4 {
+		t.Fatalf("want 4 relocations, got %d", len(relocs))
+	}
+	if r := relocs[0]; r.Addr != 0x401002 || r.String() != "R_X86_64_PC32 sink-0x4" {
+		t.Errorf("first relocation: got %s at 0x%x", r, r.Addr)
+	}
+}
@@ -0,0 +1,31 @@
+/*
+ * Source of dwarf.elf, built with:
+ *
+ *   gcc -O1 -g -nostdlib -static -no-pie -fno-asynchronous-unwind-tables \
+ *       -fdebug-prefix-map=$PWD=. -Wl,--build-id=none -o dwarf.elf dwarf.c
+ *
+ * of emitrelocs.elf, the same with -Wl,--emit-relocs added, and of dwarf.o,
+ * with each function in its own section, with:
+ *
+ *   gcc -O1 -g -c -ffunction-sections -fno-asynchronous-unwind-tables \
+ *       -fdebug-prefix-map=$PWD=. -o dwarf.o dwarf.c
+ */
+
+volatile int sink;
+
+static inline __attribute__((always_inline)) int load(void)
+{
+	return sink * 3;
+}
+
+__attribute__((noinline)) int scale(int a)
+{
+	int b = load();
+	return a + b;
+}
+
+void _start(void)
+{
+	for (;;)
+		sink = scale(sink);
+}
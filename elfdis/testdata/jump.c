@@ -0,0 +1,63 @@
+/*
+ * Source of jump.elf and jump.o, with __jump_table entries laid out the way
+ * the kernel's arch_static_branch() and arch_static_branch_jump() emit them
+ * on x86_64: a relative code, target and key, the key's low bit set for
+ * static_branch_likely(). Built with:
+ *
+ *   gcc -O1 -nostdlib -static -no-pie -fno-asynchronous-unwind-tables \
+ *       -Wl,--build-id=none -o jump.elf jump.c
+ *   gcc -O1 -c -fno-pic -mcmodel=kernel -fno-asynchronous-unwind-tables \
+ *       -o jump.o jump.c
+ */
+
+struct static_key {
+	int enabled;
+	long type;
+};
+
+struct static_key key_off = { 0 };
+struct static_key key_on = { 1 };
+volatile int sink;
+
+#define JUMP_TABLE_ENTRY(key, branch)				\
+	".pushsection __jump_table, \"aw\"\n\t"			\
+	".balign 8\n\t"						\
+	".long 1b - ., %l[l_yes] - .\n\t"			\
+	".quad " key " + " branch " - .\n\t"			\
+	".popsection\n\t"
+
+/* static_branch_unlikely(&key_off), a 5 byte nop */
+static inline __attribute__((always_inline)) int unlikely_off(void)
+{
+	asm goto("1: .byte 0x0f,0x1f,0x44,0x00,0x00\n\t"
+		 JUMP_TABLE_ENTRY("key_off", "0")
+		 : : : : l_yes);
+	return 0;
+l_yes:
+	return 1;
+}
+
+/* static_branch_likely(&key_on), a 2 byte jmp */
+static inline __attribute__((always_inline)) int likely_on(void)
+{
+	asm goto("1: jmp %l[l_yes]\n\t"
+		 JUMP_TABLE_ENTRY("key_on", "1")
+		 : : : : l_yes);
+	return 0;
+l_yes:
+	return 1;
+}
+
+__attribute__((noinline)) void work(void)
+{
+	if (unlikely_off())
+		sink = 1;
+	if (likely_on())
+		sink = 2;
+}
+
+void _start(void)
+{
+	for (;;)
+		work();
+}
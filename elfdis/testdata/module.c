@@ -0,0 +1,21 @@
+/*
+ * Source of module.o, a stand-in for a kernel module, built with:
+ *
+ *   gcc -O1 -c -fno-pic -mcmodel=kernel -mno-red-zone -ffunction-sections \
+ *       -fno-asynchronous-unwind-tables -fno-stack-protector \
+ *       -o module.o module.c
+ */
+
+extern int printk(const char *fmt, ...);
+extern int counter;
+
+__attribute__((noinline)) static int helper(int x)
+{
+	return x * 3;
+}
+
+int init_module(void)
+{
+	counter += helper(counter);
+	return printk("hi %d\n", counter);
+}
@@ -0,0 +1,19 @@
+/*
+ * Source of x86_64.elf, built with:
+ *
+ *   gcc -O1 -nostdlib -static -no-pie -fno-asynchronous-unwind-tables \
+ *       -Wl,--build-id=none -o x86_64.elf x86_64.c
+ */
+
+volatile int sink;
+
+__attribute__((noinline)) int add(int a, int b)
+{
+	return a + b;
+}
+
+void _start(void)
+{
+	for (;;)
+		sink = add(sink, 2);
+}
@@ -106,6 +106,7 @@ type Instruction struct {
 	Sparc *SparcInstruction
 	SysZ  *SysZInstruction
 	Xcore *XcoreInstruction
+	BPF   *BPFInstruction
 }
 
 // Called by the arch specific decomposers
@@ -266,30 +267,37 @@ func (e *Engine) Disasm(input []byte, address, count uint64) ([]Instruction, err
 		h.Len = int(disassembled)
 		h.Cap = int(disassembled)
 
-		switch e.arch {
-		case CS_ARCH_ARM:
-			return decomposeArm(e, insns), nil
-		case CS_ARCH_ARM64:
-			return decomposeArm64(e, insns), nil
-		case CS_ARCH_MIPS:
-			return decomposeMips(e, insns), nil
-		case CS_ARCH_X86:
-			return decomposeX86(e, insns), nil
-		case CS_ARCH_PPC:
-			return decomposePPC(e, insns), nil
-		case CS_ARCH_SYSZ:
-			return decomposeSysZ(e, insns), nil
-		case CS_ARCH_SPARC:
-			return decomposeSparc(e, insns), nil
-		case CS_ARCH_XCORE:
-			return decomposeXcore(e, insns), nil
-		default:
-			return decomposeGeneric(e, insns), nil
-		}
+		return e.decompose(insns), nil
 	}
 	return []Instruction{}, e.Errno()
 }
 
+// Hand raw instructions to the decomposer for the Engine arch
+func (e *Engine) decompose(raws []C.cs_insn) []Instruction {
+	switch e.arch {
+	case CS_ARCH_ARM:
+		return decomposeArm(e, raws)
+	case CS_ARCH_ARM64:
+		return decomposeArm64(e, raws)
+	case CS_ARCH_MIPS:
+		return decomposeMips(e, raws)
+	case CS_ARCH_X86:
+		return decomposeX86(e, raws)
+	case CS_ARCH_PPC:
+		return decomposePPC(e, raws)
+	case CS_ARCH_SYSZ:
+		return decomposeSysZ(e, raws)
+	case CS_ARCH_SPARC:
+		return decomposeSparc(e, raws)
+	case CS_ARCH_XCORE:
+		return decomposeXcore(e, raws)
+	case CS_ARCH_BPF:
+		return decomposeBPF(e, raws)
+	default:
+		return decomposeGeneric(e, raws)
+	}
+}
+
 func decomposeGeneric(e *Engine, raws []C.cs_insn) []Instruction {
 	decomposed := []Instruction{}
 	for _, raw := range raws {
@@ -31,6 +31,12 @@ const (
 	CS_ARCH_TMS320C64X = C.CS_ARCH_TMS320C64X // TMS320C64x architecture
 	CS_ARCH_M680X      = C.CS_ARCH_M680X      // 680X architecture
 	CS_ARCH_EVM        = C.CS_ARCH_EVM        // Ethereum architecture
+	CS_ARCH_MOS65XX    = C.CS_ARCH_MOS65XX    // MOS65XX architecture (including MOS6502)
+	CS_ARCH_WASM       = C.CS_ARCH_WASM       // WebAssembly architecture
+	CS_ARCH_BPF        = C.CS_ARCH_BPF        // Berkeley Packet Filter architecture (including eBPF)
+	CS_ARCH_RISCV      = C.CS_ARCH_RISCV      // RISCV architecture
+	CS_ARCH_SH         = C.CS_ARCH_SH         // SH architecture
+	CS_ARCH_TRICORE    = C.CS_ARCH_TRICORE    // TriCore architecture
 	CS_ARCH_MAX        = C.CS_ARCH_MAX
 	CS_ARCH_ALL        = C.CS_ARCH_ALL
 )
@@ -70,6 +76,11 @@ const (
 	CS_MODE_M680X_6811    = C.CS_MODE_M680X_6811    // M680X Motorola/Freescale/NXP 68HC11 mode
 	CS_MODE_M680X_CPU12   = C.CS_MODE_M680X_CPU12   // M680X Motorola/Freescale/NXP CPU12 used on M68HC12/HCS12
 	CS_MODE_M680X_HCS08   = C.CS_MODE_M680X_HCS08   // M680X Freescale/NXP HCS08 mode
+	CS_MODE_BPF_CLASSIC   = C.CS_MODE_BPF_CLASSIC   // Classic BPF mode (default)
+	CS_MODE_BPF_EXTENDED  = C.CS_MODE_BPF_EXTENDED  // Extended BPF mode
+	CS_MODE_RISCV32       = C.CS_MODE_RISCV32       // RISCV RV32G
+	CS_MODE_RISCV64       = C.CS_MODE_RISCV64       // RISCV RV64G
+	CS_MODE_RISCVC        = C.CS_MODE_RISCVC        // RISCV compressed instruction mode
 
 )
 
@@ -56,29 +56,43 @@ func (e *Engine) DisasmIter(input []byte, address uint64) <-chan Instruction {
 			&addr,
 			insn,
 		) {
-
-			switch e.arch {
-			case CS_ARCH_ARM:
-				out <- decomposeArm(e, insns)[0]
-			case CS_ARCH_ARM64:
-				out <- decomposeArm64(e, insns)[0]
-			case CS_ARCH_MIPS:
-				out <- decomposeMips(e, insns)[0]
-			case CS_ARCH_X86:
-				out <- decomposeX86(e, insns)[0]
-			case CS_ARCH_PPC:
-				out <- decomposePPC(e, insns)[0]
-			case CS_ARCH_SYSZ:
-				out <- decomposeSysZ(e, insns)[0]
-			case CS_ARCH_SPARC:
-				out <- decomposeSparc(e, insns)[0]
-			case CS_ARCH_XCORE:
-				out <- decomposeXcore(e, insns)[0]
-			default:
-				return
-			}
+			out <- e.decompose(insns)[0]
 		}
 		return
 	}()
 	return out
 }
+
+// Decode instructions from input with cs_disasm_iter, handing each one to fn
+// until fn returns false, the input runs out or an invalid instruction is
+// met. Returns the address just past the last instruction that was decoded,
+// so callers can tell how far the decoder got.
+func (e *Engine) disasmIter(input []byte, address uint64, fn func(insn *Instruction) bool) uint64 {
+	if len(input) == 0 {
+		return address
+	}
+
+	insn := C.cs_malloc(e.handle)
+	defer C.cs_free(insn, C.size_t(1))
+
+	cbuf := C.CBytes(input)
+	defer C.free(cbuf)
+
+	bptr := (*C.uint8_t)(cbuf)
+	ilen := C.size_t(len(input))
+	addr := C.uint64_t(address)
+
+	var insns []C.cs_insn
+	h := (*reflect.SliceHeader)(unsafe.Pointer(&insns))
+	h.Data = uintptr(unsafe.Pointer(insn))
+	h.Len = int(1)
+	h.Cap = int(1)
+
+	for C.cs_disasm_iter(e.handle, &bptr, &ilen, &addr, insn) {
+		decoded := e.decompose(insns)[0]
+		if !fn(&decoded) {
+			break
+		}
+	}
+	return uint64(addr)
+}
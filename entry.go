@@ -0,0 +1,242 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package gapstone
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+)
+
+// Indirect branch landing pad at a function entry
+type LandingPad int
+
+const (
+	LandingPadNone      LandingPad = iota
+	LandingPadIBT                  // endbr64
+	LandingPadIBTSealed            // endbr64 poisoned by the kernel, nopl -42(%rax)
+	LandingPadBTI                  // bti c or bti jc
+	LandingPadPAC                  // paciasp or pacibsp, an implicit bti c
+)
+
+func (l LandingPad) String() string {
+	switch l {
+	case LandingPadNone:
+		return "none"
+	case LandingPadIBT:
+		return "ibt"
+	case LandingPadIBTSealed:
+		return "ibt-sealed"
+	case LandingPadBTI:
+		return "bti"
+	case LandingPadPAC:
+		return "pac"
+	}
+	return "unknown"
+}
+
+// State of the ftrace patch site at a function entry
+type FtraceState int
+
+const (
+	FtraceNone    FtraceState = iota // No patch site, the function can't be ftraced
+	FtraceNop                        // Patched out, not traced
+	FtraceFentry                     // call __fentry__, as compiled
+	FtraceEnabled                    // Patched to call (or jump to) a trampoline
+)
+
+func (s FtraceState) String() string {
+	switch s {
+	case FtraceNone:
+		return "none"
+	case FtraceNop:
+		return "nop"
+	case FtraceFentry:
+		return "fentry"
+	case FtraceEnabled:
+		return "enabled"
+	}
+	return "unknown"
+}
+
+// What sits at the entry of a kernel function, see AnalyzeEntry.
+type FuncEntry struct {
+	Addr           uint64 // The function symbol
+	Prefix         uint64 // Start of the __pfx_ padding, when HasPrefix
+	HasPrefix      bool
+	LandingPad     LandingPad
+	LandingPadAddr uint64
+	Ftrace         FtraceState
+	FtraceAddr     uint64 // The patched instruction: the 5 byte nop or call on x86, the bl slot on arm64
+	FtraceTarget   uint64 // For calls, when the target is direct
+	PAC            bool   // arm64 return address signing
+	Body           uint64 // First instruction past the entry sequence, 0 if insns ran out
+}
+
+// Encodings, little endian
+const (
+	arm64BtiC    = 0xd503245f
+	arm64BtiJC   = 0xd50324df
+	arm64Paciasp = 0xd503233f
+	arm64Pacibsp = 0xd503237f
+	arm64MovX9LR = 0xaa1e03e9 // mov x9, x30
+)
+
+// The kernel's poisoned endbr64
+var x86SealedEndbr = []byte{0x0f, 0x1f, 0x40, 0xd6}
+
+// Classify the entry sequence of a kernel function: the IBT or BTI landing
+// pad, the ftrace patch site (a 5 byte nop or call __fentry__ on x86, the
+// two nops of -fpatchable-function-entry=2 on arm64) and pointer
+// authentication. insns are disassembled from the function address, or
+// from its __pfx_ symbol; s is needed to tell __pfx_ padding and
+// __fentry__ from other code and may be nil. Needs CS_OPT_DETAIL.
+func AnalyzeEntry(insns []Instruction, s Symbolizer) FuncEntry {
+	var fe FuncEntry
+	if len(insns) == 0 {
+		return fe
+	}
+
+	fe.Addr = uint64(insns[0].Address)
+	if s != nil {
+		if name, off, ok := s.Lookup(fe.Addr); ok && strings.HasPrefix(name, "__pfx_") {
+			fe.HasPrefix, fe.Prefix = true, fe.Addr-off
+			for len(insns) > 0 {
+				if n, _, ok := s.Lookup(uint64(insns[0].Address)); ok && n != name {
+					break
+				}
+				insns = insns[1:]
+			}
+			if len(insns) == 0 {
+				return fe
+			}
+			fe.Addr = uint64(insns[0].Address)
+		} else if fe.Addr > 0 {
+			if name, off, ok := s.Lookup(fe.Addr - 1); ok && strings.HasPrefix(name, "__pfx_") {
+				fe.HasPrefix, fe.Prefix = true, fe.Addr-1-off
+			}
+		}
+	}
+
+	var n int
+	switch {
+	case insns[0].X86 != nil:
+		n = fe.x86(insns, s)
+	case insns[0].Arm64 != nil:
+		n = fe.arm64(insns)
+	}
+	if n < len(insns) {
+		fe.Body = uint64(insns[n].Address)
+	}
+	return fe
+}
+
+// Returns how many instructions the entry sequence takes.
+func (fe *FuncEntry) x86(insns []Instruction, s Symbolizer) int {
+	i := 0
+	switch {
+	case insns[0].Id == X86_INS_ENDBR64:
+		fe.LandingPad = LandingPadIBT
+	case bytes.Equal(insns[0].Bytes, x86SealedEndbr):
+		fe.LandingPad = LandingPadIBTSealed
+	}
+	if fe.LandingPad != LandingPadNone {
+		fe.LandingPadAddr = uint64(insns[0].Address)
+		i++
+	}
+	if i >= len(insns) || insns[i].Size != 5 {
+		return i
+	}
+
+	site := insns[i]
+	flow := site.Flow()
+	switch {
+	case site.Id == X86_INS_NOP:
+		fe.Ftrace = FtraceNop
+	case flow.Kind == FlowCall && flow.Direct:
+		fe.Ftrace = FtraceEnabled
+		if s != nil {
+			if name, off, ok := s.Lookup(flow.Target); ok && off == 0 && name == "__fentry__" {
+				fe.Ftrace = FtraceFentry
+			}
+		}
+		fe.FtraceTarget = flow.Target
+	case flow.Kind == FlowJump && flow.Direct:
+		// A direct trampoline that doesn't return here
+		fe.Ftrace = FtraceEnabled
+		fe.FtraceTarget = flow.Target
+	default:
+		return i
+	}
+	fe.FtraceAddr = uint64(site.Address)
+	return i + 1
+}
+
+func (fe *FuncEntry) arm64(insns []Instruction) int {
+	word := func(i int) uint32 {
+		if i >= len(insns) || len(insns[i].Bytes) != 4 {
+			return 0
+		}
+		return binary.LittleEndian.Uint32(insns[i].Bytes)
+	}
+	pac := func(i int) bool {
+		return word(i) == arm64Paciasp || word(i) == arm64Pacibsp
+	}
+
+	i := 0
+	switch {
+	case word(0) == arm64BtiC, word(0) == arm64BtiJC:
+		fe.LandingPad = LandingPadBTI
+	case pac(0):
+		fe.LandingPad, fe.PAC = LandingPadPAC, true
+	}
+	if fe.LandingPad != LandingPadNone {
+		fe.LandingPadAddr = uint64(insns[0].Address)
+		i++
+	}
+
+	// The first slot saves the return address for the second to call
+	// ftrace_caller, mov x9, x30; bl
+	if i+1 < len(insns) {
+		first, second := insns[i], insns[i+1]
+		switch {
+		case first.Id == ARM64_INS_NOP && second.Id == ARM64_INS_NOP:
+			fe.Ftrace = FtraceNop
+		case (first.Id == ARM64_INS_NOP || word(i) == arm64MovX9LR) && second.Id == ARM64_INS_BL:
+			fe.Ftrace = FtraceEnabled
+			fe.FtraceTarget = second.Flow().Target
+		}
+		if fe.Ftrace != FtraceNone {
+			fe.FtraceAddr = uint64(second.Address)
+			i += 2
+		}
+	}
+
+	if !fe.PAC && pac(i) {
+		fe.PAC = true
+		i++
+	}
+	return i
+}
+
+// How many bytes FuncEntry disassembles.
+const entryWindow = 32
+
+// Disassemble the start of the function at addr and classify its entry, see
+// AnalyzeEntry. When s knows a __pfx_ symbol for the function it is
+// reported, but disassembly starts at addr.
+func (e *Engine) FuncEntry(mem Memory, addr uint64, s Symbolizer) (FuncEntry, error) {
+	insns, err := e.DisasmRange(mem, addr, addr+entryWindow)
+	if len(insns) == 0 {
+		return FuncEntry{Addr: addr}, err
+	}
+	return AnalyzeEntry(insns, s), nil
+}
@@ -0,0 +1,127 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package gapstone
+
+import (
+	"strings"
+	"testing"
+)
+
+func entryEngine(t *testing.T, arch, mode int) Engine {
+	engine, err := New(arch, mode)
+	if err != nil {
+		t.Fatalf("Failed to initialize engine %v", err)
+	}
+	engine.SetOption(CS_OPT_DETAIL, CS_OPT_ON)
+	return engine
+}
+
+var entrySyms = NewSymbolTable([]Symbol{
+	{Name: "__fentry__", Addr: 0x2000, Size: 1},
+	{Name: "__pfx_foo", Addr: 0x1000, Size: 16},
+	{Name: "foo", Addr: 0x1010, Size: 0x20},
+})
+
+func TestAnalyzeEntryX86(t *testing.T) {
+	engine := entryEngine(t, CS_ARCH_X86, CS_MODE_64)
+	defer engine.Close()
+
+	pfx := strings.Repeat("\x90", 16)
+	for _, tc := range []struct {
+		name string
+		addr uint64
+		code string
+		want FuncEntry
+	}{
+		{
+			"ibt nop", 0x1010,
+			"\xf3\x0f\x1e\xfa" + "\x0f\x1f\x44\x00\x00" + "\x55",
+			FuncEntry{Addr: 0x1010, Prefix: 0x1000, HasPrefix: true, LandingPad: LandingPadIBT, LandingPadAddr: 0x1010,
+				Ftrace: FtraceNop, FtraceAddr: 0x1014, Body: 0x1019},
+		},
+		{
+			"from __pfx_", 0x1000,
+			pfx + "\xf3\x0f\x1e\xfa" + "\xe8\xe7\x0f\x00\x00" + "\x55",
+			FuncEntry{Addr: 0x1010, Prefix: 0x1000, HasPrefix: true, LandingPad: LandingPadIBT, LandingPadAddr: 0x1010,
+				Ftrace: FtraceFentry, FtraceAddr: 0x1014, FtraceTarget: 0x2000, Body: 0x1019},
+		},
+		{
+			"sealed trampoline", 0x1010,
+			"\x0f\x1f\x40\xd6" + "\xe8\xe7\x1f\x00\x00" + "\x55",
+			FuncEntry{Addr: 0x1010, Prefix: 0x1000, HasPrefix: true, LandingPad: LandingPadIBTSealed, LandingPadAddr: 0x1010,
+				Ftrace: FtraceEnabled, FtraceAddr: 0x1014, FtraceTarget: 0x3000, Body: 0x1019},
+		},
+		{
+			"notrace", 0x1010,
+			"\x55" + "\x48\x89\xe5",
+			FuncEntry{Addr: 0x1010, Prefix: 0x1000, HasPrefix: true, Body: 0x1010},
+		},
+	} {
+		insns, err := engine.Disasm([]byte(tc.code), tc.addr, 0)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got := AnalyzeEntry(insns, entrySyms); got != tc.want {
+			t.Errorf("%s:\n got %+v\nwant %+v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestAnalyzeEntryArm64(t *testing.T) {
+	engine := entryEngine(t, CS_ARCH_ARM64, CS_MODE_ARM)
+	defer engine.Close()
+
+	for _, tc := range []struct {
+		name string
+		code string
+		want FuncEntry
+	}{
+		{
+			"bti nops pac",
+			"\x5f\x24\x03\xd5" + "\x1f\x20\x03\xd5" + "\x1f\x20\x03\xd5" + "\x3f\x23\x03\xd5" + "\xfd\x7b\xbf\xa9",
+			FuncEntry{Addr: 0x1000, LandingPad: LandingPadBTI, LandingPadAddr: 0x1000,
+				Ftrace: FtraceNop, FtraceAddr: 0x1008, PAC: true, Body: 0x1010},
+		},
+		{
+			"enabled",
+			"\x5f\x24\x03\xd5" + "\xe9\x03\x1e\xaa" + "\x40\x00\x00\x94" + "\xfd\x7b\xbf\xa9",
+			FuncEntry{Addr: 0x1000, LandingPad: LandingPadBTI, LandingPadAddr: 0x1000,
+				Ftrace: FtraceEnabled, FtraceAddr: 0x1008, FtraceTarget: 0x1108, Body: 0x100c},
+		},
+		{
+			"pac only",
+			"\x3f\x23\x03\xd5" + "\xfd\x7b\xbf\xa9",
+			FuncEntry{Addr: 0x1000, LandingPad: LandingPadPAC, LandingPadAddr: 0x1000, PAC: true, Body: 0x1004},
+		},
+	} {
+		insns, err := engine.Disasm([]byte(tc.code), 0x1000, 0)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got := AnalyzeEntry(insns, nil); got != tc.want {
+			t.Errorf("%s:\n got %+v\nwant %+v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestFuncEntry(t *testing.T) {
+	engine := entryEngine(t, CS_ARCH_X86, CS_MODE_64)
+	defer engine.Close()
+
+	mem := NewBytesMemory(0x1010, []byte("\xf3\x0f\x1e\xfa\x0f\x1f\x44\x00\x00\x55\xc3"), PermRead|PermExec)
+	fe, err := engine.FuncEntry(mem, 0x1010, nil)
+	if err != nil {
+		t.Fatalf("FuncEntry failed: %v", err)
+	}
+	if fe.LandingPad != LandingPadIBT || fe.Ftrace != FtraceNop || fe.FtraceAddr != 0x1014 || fe.HasPrefix {
+		t.Errorf("FuncEntry = %+v", fe)
+	}
+}
@@ -0,0 +1,278 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+// Package evm analyses Ethereum contract bytecode on top of CS_ARCH_EVM:
+// valid jump destinations, the compiler metadata trailer, basic blocks with
+// statically resolved jumps, and the function selector dispatcher.
+package evm
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/bpfsnoop/gapstone"
+)
+
+var ErrArch = errors.New("engine is not CS_ARCH_EVM")
+
+// Raw opcodes the analyses look at
+const (
+	opStop         = 0x00
+	opEq           = 0x14
+	opJump         = 0x56
+	opJumpi        = 0x57
+	opJumpdest     = 0x5b
+	opPush0        = 0x5f
+	opPush1        = 0x60
+	opPush4        = 0x63
+	opPush32       = 0x7f
+	opDup1         = 0x80
+	opDup2         = 0x81
+	opReturn       = 0xf3
+	opRevert       = 0xfd
+	opInvalid      = 0xfe
+	opSelfdestruct = 0xff
+)
+
+// An instruction with its raw opcode and PUSH payload. Opcodes Capstone
+// doesn't know, such as PUSH0, get Id EVM_INS_INVALID and a made up
+// mnemonic, so analyses go by Op rather than Id.
+type Instruction struct {
+	gapstone.Instruction
+	Op      byte
+	Arg     []byte // PUSH payload, shorter than n for a PUSHn cut off by the end of code
+	Unknown bool   // Not decoded by Capstone
+}
+
+// The value pushed, for PUSH0..PUSH8. ok is false for other instructions
+// and for wider values.
+func (insn Instruction) Value() (v uint64, ok bool) {
+	if insn.Op != opPush0 && !isPush(insn.Op) {
+		return 0, false
+	}
+	arg := insn.Arg
+	for len(arg) > 0 && arg[0] == 0 {
+		arg = arg[1:]
+	}
+	if len(arg) > 8 {
+		return 0, false
+	}
+	for _, b := range arg {
+		v = v<<8 | uint64(b)
+	}
+	return v, true
+}
+
+func isPush(op byte) bool { return op >= opPush1 && op <= opPush32 }
+
+// Execution never continues past the instruction. Unknown opcodes abort
+// like INVALID.
+func (insn Instruction) halts() bool {
+	switch insn.Op {
+	case opStop, opJump, opReturn, opRevert, opInvalid, opSelfdestruct:
+		return true
+	}
+	return insn.Unknown && insn.Op != opPush0 && !isPush(insn.Op)
+}
+
+// A basic block, covering [Start, End).
+type Block struct {
+	Start        uint64
+	End          uint64
+	Instructions []Instruction
+	Succs        []uint64 // Start of each successor block, jump target first
+	Dynamic      bool     // Ends in a jump whose target isn't a PUSH constant
+}
+
+// A function selector from the dispatcher, and where it jumps to.
+type Selector struct {
+	Selector uint32
+	Target   uint64
+}
+
+func (s Selector) String() string {
+	return fmt.Sprintf("0x%08x -> 0x%x", s.Selector, s.Target)
+}
+
+// Analysed contract runtime code.
+type Program struct {
+	Code         []byte    // Without the metadata trailer
+	Metadata     *Metadata // nil if there was no trailer
+	Instructions []Instruction
+	JumpDests    map[uint64]bool
+	Blocks       []*Block // Sorted by Start
+}
+
+// The offsets of valid JUMPDEST instructions, leaving out 0x5b bytes that
+// are PUSH payload.
+func JumpDests(code []byte) map[uint64]bool {
+	dests := make(map[uint64]bool)
+	for i := 0; i < len(code); i++ {
+		switch op := code[i]; {
+		case op == opJumpdest:
+			dests[uint64(i)] = true
+		case isPush(op):
+			i += int(op-opPush1) + 1
+		}
+	}
+	return dests
+}
+
+// Strip the metadata trailer from runtime bytecode, disassemble it with
+// engine and build the basic blocks.
+func Analyze(engine *gapstone.Engine, bytecode []byte) (*Program, error) {
+	if engine.Arch() != gapstone.CS_ARCH_EVM {
+		return nil, ErrArch
+	}
+	p := &Program{}
+	p.Code, p.Metadata = StripMetadata(bytecode)
+	p.Instructions = Disasm(engine, p.Code)
+	p.JumpDests = JumpDests(p.Code)
+	p.buildBlocks()
+	return p, nil
+}
+
+// Disassemble all of code. Where Capstone stops, at an opcode it doesn't
+// know or a truncated PUSH, the byte is taken as an Unknown instruction
+// and decoding carries on after it.
+func Disasm(engine *gapstone.Engine, code []byte) []Instruction {
+	var out []Instruction
+	for pos := 0; pos < len(code); {
+		// Nothing decoded is reported as an error, which is handled below
+		insns, _ := engine.Disasm(code[pos:], uint64(pos), 0)
+		for _, insn := range insns {
+			i := Instruction{Instruction: insn, Op: code[insn.Address]}
+			if isPush(i.Op) {
+				i.Arg = code[insn.Address+1 : insn.Address+insn.Size]
+			}
+			out = append(out, i)
+			pos = int(insn.Address + insn.Size)
+		}
+		if pos < len(code) {
+			i := unknown(code, pos)
+			out = append(out, i)
+			pos += int(i.Size)
+		}
+	}
+	return out
+}
+
+func unknown(code []byte, pos int) Instruction {
+	op := code[pos]
+	i := Instruction{Op: op, Unknown: true}
+	i.Id = gapstone.EVM_INS_INVALID
+	i.Address = uint(pos)
+	i.Size = 1
+	switch {
+	case op == opPush0:
+		i.Mnemonic = "PUSH0"
+	case isPush(op):
+		n := min(int(op-opPush1)+1, len(code)-pos-1)
+		i.Size += uint(n)
+		i.Arg = code[pos+1 : pos+1+n]
+		i.Mnemonic = fmt.Sprintf("PUSH%d", op-opPush1+1)
+		i.OpStr = fmt.Sprintf("0x%x", i.Arg)
+	default:
+		i.Mnemonic = fmt.Sprintf("UNKNOWN_0x%02x", op)
+	}
+	i.Bytes = code[pos : pos+int(i.Size)]
+	return i
+}
+
+// Split the instructions into blocks, which start at offset 0, at each
+// JUMPDEST and after each halting or jumping instruction, and link them.
+func (p *Program) buildBlocks() {
+	var cur *Block
+	for _, insn := range p.Instructions {
+		addr := uint64(insn.Address)
+		if cur == nil || insn.Op == opJumpdest && len(cur.Instructions) > 0 {
+			cur = &Block{Start: addr}
+			p.Blocks = append(p.Blocks, cur)
+		}
+		cur.Instructions = append(cur.Instructions, insn)
+		cur.End = addr + uint64(insn.Size)
+		if insn.halts() || insn.Op == opJumpi {
+			cur = nil
+		}
+	}
+
+	for _, b := range p.Blocks {
+		last := b.Instructions[len(b.Instructions)-1]
+		if last.Op == opJump || last.Op == opJumpi {
+			if target, ok := p.staticTarget(b); ok {
+				b.Succs = append(b.Succs, target)
+			} else {
+				b.Dynamic = true
+			}
+		}
+		if !last.halts() && b.End < uint64(len(p.Code)) {
+			b.Succs = append(b.Succs, b.End)
+		}
+	}
+}
+
+// The target of the jump ending b, when it is pushed right before the jump
+// and is a valid JUMPDEST.
+func (p *Program) staticTarget(b *Block) (uint64, bool) {
+	n := len(b.Instructions)
+	if n < 2 {
+		return 0, false
+	}
+	target, ok := b.Instructions[n-2].Value()
+	if !ok || !p.JumpDests[target] {
+		return 0, false
+	}
+	return target, true
+}
+
+// The block starting at addr.
+func (p *Program) Block(addr uint64) (*Block, bool) {
+	i := sort.Search(len(p.Blocks), func(i int) bool {
+		return p.Blocks[i].Start >= addr
+	})
+	if i < len(p.Blocks) && p.Blocks[i].Start == addr {
+		return p.Blocks[i], true
+	}
+	return nil, false
+}
+
+// The function selectors the dispatcher compares the call data against, in
+// code order. Both the legacy "DUP1 PUSH4 sel EQ PUSHn dest JUMPI" and the
+// via-IR "PUSH4 sel DUP2 EQ PUSHn dest JUMPI" shapes are recognised.
+func (p *Program) Selectors() []Selector {
+	var out []Selector
+	seen := make(map[uint32]bool)
+	insns := p.Instructions
+	for i, insn := range insns {
+		if insn.Op != opPush4 || len(insn.Arg) != 4 {
+			continue
+		}
+		j := i + 1
+		if j < len(insns) && insns[j].Op == opDup2 {
+			j++
+		} else if i == 0 || insns[i-1].Op != opDup1 {
+			continue
+		}
+		if j+2 >= len(insns) || insns[j].Op != opEq || insns[j+2].Op != opJumpi {
+			continue
+		}
+		target, ok := insns[j+1].Value()
+		if !ok || !p.JumpDests[target] {
+			continue
+		}
+		sel, _ := insn.Value()
+		if !seen[uint32(sel)] {
+			seen[uint32(sel)] = true
+			out = append(out, Selector{Selector: uint32(sel), Target: target})
+		}
+	}
+	return out
+}
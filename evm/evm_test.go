@@ -0,0 +1,159 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package evm
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/bpfsnoop/gapstone"
+)
+
+// A dispatcher for transfer(address,uint256) in the legacy shape and
+// balanceOf(address) in the via-IR shape. transfer pushes a 0x5b byte,
+// which is not a JUMPDEST, and uses PUSH0; balanceOf jumps to a computed
+// address.
+var testCode = []byte{
+	0x60, 0x80, // 00 PUSH1 0x80
+	0x60, 0x40, // 02 PUSH1 0x40
+	0x52,       // 04 MSTORE
+	0x60, 0x00, // 05 PUSH1 0
+	0x35,       // 07 CALLDATALOAD
+	0x60, 0xe0, // 08 PUSH1 0xe0
+	0x1c,                         // 0a SHR
+	0x80,                         // 0b DUP1
+	0x63, 0xa9, 0x05, 0x9c, 0xbb, // 0c PUSH4 0xa9059cbb
+	0x14,             // 11 EQ
+	0x61, 0x00, 0x20, // 12 PUSH2 0x20
+	0x57,                         // 15 JUMPI
+	0x63, 0x70, 0xa0, 0x82, 0x31, // 16 PUSH4 0x70a08231
+	0x81,       // 1b DUP2
+	0x14,       // 1c EQ
+	0x60, 0x26, // 1d PUSH1 0x26
+	0x57,       // 1f JUMPI
+	0x5b,       // 20 JUMPDEST
+	0x60, 0x5b, // 21 PUSH1 0x5b
+	0x50, // 23 POP
+	0x5f, // 24 PUSH0
+	0x00, // 25 STOP
+	0x5b, // 26 JUMPDEST
+	0x56, // 27 JUMP
+}
+
+// solc's trailer: {"ipfs": <34 bytes>, "solc": 0.8.19}
+func testMetadata() []byte {
+	meta := []byte{0xa2, 0x64, 'i', 'p', 'f', 's', 0x58, 0x22, 0x12, 0x20}
+	meta = append(meta, bytes.Repeat([]byte{0xab}, 32)...)
+	meta = append(meta, 0x64, 's', 'o', 'l', 'c', 0x43, 0x00, 0x08, 0x13)
+	return append(meta, 0x00, byte(len(meta)))
+}
+
+func TestJumpDests(t *testing.T) {
+	want := map[uint64]bool{0x20: true, 0x26: true}
+	if got := JumpDests(testCode); !reflect.DeepEqual(got, want) {
+		t.Errorf("JumpDests = %v, want %v", got, want)
+	}
+	// A PUSH32 swallows everything after it
+	if got := JumpDests([]byte{0x7f, 0x5b, 0x5b}); len(got) != 0 {
+		t.Errorf("JumpDests in truncated PUSH32 = %v", got)
+	}
+}
+
+func TestStripMetadata(t *testing.T) {
+	meta := testMetadata()
+	code, m := StripMetadata(append(append([]byte(nil), testCode...), meta...))
+	if !bytes.Equal(code, testCode) {
+		t.Fatalf("code = %x, want %x", code, testCode)
+	}
+	if m == nil {
+		t.Fatal("no metadata")
+	}
+	if m.Solc != "0.8.19" {
+		t.Errorf("Solc = %q", m.Solc)
+	}
+	if len(m.IPFS) != 34 || m.IPFS[0] != 0x12 {
+		t.Errorf("IPFS = %x", m.IPFS)
+	}
+	if !bytes.Equal(m.Raw, meta) {
+		t.Errorf("Raw = %x, want %x", m.Raw, meta)
+	}
+
+	// The last two bytes of plain code rarely make a valid trailer
+	if code, m := StripMetadata(testCode); m != nil || len(code) != len(testCode) {
+		t.Errorf("StripMetadata of code without trailer = %x, %+v", code, m)
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	engine, err := gapstone.New(gapstone.CS_ARCH_EVM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close()
+
+	p, err := Analyze(&engine, append(append([]byte(nil), testCode...), testMetadata()...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Metadata == nil || len(p.Code) != len(testCode) {
+		t.Fatalf("metadata not stripped, %d bytes of code", len(p.Code))
+	}
+
+	type block struct {
+		start, end uint64
+		succs      []uint64
+		dynamic    bool
+	}
+	want := []block{
+		{0x00, 0x16, []uint64{0x20, 0x16}, false},
+		{0x16, 0x20, []uint64{0x26, 0x20}, false},
+		{0x20, 0x26, nil, false},
+		{0x26, 0x28, nil, true},
+	}
+	var got []block
+	for _, b := range p.Blocks {
+		got = append(got, block{b.Start, b.End, b.Succs, b.Dynamic})
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("blocks = %+v, want %+v", got, want)
+	}
+
+	b, ok := p.Block(0x20)
+	if !ok {
+		t.Fatal("no block at 0x20")
+	}
+	push0 := b.Instructions[3]
+	if push0.Op != 0x5f || push0.Mnemonic != "PUSH0" {
+		t.Errorf("instruction at 0x24 = %s (0x%02x)", push0.Mnemonic, push0.Op)
+	}
+	if v, ok := b.Instructions[1].Value(); !ok || v != 0x5b {
+		t.Errorf("PUSH1 value = 0x%x, %v", v, ok)
+	}
+
+	sels := p.Selectors()
+	wantSels := []Selector{{0xa9059cbb, 0x20}, {0x70a08231, 0x26}}
+	if !reflect.DeepEqual(sels, wantSels) {
+		t.Errorf("Selectors = %v, want %v", sels, wantSels)
+	}
+}
+
+func TestAnalyzeArch(t *testing.T) {
+	engine, err := gapstone.New(gapstone.CS_ARCH_X86, gapstone.CS_MODE_64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close()
+
+	if _, err := Analyze(&engine, testCode); err != ErrArch {
+		t.Errorf("Analyze with x86 engine: %v", err)
+	}
+}
@@ -0,0 +1,149 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package evm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// The CBOR encoded metadata solc and vyper append to the runtime code.
+type Metadata struct {
+	Raw          []byte // The whole trailer, including the length suffix
+	IPFS         []byte // Multihash of the metadata JSON
+	Swarm        []byte // From "bzzr0" or "bzzr1", older compilers
+	Solc         string // eg. "0.8.19", or the full version of nightlies
+	Experimental bool
+	Fields       map[string]any // Every field, values are []byte, string, uint64 or bool
+}
+
+// Split bytecode into the code and the metadata trailer, when there is
+// one: a CBOR map, followed by its length as a big endian uint16.
+func StripMetadata(bytecode []byte) ([]byte, *Metadata) {
+	n := len(bytecode)
+	if n < 2 {
+		return bytecode, nil
+	}
+	size := int(binary.BigEndian.Uint16(bytecode[n-2:]))
+	if size == 0 || size+2 > n {
+		return bytecode, nil
+	}
+	start := n - 2 - size
+
+	d := &cborDecoder{data: bytecode[start : n-2]}
+	fields, ok := d.value().(map[string]any)
+	if d.err != nil || !ok || d.pos != len(d.data) || len(fields) == 0 {
+		return bytecode, nil
+	}
+
+	m := &Metadata{Raw: bytecode[start:], Fields: fields}
+	m.IPFS, _ = fields["ipfs"].([]byte)
+	if m.Swarm, ok = fields["bzzr1"].([]byte); !ok {
+		m.Swarm, _ = fields["bzzr0"].([]byte)
+	}
+	switch v := fields["solc"].(type) {
+	case []byte:
+		if len(v) == 3 {
+			m.Solc = fmt.Sprintf("%d.%d.%d", v[0], v[1], v[2])
+		}
+	case string:
+		m.Solc = v
+	}
+	m.Experimental, _ = fields["experimental"].(bool)
+	return bytecode[:start], m
+}
+
+var errCBOR = errors.New("unsupported CBOR")
+
+// Just enough CBOR for compiler metadata: a map of text keys to byte
+// strings, text strings, unsigned integers and booleans.
+type cborDecoder struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (d *cborDecoder) value() any {
+	if d.err != nil {
+		return nil
+	}
+	if d.pos >= len(d.data) {
+		d.err = errCBOR
+		return nil
+	}
+	b := d.data[d.pos]
+	d.pos++
+	major, info := b>>5, b&0x1f
+
+	if major == 7 {
+		switch info {
+		case 20:
+			return false
+		case 21:
+			return true
+		}
+		d.err = errCBOR
+		return nil
+	}
+
+	n := d.argument(info)
+	switch major {
+	case 0:
+		return n
+	case 2, 3:
+		if d.err != nil || n > uint64(len(d.data)-d.pos) {
+			d.err = errCBOR
+			return nil
+		}
+		s := d.data[d.pos : d.pos+int(n)]
+		d.pos += int(n)
+		if major == 3 {
+			return string(s)
+		}
+		return s
+	case 5:
+		m := make(map[string]any)
+		for ; n > 0 && d.err == nil; n-- {
+			key, ok := d.value().(string)
+			if !ok {
+				d.err = errCBOR
+				return nil
+			}
+			m[key] = d.value()
+		}
+		return m
+	}
+	d.err = errCBOR
+	return nil
+}
+
+// The length or value following an initial byte.
+func (d *cborDecoder) argument(info byte) uint64 {
+	if info < 24 {
+		return uint64(info)
+	}
+	if info > 27 {
+		d.err = errCBOR
+		return 0
+	}
+	size := 1 << (info - 24)
+	if size > len(d.data)-d.pos {
+		d.err = errCBOR
+		return 0
+	}
+	var n uint64
+	for _, b := range d.data[d.pos : d.pos+size] {
+		n = n<<8 | uint64(b)
+	}
+	d.pos += size
+	return n
+}
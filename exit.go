@@ -0,0 +1,225 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package gapstone
+
+import (
+	"slices"
+	"strings"
+)
+
+// How control leaves a function, see FindExits
+type ExitKind int
+
+const (
+	ExitReturn           ExitKind = iota // ret, retaa, retab
+	ExitReturnThunk                      // jmp __x86_return_thunk and the other return thunks
+	ExitTailCall                         // Direct jump to the start of another function
+	ExitIndirectTailCall                 // Indirect jump, retpoline jmp __x86_indirect_thunk_*, br x16
+	ExitNoreturnCall                     // Call that never comes back: panic, __stack_chk_fail...
+)
+
+func (k ExitKind) String() string {
+	switch k {
+	case ExitReturn:
+		return "return"
+	case ExitReturnThunk:
+		return "return-thunk"
+	case ExitTailCall:
+		return "tail-call"
+	case ExitIndirectTailCall:
+		return "indirect-tail-call"
+	case ExitNoreturnCall:
+		return "noreturn-call"
+	}
+	return "unknown"
+}
+
+// A function exit site.
+type FuncExit struct {
+	Addr        uint64
+	Kind        ExitKind
+	Conditional bool   // A conditional jump to a thunk or another function
+	Target      uint64 // For direct jumps and calls
+	Symbol      string // Of Target, when known
+}
+
+// Return thunks the kernel patches ret into, depending on the mitigation
+var returnThunks = map[string]bool{
+	"__x86_return_thunk":      true,
+	"retbleed_return_thunk":   true,
+	"srso_return_thunk":       true,
+	"srso_alias_return_thunk": true,
+	"call_depth_return_thunk": true,
+}
+
+// Functions known not to return, besides those recognised by what follows
+// the call
+var noreturnFuncs = map[string]bool{
+	"__stack_chk_fail":                   true,
+	"__ubsan_handle_builtin_unreachable": true,
+	"panic":                              true,
+	"do_exit":                            true,
+	"make_task_dead":                     true,
+	"rewind_stack_and_make_dead":         true,
+	"kthread_exit":                       true,
+	"BUG_func":                           true,
+	"__fortify_panic":                    true,
+	"abort":                              true,
+	"exit":                               true,
+	"_exit":                              true,
+}
+
+// Find the sites where control leaves the function in insns, disassembled
+// in order from its start: returns, jumps to return thunks, tail calls
+// (direct jumps to the start of another function, and indirect jumps,
+// through a retpoline or not, but not x86 jumps through an indexed table or
+// marked notrack; on arm64 only br x16 and br x17, as other indirect
+// branches are usually jump tables) and calls that don't return.
+// A call doesn't return when it calls a known noreturn function, is the last
+// instruction, or is followed by a trap or by another symbol. s finds
+// symbols for the targets and may be nil, which leaves only returns,
+// indirect jumps and calls at the end. Needs CS_OPT_DETAIL.
+func FindExits(insns []Instruction, s Symbolizer) []FuncExit {
+	if len(insns) == 0 {
+		return nil
+	}
+	start := uint64(insns[0].Address)
+	last := insns[len(insns)-1]
+	end := uint64(last.Address + last.Size)
+	var fn string
+	if s != nil {
+		if name, off, ok := s.Lookup(start); ok && off == 0 {
+			fn = name
+		}
+	}
+	lookup := func(addr uint64) (string, uint64, bool) {
+		if s == nil {
+			return "", 0, false
+		}
+		return s.Lookup(addr)
+	}
+
+	var exits []FuncExit
+	for i, insn := range insns {
+		flow := insn.Flow()
+		exit := FuncExit{Addr: uint64(insn.Address), Target: flow.Target}
+		if flow.Direct {
+			exit.Symbol, _, _ = lookup(flow.Target)
+		}
+
+		switch flow.Kind {
+		case FlowReturn:
+			if !isReturn(insn) {
+				continue
+			}
+			exit.Kind = ExitReturn
+		case FlowJump, FlowCondJump:
+			exit.Conditional = flow.Kind == FlowCondJump
+			if !flow.Direct {
+				if flow.Kind == FlowCondJump || !isIndirectTailCall(insn) {
+					continue
+				}
+				exit.Kind = ExitIndirectTailCall
+				break
+			}
+			if flow.Target >= start && flow.Target < end {
+				continue
+			}
+			name, off, ok := lookup(flow.Target)
+			switch {
+			case !ok:
+				continue
+			case returnThunks[name]:
+				exit.Kind = ExitReturnThunk
+			case isIndirectThunk(name):
+				exit.Kind = ExitIndirectTailCall
+			case off != 0 || isColdPart(name, fn):
+				// Into the middle of something, or the function's own
+				// .cold part
+				continue
+			default:
+				exit.Kind = ExitTailCall
+			}
+		case FlowCall:
+			if !callNoreturn(insns, i, exit.Symbol, fn, s) {
+				continue
+			}
+			exit.Kind = ExitNoreturnCall
+		default:
+			continue
+		}
+		exits = append(exits, exit)
+	}
+	return exits
+}
+
+// A return to the caller, not an interrupt or exception return.
+func isReturn(insn Instruction) bool {
+	switch {
+	case insn.X86 != nil:
+		return insn.Id == X86_INS_RET
+	case insn.Arm64 != nil:
+		return insn.Id == ARM64_INS_RET || insn.Id == ARM64_INS_RETAA || insn.Id == ARM64_INS_RETAB
+	}
+	return insn.InGroup(CS_GRP_RET)
+}
+
+// An indirect jump that isn't a switch dispatch
+func isIndirectTailCall(insn Instruction) bool {
+	switch {
+	case insn.X86 != nil:
+		// notrack, a ds prefix, is only emitted for jumps through switch
+		// tables, as is jmp [table + reg*8]
+		if slices.Contains(insn.X86.Prefix, X86_PREFIX_DS) {
+			return false
+		}
+		for _, op := range insn.X86.Operands {
+			if op.Type == X86_OP_MEM && op.Mem.Index != X86_REG_INVALID {
+				return false
+			}
+		}
+	case insn.Arm64 != nil:
+		ops := insn.Arm64.Operands
+		return insn.Id == ARM64_INS_BR && len(ops) == 1 && ops[0].Type == ARM64_OP_REG &&
+			(ops[0].Reg == ARM64_REG_X16 || ops[0].Reg == ARM64_REG_X17)
+	}
+	return true
+}
+
+// Retpolines, __x86_indirect_thunk_rax and friends
+func isIndirectThunk(name string) bool {
+	return strings.HasPrefix(name, "__x86_indirect_thunk_") ||
+		strings.HasPrefix(name, "__x86_indirect_jump_thunk_")
+}
+
+// foo.cold or foo.cold.1, split out of fn by the compiler
+func isColdPart(name, fn string) bool {
+	return fn != "" && strings.HasPrefix(name, fn+".cold")
+}
+
+func callNoreturn(insns []Instruction, i int, target, fn string, s Symbolizer) bool {
+	if noreturnFuncs[target] {
+		return true
+	}
+	if i+1 == len(insns) {
+		return true
+	}
+	next := insns[i+1]
+	if next.Flow().Kind == FlowTrap {
+		return true
+	}
+	if s != nil && fn != "" {
+		if name, _, ok := s.Lookup(uint64(next.Address)); ok && name != fn {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package gapstone
+
+import (
+	"reflect"
+	"testing"
+)
+
+var exitSyms = NewSymbolTable([]Symbol{
+	{Name: "foo", Addr: 0x1000, Size: 0x40},
+	{Name: "bar", Addr: 0x2000, Size: 0x10},
+	{Name: "__x86_return_thunk", Addr: 0x3000, Size: 0x10},
+	{Name: "__x86_indirect_thunk_rax", Addr: 0x3100, Size: 0x10},
+	{Name: "__stack_chk_fail", Addr: 0x3200, Size: 0x10},
+	{Name: "foo.cold", Addr: 0x4000, Size: 0x10},
+})
+
+func TestFindExitsX86(t *testing.T) {
+	engine := entryEngine(t, CS_ARCH_X86, CS_MODE_64)
+	defer engine.Close()
+
+	code := "\x85\xff" + // test edi, edi
+		"\x0f\x84\xf8\x0f\x00\x00" + // je bar
+		"\x0f\x85\xf2\x2f\x00\x00" + // jne foo.cold
+		"\x74\x02" + // je 0x1012
+		"\xff\xe0" + // jmp rax
+		"\xe9\xe9\x20\x00\x00" + // jmp __x86_indirect_thunk_rax
+		"\xe8\xe4\x21\x00\x00" + // call __stack_chk_fail
+		"\xe8\xdf\x0f\x00\x00" + // call bar
+		"\xcc" + // int3
+		"\xe8\xd9\x0f\x00\x00" + // call bar
+		"\xc3" + // ret
+		"\xe9\xd3\x1f\x00\x00" + // jmp __x86_return_thunk
+		"\xe9\xd2\x0f\x00\x00" // jmp bar+4
+	insns, err := engine.Disasm([]byte(code), 0x1000, 0)
+	if err != nil {
+		t.Fatalf("Disassembly error: %v", err)
+	}
+	want := []FuncExit{
+		{Addr: 0x1002, Kind: ExitTailCall, Conditional: true, Target: 0x2000, Symbol: "bar"},
+		{Addr: 0x1010, Kind: ExitIndirectTailCall},
+		{Addr: 0x1012, Kind: ExitIndirectTailCall, Target: 0x3100, Symbol: "__x86_indirect_thunk_rax"},
+		{Addr: 0x1017, Kind: ExitNoreturnCall, Target: 0x3200, Symbol: "__stack_chk_fail"},
+		{Addr: 0x101c, Kind: ExitNoreturnCall, Target: 0x2000, Symbol: "bar"},
+		{Addr: 0x1027, Kind: ExitReturn},
+		{Addr: 0x1028, Kind: ExitReturnThunk, Target: 0x3000, Symbol: "__x86_return_thunk"},
+	}
+	if got := FindExits(insns, exitSyms); !reflect.DeepEqual(got, want) {
+		t.Errorf("FindExits:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestFindExitsArm64(t *testing.T) {
+	engine := entryEngine(t, CS_ARCH_ARM64, CS_MODE_ARM)
+	defer engine.Close()
+
+	code := "\xc0\x03\x5f\xd6" + // ret
+		"\xff\x0b\x5f\xd6" + // retaa
+		"\x00\x02\x1f\xd6" + // br x16
+		"\x20\x00\x1f\xd6" + // br x1
+		"\xfc\x03\x00\x14" + // b bar
+		"\xfb\x03\x00\x94" + // bl bar
+		"\x00\x00\x31\xd4" // brk #0x8800
+	insns, err := engine.Disasm([]byte(code), 0x1000, 0)
+	if err != nil {
+		t.Fatalf("Disassembly error: %v", err)
+	}
+	want := []FuncExit{
+		{Addr: 0x1000, Kind: ExitReturn},
+		{Addr: 0x1004, Kind: ExitReturn},
+		{Addr: 0x1008, Kind: ExitIndirectTailCall},
+		{Addr: 0x1010, Kind: ExitTailCall, Target: 0x2000, Symbol: "bar"},
+		{Addr: 0x1014, Kind: ExitNoreturnCall, Target: 0x2000, Symbol: "bar"},
+	}
+	if got := FindExits(insns, exitSyms); !reflect.DeepEqual(got, want) {
+		t.Errorf("FindExits:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestFindExitsNoSymbols(t *testing.T) {
+	engine := entryEngine(t, CS_ARCH_X86, CS_MODE_64)
+	defer engine.Close()
+
+	// jmp rax; call 0x2000
+	insns, err := engine.Disasm([]byte("\xff\xe0\xe8\xf9\x0f\x00\x00"), 0x1000, 0)
+	if err != nil {
+		t.Fatalf("Disassembly error: %v", err)
+	}
+	exits := FindExits(insns, nil)
+	if len(exits) != 2 || exits[0].Kind != ExitIndirectTailCall || exits[1].Kind != ExitNoreturnCall {
+		t.Errorf("FindExits = %+v", exits)
+	}
+}
+
+func TestFindExitsSwitch(t *testing.T) {
+	engine := entryEngine(t, CS_ARCH_X86, CS_MODE_64)
+	defer engine.Close()
+
+	code := "\xff\x24\xc5\x00\x20\x00\x00" + // jmp qword ptr [rax*8 + 0x2000]
+		"\x3e\xff\xe0" + // notrack jmp rax
+		"\xff\x25\xf3\x0f\x00\x00" // jmp qword ptr [rip + 0xff3]
+	insns, err := engine.Disasm([]byte(code), 0x1000, 0)
+	if err != nil {
+		t.Fatalf("Disassembly error: %v", err)
+	}
+	// Only the jump through the GOT leaves the function
+	want := []FuncExit{{Addr: 0x100a, Kind: ExitIndirectTailCall}}
+	if got := FindExits(insns, nil); !reflect.DeepEqual(got, want) {
+		t.Errorf("FindExits = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,132 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package gapstone
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// How many bytes Explore asks the Memory for at a time. Runs of code longer
+// than this are simply decoded in several windows.
+const exploreWindow = 4096
+
+// Result of a recursive-descent disassembly, see Engine.Explore
+type Exploration struct {
+	Instructions []Instruction // Every decoded instruction, sorted by address
+	Functions    []uint64      // Entry points and direct call targets, sorted
+}
+
+// Check if addr falls inside one of the decoded instructions.
+func (x *Exploration) IsCode(addr uint64) bool {
+	i := sort.Search(len(x.Instructions), func(i int) bool {
+		return uint64(x.Instructions[i].Address) > addr
+	})
+	if i == 0 {
+		return false
+	}
+	insn := x.Instructions[i-1]
+	return addr < uint64(insn.Address+insn.Size)
+}
+
+// Disassemble by following control flow from each of the entry points,
+// rather than sweeping linearly, so data embedded in the code (jump tables,
+// padding, literal pools) is never decoded as instructions. Direct branch and
+// call targets are added to the worklist, decoding of a path stops at
+// returns, traps and indirect jumps. Every direct call target that is mapped
+// in mem is reported as a function entry.
+//
+// Flow analysis relies on the decomposer, so CS_OPT_DETAIL must be on.
+// Targets that are not mapped in mem are silently skipped, but every entry
+// point has to be mapped.
+func (e *Engine) Explore(mem Memory, entryPoints []uint64) (*Exploration, error) {
+	for _, ep := range entryPoints {
+		if _, err := mem.ReadAt(ep, 1); err != nil {
+			return nil, fmt.Errorf("entry point 0x%x: %w", ep, err)
+		}
+	}
+
+	var insns []Instruction
+	seen := make(map[uint64]bool)
+	funcs := make(map[uint64]bool)
+	work := slices.Clone(entryPoints)
+	for _, ep := range entryPoints {
+		funcs[ep] = true
+	}
+
+	for len(work) > 0 {
+		addr := work[len(work)-1]
+		work = work[:len(work)-1]
+
+		delay := false // The next instruction is the delay slot ending the run
+		for !seen[addr] {
+			code, err := readContiguous(mem, addr, exploreWindow)
+			if err != nil || len(code) == 0 {
+				break
+			}
+
+			stop := false
+			next := e.disasmIter(code, addr, func(insn *Instruction) bool {
+				if seen[uint64(insn.Address)] {
+					stop = true
+					return false
+				}
+				seen[uint64(insn.Address)] = true
+				insns = append(insns, *insn)
+				if delay {
+					stop = true
+					return false
+				}
+
+				flow := insn.Flow()
+				if flow.Direct {
+					if _, err := mem.ReadAt(flow.Target, 1); err == nil {
+						work = append(work, flow.Target)
+						if flow.Kind == FlowCall {
+							funcs[flow.Target] = true
+						}
+					}
+				}
+				if !flow.FallsThrough() {
+					// The delay slot still runs, decode it before stopping
+					delay = flow.Delay
+					stop = !delay
+				}
+				return !stop
+			})
+
+			// No progress means the bytes at addr don't decode, or the
+			// last instruction is cut off by the end of the mapping.
+			if stop || next == addr {
+				break
+			}
+			addr = next
+		}
+	}
+
+	slices.SortFunc(insns, func(a, b Instruction) int {
+		switch {
+		case a.Address < b.Address:
+			return -1
+		case a.Address > b.Address:
+			return 1
+		}
+		return 0
+	})
+
+	x := &Exploration{Instructions: insns}
+	for f := range funcs {
+		x.Functions = append(x.Functions, f)
+	}
+	slices.Sort(x.Functions)
+	return x, nil
+}
@@ -0,0 +1,133 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package gapstone
+
+import (
+	"slices"
+	"testing"
+)
+
+// call, a conditional branch around four bytes of inline data, and a callee.
+var exploreX86Code = "" +
+	"\xe8\x0b\x00\x00\x00" + // 0x1000: call 0x1010
+	"\x74\x05" + // 0x1005: je 0x100c
+	"\xc3" + // 0x1007: ret
+	"\xff\xff\xff\xff" + // 0x1008: data
+	"\x31\xc0" + // 0x100c: xor eax, eax
+	"\xc3" + // 0x100e: ret
+	"\xcc" + // 0x100f: padding
+	"\x48\x89\xf8" + // 0x1010: mov rax, rdi
+	"\xc3" // 0x1013: ret
+
+func TestExplore(t *testing.T) {
+	engine, err := New(CS_ARCH_X86, CS_MODE_64)
+	if err != nil {
+		t.Fatalf("Failed to initialize engine %v", err)
+	}
+	defer engine.Close()
+	engine.SetOption(CS_OPT_DETAIL, CS_OPT_ON)
+
+	mem := &BytesMemory{Base: 0x1000, Data: []byte(exploreX86Code)}
+	x, err := engine.Explore(mem, []uint64{0x1000})
+	if err != nil {
+		t.Fatalf("Explore failed: %v", err)
+	}
+
+	var addrs []uint
+	for _, insn := range x.Instructions {
+		addrs = append(addrs, insn.Address)
+	}
+	want := []uint{0x1000, 0x1005, 0x1007, 0x100c, 0x100e, 0x1010, 0x1013}
+	if !slices.Equal(addrs, want) {
+		t.Errorf("instructions: want %#x, got %#x", want, addrs)
+	}
+	if !slices.Equal(x.Functions, []uint64{0x1000, 0x1010}) {
+		t.Errorf("functions: want [0x1000 0x1010], got %#x", x.Functions)
+	}
+
+	for addr, code := range map[uint64]bool{
+		0x1001: true,
+		0x1008: false,
+		0x100b: false,
+		0x100c: true,
+		0x100f: false,
+		0x1013: true,
+		0x1014: false,
+	} {
+		if x.IsCode(addr) != code {
+			t.Errorf("IsCode(0x%x): want %v, got %v", addr, code, !code)
+		}
+	}
+
+	if _, err := engine.Explore(mem, []uint64{0x2000}); err == nil {
+		t.Errorf("Explore accepted an unmapped entry point")
+	}
+}
+
+func TestFlow(t *testing.T) {
+	engine, err := New(CS_ARCH_X86, CS_MODE_64)
+	if err != nil {
+		t.Fatalf("Failed to initialize engine %v", err)
+	}
+	defer engine.Close()
+	engine.SetOption(CS_OPT_DETAIL, CS_OPT_ON)
+
+	insns, err := engine.Disasm([]byte(exploreX86Code[:0x10]), 0x1000, 0)
+	if err != nil {
+		t.Fatalf("Disassembly error: %v", err)
+	}
+
+	want := []Flow{
+		{Kind: FlowCall, Target: 0x1010, Direct: true},
+		{Kind: FlowCondJump, Target: 0x100c, Direct: true},
+		{Kind: FlowReturn},
+	}
+	for i, w := range want {
+		assertEqual(t, "flow: want %+v, got %+v", w, insns[i].Flow())
+	}
+}
+
+func TestExploreDelaySlot(t *testing.T) {
+	engine, err := New(CS_ARCH_MIPS, CS_MODE_MIPS32+CS_MODE_BIG_ENDIAN)
+	if err != nil {
+		t.Fatalf("Failed to initialize engine %v", err)
+	}
+	defer engine.Close()
+	engine.SetOption(CS_OPT_DETAIL, CS_OPT_ON)
+
+	code := "\x04\x11\x00\x03" + // 0x1000: bal 0x1010
+		"\x00\x00\x00\x00" + // 0x1004: nop
+		"\x03\xe0\x00\x08" + // 0x1008: jr $ra
+		"\x00\x00\x10\x25" + // 0x100c: move $v0, $zero
+		"\x03\xe0\x00\x08" + // 0x1010: jr $ra
+		"\x24\x02\x00\x01" + // 0x1014: addiu $v0, $zero, 1
+		"\xff\xff\xff\xff" // 0x1018: data
+	mem := &BytesMemory{Base: 0x1000, Data: []byte(code)}
+	x, err := engine.Explore(mem, []uint64{0x1000})
+	if err != nil {
+		t.Fatalf("Explore failed: %v", err)
+	}
+
+	var addrs []uint
+	for _, insn := range x.Instructions {
+		addrs = append(addrs, insn.Address)
+	}
+	want := []uint{0x1000, 0x1004, 0x1008, 0x100c, 0x1010, 0x1014}
+	if !slices.Equal(addrs, want) {
+		t.Errorf("instructions: want %#x, got %#x", want, addrs)
+	}
+
+	// Each jr $ra block ends with its delay slot
+	g := BuildCFG(x.Instructions)
+	if len(g.Blocks) != 2 || g.Blocks[0].End != 0x1010 || len(g.Blocks[0].Succs) != 0 {
+		t.Errorf("blocks: %+v", g.Blocks)
+	}
+}
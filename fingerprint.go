@@ -0,0 +1,148 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package gapstone
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"slices"
+)
+
+// Fuzzy hashes of a function, for matching it across builds. Two builds of
+// the same function usually share most of their Blocks even when some
+// change, and often have the same ShapeHash.
+type Fingerprint struct {
+	Blocks    []uint64 // Hash of each basic block's normalized instructions, sorted
+	BlockHash uint64   // Hash of the Blocks multiset
+	ShapeHash uint64   // Hash of the CFG alone, ignoring the instructions
+	NumBlocks int
+	NumEdges  int
+	NumInsns  int
+}
+
+// Fingerprint the function in insns, disassembled in address order, see
+// BuildCFG and Normalize.
+func FingerprintFunc(insns []Instruction, flags NormalizeFlags) Fingerprint {
+	return BuildCFG(insns).Fingerprint(flags)
+}
+
+// Fingerprint the function of the CFG, normalizing instructions with flags.
+func (g *CFG) Fingerprint(flags NormalizeFlags) Fingerprint {
+	fp := Fingerprint{NumBlocks: len(g.Blocks), NumEdges: g.Edges()}
+	for _, b := range g.Blocks {
+		fp.Blocks = append(fp.Blocks, blockHash(b, flags))
+		fp.NumInsns += len(b.Instructions)
+	}
+	slices.Sort(fp.Blocks)
+	fp.BlockHash = multisetHash(fp.Blocks)
+	fp.ShapeHash = g.shapeHash()
+	return fp
+}
+
+// Hash of the normalized instructions of b
+func blockHash(b BasicBlock, flags NormalizeFlags) uint64 {
+	h := fnv.New64a()
+	for _, insn := range b.Instructions {
+		h.Write([]byte(Normalize(insn, flags)))
+		h.Write([]byte{'\n'})
+	}
+	return h.Sum64()
+}
+
+// Rounds of neighbourhood refinement for the shape hash, each one taking in
+// blocks one edge further away
+const shapeRounds = 3
+
+// Label each block by its degrees and whether it is the entry or an exit,
+// then repeatedly fold in the sorted labels of its successors and
+// predecessors, and hash the resulting multiset of labels.
+func (g *CFG) shapeHash() uint64 {
+	labels := make([]uint64, len(g.Blocks))
+	for i, b := range g.Blocks {
+		labels[i] = hashUint64s(uint64(len(b.Succs)), uint64(len(b.Preds)), boolBit(i == 0), boolBit(len(b.Succs) == 0))
+	}
+	next := make([]uint64, len(labels))
+	for round := 0; round < shapeRounds; round++ {
+		for i, b := range g.Blocks {
+			succs := make([]uint64, 0, len(b.Succs))
+			for _, s := range b.Succs {
+				succs = append(succs, labels[s])
+			}
+			preds := make([]uint64, 0, len(b.Preds))
+			for _, p := range b.Preds {
+				preds = append(preds, labels[p])
+			}
+			slices.Sort(succs)
+			slices.Sort(preds)
+			next[i] = hashUint64s(append(append([]uint64{labels[i], uint64(len(succs))}, succs...), preds...)...)
+		}
+		labels, next = next, labels
+	}
+	return multisetHash(labels)
+}
+
+func boolBit(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func hashUint64s(vs ...uint64) uint64 {
+	h := fnv.New64a()
+	var buf [8]byte
+	for _, v := range vs {
+		binary.LittleEndian.PutUint64(buf[:], v)
+		h.Write(buf[:])
+	}
+	return h.Sum64()
+}
+
+// Order independent hash of a multiset: the sum of the mixed elements
+func multisetHash(vs []uint64) uint64 {
+	var sum uint64
+	for _, v := range vs {
+		sum += mix64(v)
+	}
+	return mix64(sum + uint64(len(vs)))
+}
+
+// The splitmix64 finalizer
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// How much of their basic blocks two fingerprints share, from 0 for nothing
+// to 1 for the same multiset: the Jaccard index of the Blocks multisets.
+func (f Fingerprint) Similarity(o Fingerprint) float64 {
+	if len(f.Blocks) == 0 && len(o.Blocks) == 0 {
+		return 1
+	}
+	common := 0
+	for i, j := 0, 0; i < len(f.Blocks) && j < len(o.Blocks); {
+		switch {
+		case f.Blocks[i] == o.Blocks[j]:
+			common++
+			i++
+			j++
+		case f.Blocks[i] < o.Blocks[j]:
+			i++
+		default:
+			j++
+		}
+	}
+	return float64(common) / float64(len(f.Blocks)+len(o.Blocks)-common)
+}
@@ -0,0 +1,55 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package gapstone
+
+import "testing"
+
+func TestFingerprint(t *testing.T) {
+	engine := entryEngine(t, CS_ARCH_X86, CS_MODE_64)
+	defer engine.Close()
+
+	disasm := func(code string, addr uint64) []Instruction {
+		insns, err := engine.Disasm([]byte(code), addr, 0)
+		if err != nil {
+			t.Fatalf("Disassembly error: %v", err)
+		}
+		return insns
+	}
+	// cfgCode built elsewhere, with ecx and another constant in one arm,
+	// and with the other arm changed too
+	base := disasm(cfgCode, 0x1000)
+	rebuilt := disasm("\x85\xff\x74\x07\xb9\x07\x00\x00\x00\xeb\x05\xb8\x02\x00\x00\x00\xc3", 0x5000)
+	changed := disasm("\x85\xff\x74\x07\xb9\x07\x00\x00\x00\xeb\x05\x31\xc0\x0f\x1f\x00\xc3", 0x5000)
+
+	a := FingerprintFunc(base, NormalizeRegs)
+	b := FingerprintFunc(rebuilt, NormalizeRegs)
+	if a.BlockHash != b.BlockHash || a.ShapeHash != b.ShapeHash || a.Similarity(b) != 1 {
+		t.Errorf("rebuilt function differs:\n%+v\n%+v", a, b)
+	}
+	if a.NumBlocks != 4 || a.NumEdges != 4 || a.NumInsns != 6 {
+		t.Errorf("got %d blocks, %d edges, %d instructions", a.NumBlocks, a.NumEdges, a.NumInsns)
+	}
+
+	// Without NormalizeRegs the mov ecx block differs, 3 blocks of 5
+	if s := FingerprintFunc(base, 0).Similarity(FingerprintFunc(rebuilt, 0)); s != 0.6 {
+		t.Errorf("similarity without NormalizeRegs %v, want 0.6", s)
+	}
+
+	c := FingerprintFunc(changed, NormalizeRegs)
+	if c.BlockHash == a.BlockHash || c.ShapeHash != a.ShapeHash || a.Similarity(c) != 0.6 {
+		t.Errorf("changed function: similarity %v\n%+v\n%+v", a.Similarity(c), a, c)
+	}
+
+	// A straight line function has another shape
+	if s := FingerprintFunc(disasm("\x31\xc0\xc3", 0x1000), 0); s.ShapeHash == a.ShapeHash {
+		t.Error("straight line function has the same shape")
+	}
+}
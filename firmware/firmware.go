@@ -0,0 +1,282 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+// Package firmware loads Intel HEX and Motorola S-record images, the usual
+// distribution format for microcontroller firmware, into a sparse
+// gapstone.Memory at their load addresses.
+package firmware
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/bpfsnoop/gapstone"
+)
+
+var (
+	ErrSyntax   = errors.New("malformed record")
+	ErrChecksum = errors.New("checksum mismatch")
+	ErrOverlap  = errors.New("overlapping data records")
+	ErrFormat   = errors.New("neither Intel HEX nor S-record")
+)
+
+// A firmware image. Contiguous data records are merged into one Region;
+// there is no way to tell code from data, so every Region is rwx.
+type Image struct {
+	gapstone.SegmentedMemory
+	Entry    uint64 // From the start address / termination record
+	HasEntry bool
+	Header   string // S0 record contents, S-records only
+}
+
+type chunk struct {
+	addr uint64
+	data []byte
+}
+
+// Load an image file, telling the format from the first record.
+func Load(name string) (*Image, error) {
+	fd, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	br := bufio.NewReader(fd)
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				err = ErrFormat
+			}
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		switch c {
+		case ' ', '\t', '\r', '\n':
+			continue
+		case ':':
+			br.UnreadByte()
+			return ParseIntelHex(br)
+		case 'S':
+			br.UnreadByte()
+			return ParseSRecord(br)
+		}
+		return nil, fmt.Errorf("%s: %w", name, ErrFormat)
+	}
+}
+
+// Call fn with the hex decoded bytes of every non-empty line of r, until it
+// reports the end record. Each line starts with lead, for S-records the
+// type digit that follows is passed as kind.
+func scanRecords(r io.Reader, lead string, fn func(kind byte, rec []byte) (bool, error)) error {
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" {
+			continue
+		}
+		if !strings.HasPrefix(text, lead) {
+			return fmt.Errorf("line %d: %w", line, ErrSyntax)
+		}
+		body := text[len(lead):]
+		var kind byte
+		if lead == "S" && len(body) > 0 {
+			kind, body = body[0], body[1:]
+		}
+		rec, err := hex.DecodeString(body)
+		if err != nil {
+			return fmt.Errorf("line %d: %w: %v", line, ErrSyntax, err)
+		}
+		done, err := fn(kind, rec)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		if done {
+			return nil
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: no end record", ErrSyntax)
+}
+
+// Parse an Intel HEX image, honouring extended segment (02) and extended
+// linear (04) address records. Record checksums are verified and the image
+// must end with an end of file (01) record.
+func ParseIntelHex(r io.Reader) (*Image, error) {
+	im := &Image{}
+	var chunks []chunk
+	var base uint64
+
+	err := scanRecords(r, ":", func(_ byte, rec []byte) (bool, error) {
+		// LL AAAA TT DD.. CC
+		if len(rec) < 5 || len(rec) != 5+int(rec[0]) {
+			return false, ErrSyntax
+		}
+		var sum byte
+		for _, b := range rec {
+			sum += b
+		}
+		if sum != 0 {
+			return false, ErrChecksum
+		}
+
+		offset := uint64(rec[1])<<8 | uint64(rec[2])
+		data := rec[4 : len(rec)-1]
+		switch typ := rec[3]; typ {
+		case 0x00:
+			if len(data) > 0 {
+				chunks = append(chunks, chunk{base + offset, data})
+			}
+		case 0x01:
+			return true, nil
+		case 0x02, 0x04:
+			if len(data) != 2 {
+				return false, ErrSyntax
+			}
+			base = uint64(data[0])<<8 | uint64(data[1])
+			if typ == 0x02 {
+				base <<= 4
+			} else {
+				base <<= 16
+			}
+		case 0x03:
+			// CS:IP
+			if len(data) != 4 {
+				return false, ErrSyntax
+			}
+			cs := uint64(data[0])<<8 | uint64(data[1])
+			ip := uint64(data[2])<<8 | uint64(data[3])
+			im.Entry, im.HasEntry = cs<<4+ip, true
+		case 0x05:
+			if len(data) != 4 {
+				return false, ErrSyntax
+			}
+			im.Entry = uint64(data[0])<<24 | uint64(data[1])<<16 | uint64(data[2])<<8 | uint64(data[3])
+			im.HasEntry = true
+		default:
+			return false, fmt.Errorf("%w: record type %02x", ErrSyntax, typ)
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Intel HEX: %w", err)
+	}
+	if err := im.mapChunks(chunks); err != nil {
+		return nil, fmt.Errorf("Intel HEX: %w", err)
+	}
+	return im, nil
+}
+
+// Parse a Motorola S-record image (S19, S28 or S37). Record checksums are
+// verified, as is the S5/S6 record count when present. The image must end
+// with an S7, S8 or S9 termination record, which carries the entry point.
+func ParseSRecord(r io.Reader) (*Image, error) {
+	im := &Image{}
+	var chunks []chunk
+	var count uint64
+
+	err := scanRecords(r, "S", func(kind byte, rec []byte) (bool, error) {
+		// CC AA.. DD.. SS, CC counts what follows it
+		if len(rec) < 1 || len(rec) != 1+int(rec[0]) {
+			return false, ErrSyntax
+		}
+		var sum byte
+		for _, b := range rec {
+			sum += b
+		}
+		if sum != 0xff {
+			return false, ErrChecksum
+		}
+
+		var width int
+		switch kind {
+		case '0', '1', '5', '9':
+			width = 2
+		case '2', '6', '8':
+			width = 3
+		case '3', '7':
+			width = 4
+		default:
+			return false, fmt.Errorf("%w: record type S%c", ErrSyntax, kind)
+		}
+		if len(rec) < 2+width {
+			return false, ErrSyntax
+		}
+		var addr uint64
+		for _, b := range rec[1 : 1+width] {
+			addr = addr<<8 | uint64(b)
+		}
+		data := rec[1+width : len(rec)-1]
+
+		switch kind {
+		case '0':
+			im.Header = strings.TrimRight(string(data), "\x00")
+		case '1', '2', '3':
+			count++
+			if len(data) > 0 {
+				chunks = append(chunks, chunk{addr, data})
+			}
+		case '5', '6':
+			if addr != count {
+				return false, fmt.Errorf("%w: record count %d, want %d", ErrSyntax, addr, count)
+			}
+		case '7', '8', '9':
+			im.Entry, im.HasEntry = addr, true
+			return true, nil
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("S-record: %w", err)
+	}
+	if err := im.mapChunks(chunks); err != nil {
+		return nil, fmt.Errorf("S-record: %w", err)
+	}
+	return im, nil
+}
+
+// Merge the data records into contiguous blocks and map them.
+func (im *Image) mapChunks(chunks []chunk) error {
+	sort.SliceStable(chunks, func(i, j int) bool {
+		return chunks[i].addr < chunks[j].addr
+	})
+
+	var blocks []chunk
+	for _, c := range chunks {
+		if n := len(blocks); n > 0 {
+			last := &blocks[n-1]
+			end := last.addr + uint64(len(last.data))
+			if c.addr < end {
+				return fmt.Errorf("%w at 0x%x", ErrOverlap, c.addr)
+			}
+			if c.addr == end {
+				last.data = append(last.data, c.data...)
+				continue
+			}
+		}
+		blocks = append(blocks, chunk{c.addr, append([]byte(nil), c.data...)})
+	}
+
+	for _, b := range blocks {
+		mem := gapstone.NewBytesMemory(b.addr, b.data, gapstone.PermRead|gapstone.PermWrite|gapstone.PermExec)
+		if err := im.Map(mem); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package firmware
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/bpfsnoop/gapstone"
+)
+
+// Both images hold push rbp; mov rax, [rip + 0x13b8]; ret, made with
+// objcopy -I binary. code.hex straddles a 64k boundary so it needs two
+// extended linear address records.
+
+func TestIntelHex(t *testing.T) {
+	im, err := Load("testdata/code.hex")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	regions := im.Regions()
+	if len(regions) != 1 || regions[0].Start != 0x0800fffc || regions[0].Size != 9 {
+		t.Fatalf("want 9 bytes at 0x800fffc, got %+v", regions)
+	}
+	if !im.HasEntry || im.Entry != 0x1001fffc {
+		t.Errorf("want entry 0x1001fffc, got 0x%x (%v)", im.Entry, im.HasEntry)
+	}
+
+	engine, err := gapstone.New(gapstone.CS_ARCH_X86, gapstone.CS_MODE_64)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer engine.Close()
+	insns, err := engine.DisasmRange(im, 0x0800fffc, 0x08010005)
+	if err != nil {
+		t.Fatalf("DisasmRange failed: %v", err)
+	}
+	if len(insns) != 3 || insns[1].Address != 0x0800fffd || insns[2].Mnemonic != "ret" {
+		t.Errorf("want push; mov; ret, got %v", insns)
+	}
+}
+
+func TestSRecord(t *testing.T) {
+	im, err := Load("testdata/code.s19")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	regions := im.Regions()
+	if len(regions) != 1 || regions[0].Start != 0x1000 || regions[0].Size != 9 {
+		t.Fatalf("want 9 bytes at 0x1000, got %+v", regions)
+	}
+	if im.Header != "code.s19" || im.Entry != 0x2000 {
+		t.Errorf("want header code.s19 and entry 0x2000, got %q 0x%x", im.Header, im.Entry)
+	}
+	data, err := im.ReadAt(0x1008, 1)
+	if err != nil || len(data) != 1 || data[0] != 0xc3 {
+		t.Errorf("want ret at 0x1008, got %x (%v)", data, err)
+	}
+}
+
+func TestBadRecords(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		srec  bool
+		want  error
+	}{
+		{"hex checksum", ":0100000055AB\n:00000001FF\n", false, ErrChecksum},
+		{"hex length", ":0200000055AA\n:00000001FF\n", false, ErrSyntax},
+		{"hex no eof", ":0100000055AA\n", false, ErrSyntax},
+		{"hex overlap", ":02000000554861\n:0100010048B6\n:00000001FF\n", false, ErrOverlap},
+		{"hex garbage", "hello\n", false, ErrSyntax},
+		{"srec checksum", "S104100055A5\nS9030000FC\n", true, ErrChecksum},
+		{"srec count", "S10410005596\nS5030002FA\nS9030000FC\n", true, ErrSyntax},
+		{"srec type", "S40410005596\nS9030000FC\n", true, ErrSyntax},
+		{"srec no end", "S10410005596\n", true, ErrSyntax},
+	}
+	for _, tt := range tests {
+		var err error
+		if tt.srec {
+			_, err = ParseSRecord(strings.NewReader(tt.input))
+		} else {
+			_, err = ParseIntelHex(strings.NewReader(tt.input))
+		}
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: want %v, got %v", tt.name, tt.want, err)
+		}
+	}
+
+	im, err := ParseSRecord(strings.NewReader("S10410005596\nS5030001FB\nS9030000FC\n"))
+	if err != nil || len(im.Regions()) != 1 {
+		t.Errorf("valid S-record with count: %v", err)
+	}
+}
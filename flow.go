@@ -0,0 +1,307 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package gapstone
+
+// How an instruction transfers control, see Instruction.Flow
+type FlowKind int
+
+const (
+	FlowNone     FlowKind = iota // Falls through to the next instruction
+	FlowJump                     // Unconditional jump
+	FlowCondJump                 // Conditional jump, falls through when not taken
+	FlowCall                     // Call, returns to the next instruction
+	FlowReturn                   // Return to the caller (including interrupt returns)
+	FlowTrap                     // Never falls through: ud2, hlt, brk and friends
+)
+
+func (k FlowKind) String() string {
+	switch k {
+	case FlowNone:
+		return "none"
+	case FlowJump:
+		return "jump"
+	case FlowCondJump:
+		return "condjump"
+	case FlowCall:
+		return "call"
+	case FlowReturn:
+		return "return"
+	case FlowTrap:
+		return "trap"
+	}
+	return "unknown"
+}
+
+// Control flow summary of a single Instruction.
+type Flow struct {
+	Kind   FlowKind
+	Target uint64 // Branch or call target, only valid when Direct is set
+	Direct bool   // The target is encoded in the instruction itself
+	Delay  bool   // The next instruction, the delay slot, runs before the transfer
+}
+
+// Does the instruction fall through to the one that follows it?
+func (f Flow) FallsThrough() bool {
+	switch f.Kind {
+	case FlowJump, FlowReturn, FlowTrap:
+		return false
+	}
+	return true
+}
+
+// Check if the instruction belongs to a *_GRP_* group.
+func (insn Instruction) InGroup(grp uint) bool {
+	for _, g := range insn.Groups {
+		if g == grp {
+			return true
+		}
+	}
+	return false
+}
+
+// Classify the instruction for control flow purposes. The generic CS_GRP_*
+// groups are refined per arch, so this needs CS_OPT_DETAIL to be turned on;
+// without it every instruction reports FlowNone.
+func (insn Instruction) Flow() Flow {
+	var f Flow
+	switch {
+	case insn.X86 != nil:
+		f.Kind = x86FlowKind(insn)
+		f.Target, f.Direct = x86BranchTarget(insn)
+	case insn.Arm64 != nil:
+		f.Kind = arm64FlowKind(insn)
+		f.Target, f.Direct = arm64BranchTarget(insn)
+	case insn.Arm != nil:
+		f.Kind = armFlowKind(insn)
+		f.Target, f.Direct = armBranchTarget(insn)
+	case insn.Mips != nil:
+		f.Kind = mipsFlowKind(insn)
+		f.Target, f.Direct = mipsBranchTarget(insn)
+		f.Delay = f.Kind != FlowNone && mipsHasDelaySlot(insn)
+	case insn.PPC != nil:
+		f.Kind = ppcFlowKind(insn)
+		f.Target, f.Direct = ppcBranchTarget(insn)
+	case insn.Sparc != nil:
+		f.Kind = sparcFlowKind(insn)
+		f.Target, f.Direct = sparcBranchTarget(insn)
+		// Annulled branches skip the delay slot, when not taken for the
+		// conditional ones
+		f.Delay = f.Kind != FlowNone && f.Kind != FlowTrap && insn.Sparc.Hint&SPARC_HINT_A == 0
+	case insn.SysZ != nil:
+		f.Kind = genericFlowKind(insn)
+		f.Target, f.Direct = syszBranchTarget(insn)
+	default:
+		f.Kind = genericFlowKind(insn)
+	}
+	if f.Kind == FlowNone || f.Kind == FlowReturn || f.Kind == FlowTrap {
+		f.Target, f.Direct = 0, false
+	}
+	return f
+}
+
+func genericFlowKind(insn Instruction) FlowKind {
+	switch {
+	case insn.InGroup(CS_GRP_RET), insn.InGroup(CS_GRP_IRET):
+		return FlowReturn
+	case insn.InGroup(CS_GRP_CALL):
+		return FlowCall
+	case insn.InGroup(CS_GRP_JUMP):
+		// Without arch knowledge assume the branch may fall through, which
+		// is the safe choice for anything walking the code.
+		return FlowCondJump
+	}
+	return FlowNone
+}
+
+func x86FlowKind(insn Instruction) FlowKind {
+	switch insn.Id {
+	case X86_INS_UD2, X86_INS_HLT, X86_INS_INT3:
+		return FlowTrap
+	case X86_INS_JMP, X86_INS_LJMP:
+		return FlowJump
+	}
+	return genericFlowKind(insn)
+}
+
+func x86BranchTarget(insn Instruction) (uint64, bool) {
+	ops := insn.X86.Operands
+	if len(ops) == 1 && ops[0].Type == X86_OP_IMM {
+		return uint64(ops[0].Imm), true
+	}
+	return 0, false
+}
+
+func arm64FlowKind(insn Instruction) FlowKind {
+	switch insn.Id {
+	case ARM64_INS_BRK, ARM64_INS_UDF, ARM64_INS_HLT:
+		return FlowTrap
+	case ARM64_INS_RET, ARM64_INS_RETAA, ARM64_INS_RETAB, ARM64_INS_ERET:
+		return FlowReturn
+	case ARM64_INS_BR, ARM64_INS_BRAA, ARM64_INS_BRAAZ, ARM64_INS_BRAB, ARM64_INS_BRABZ:
+		return FlowJump
+	case ARM64_INS_B:
+		if insn.Arm64.CC == ARM64_CC_INVALID || insn.Arm64.CC == ARM64_CC_AL {
+			return FlowJump
+		}
+		return FlowCondJump
+	}
+	return genericFlowKind(insn)
+}
+
+func arm64BranchTarget(insn Instruction) (uint64, bool) {
+	ops := insn.Arm64.Operands
+	if len(ops) > 0 && ops[len(ops)-1].Type == ARM64_OP_IMM {
+		return uint64(ops[len(ops)-1].Imm), true
+	}
+	return 0, false
+}
+
+func armFlowKind(insn Instruction) FlowKind {
+	arm := insn.Arm
+	always := arm.CC == ARM_CC_INVALID || arm.CC == ARM_CC_AL
+	writesPC := false
+	for _, op := range arm.Operands {
+		if op.Type == ARM_OP_REG && op.Reg == ARM_REG_PC && op.Access&CS_AC_WRITE != 0 {
+			writesPC = true
+		}
+	}
+
+	switch insn.Id {
+	case ARM_INS_UDF:
+		return FlowTrap
+	case ARM_INS_BL, ARM_INS_BLX:
+		return FlowCall
+	case ARM_INS_BX:
+		if len(arm.Operands) == 1 && arm.Operands[0].Reg == ARM_REG_LR && always {
+			return FlowReturn
+		}
+	case ARM_INS_POP, ARM_INS_LDM:
+		if writesPC {
+			if always {
+				return FlowReturn
+			}
+			return FlowCondJump
+		}
+	}
+
+	if insn.InGroup(CS_GRP_CALL) {
+		return FlowCall
+	}
+	if insn.InGroup(CS_GRP_JUMP) || writesPC {
+		if always {
+			return FlowJump
+		}
+		return FlowCondJump
+	}
+	return FlowNone
+}
+
+func armBranchTarget(insn Instruction) (uint64, bool) {
+	ops := insn.Arm.Operands
+	if len(ops) > 0 && ops[len(ops)-1].Type == ARM_OP_IMM {
+		return uint64(uint32(ops[len(ops)-1].Imm)), true
+	}
+	return 0, false
+}
+
+func mipsFlowKind(insn Instruction) FlowKind {
+	ops := insn.Mips.Operands
+	switch insn.Id {
+	case MIPS_INS_JR:
+		if len(ops) == 1 && ops[0].Type == MIPS_OP_REG && ops[0].Reg == MIPS_REG_RA {
+			return FlowReturn
+		}
+		return FlowJump
+	case MIPS_INS_J, MIPS_INS_B:
+		return FlowJump
+	case MIPS_INS_JAL, MIPS_INS_JALR, MIPS_INS_BAL:
+		return FlowCall
+	}
+	return genericFlowKind(insn)
+}
+
+// Everything but the R6 and microMIPS compact branches and the exception
+// returns has a delay slot
+func mipsHasDelaySlot(insn Instruction) bool {
+	switch insn.Id {
+	case MIPS_INS_ERET, MIPS_INS_DERET,
+		MIPS_INS_BC, MIPS_INS_BALC, MIPS_INS_JIC, MIPS_INS_JIALC, MIPS_INS_JRC, MIPS_INS_JALRC,
+		MIPS_INS_BEQC, MIPS_INS_BNEC, MIPS_INS_BGEC, MIPS_INS_BGEUC, MIPS_INS_BLTC, MIPS_INS_BLTUC,
+		MIPS_INS_BEQZC, MIPS_INS_BNEZC, MIPS_INS_BGEZC, MIPS_INS_BGTZC, MIPS_INS_BLEZC, MIPS_INS_BLTZC,
+		MIPS_INS_BEQZALC, MIPS_INS_BNEZALC, MIPS_INS_BGEZALC, MIPS_INS_BGTZALC, MIPS_INS_BLEZALC,
+		MIPS_INS_BLTZALC, MIPS_INS_BNVC, MIPS_INS_BOVC:
+		return false
+	}
+	return true
+}
+
+func mipsBranchTarget(insn Instruction) (uint64, bool) {
+	ops := insn.Mips.Operands
+	if len(ops) > 0 && ops[len(ops)-1].Type == MIPS_OP_IMM {
+		return uint64(ops[len(ops)-1].Imm), true
+	}
+	return 0, false
+}
+
+func ppcFlowKind(insn Instruction) FlowKind {
+	switch insn.Id {
+	case PPC_INS_TRAP:
+		return FlowTrap
+	case PPC_INS_BLR:
+		return FlowReturn
+	case PPC_INS_B, PPC_INS_BA, PPC_INS_BCTR:
+		return FlowJump
+	case PPC_INS_BL, PPC_INS_BLA, PPC_INS_BCTRL:
+		return FlowCall
+	}
+	return genericFlowKind(insn)
+}
+
+func ppcBranchTarget(insn Instruction) (uint64, bool) {
+	ops := insn.PPC.Operands
+	if len(ops) > 0 && ops[len(ops)-1].Type == PPC_OP_IMM {
+		return uint64(ops[len(ops)-1].Imm), true
+	}
+	return 0, false
+}
+
+func sparcFlowKind(insn Instruction) FlowKind {
+	switch insn.Id {
+	case SPARC_INS_RET, SPARC_INS_RETL:
+		return FlowReturn
+	case SPARC_INS_CALL:
+		return FlowCall
+	case SPARC_INS_JMP:
+		return FlowJump
+	case SPARC_INS_B:
+		if insn.Sparc.CC == SPARC_CC_ICC_A {
+			return FlowJump
+		}
+		return FlowCondJump
+	}
+	return genericFlowKind(insn)
+}
+
+func sparcBranchTarget(insn Instruction) (uint64, bool) {
+	ops := insn.Sparc.Operands
+	if len(ops) > 0 && ops[len(ops)-1].Type == SPARC_OP_IMM {
+		return uint64(ops[len(ops)-1].Imm), true
+	}
+	return 0, false
+}
+
+func syszBranchTarget(insn Instruction) (uint64, bool) {
+	ops := insn.SysZ.Operands
+	if len(ops) > 0 && ops[len(ops)-1].Type == SYSZ_OP_IMM {
+		return uint64(ops[len(ops)-1].Imm), true
+	}
+	return 0, false
+}
@@ -0,0 +1,313 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+// Package godis disassembles Go programs, recovering function boundaries,
+// names and line numbers from the pclntab the runtime needs for stack
+// traces. Unlike .symtab the pclntab survives stripping.
+package godis
+
+import (
+	"bytes"
+	"debug/gosym"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/bpfsnoop/gapstone"
+	"github.com/bpfsnoop/gapstone/elfdis"
+	"github.com/bpfsnoop/gapstone/machodis"
+)
+
+var (
+	ErrNoPclntab = errors.New("no Go pclntab")
+	ErrNoFunc    = errors.New("function not found")
+	ErrFormat    = errors.New("not an ELF or Mach-O file")
+)
+
+// pclntab header magic
+const (
+	go118Magic = 0xfffffff0
+	go120Magic = 0xfffffff1
+)
+
+// A Go function, covering [Entry, End).
+type Func struct {
+	Name  string
+	Entry uint64
+	End   uint64
+}
+
+// Function and line lookups over a pclntab.
+type Table struct {
+	table *gosym.Table
+	funcs []Func // Sorted by Entry
+}
+
+// Parse a pclntab. text is the address of runtime.text, which is where the
+// text section starts.
+func NewTable(pclntab []byte, text uint64) (*Table, error) {
+	table, err := gosym.NewTable(nil, gosym.NewLineTable(pclntab, text))
+	if err != nil {
+		return nil, err
+	}
+	if len(table.Funcs) == 0 {
+		return nil, ErrNoPclntab
+	}
+
+	t := &Table{table: table, funcs: make([]Func, 0, len(table.Funcs))}
+	for _, fn := range table.Funcs {
+		t.funcs = append(t.funcs, Func{Name: fn.Name, Entry: fn.Entry, End: fn.End})
+	}
+	sort.SliceStable(t.funcs, func(i, j int) bool {
+		return t.funcs[i].Entry < t.funcs[j].Entry
+	})
+	return t, nil
+}
+
+// Every function, sorted by entry address.
+func (t *Table) Funcs() []Func { return t.funcs }
+
+// Find a function by its full name, eg. "main.main" or
+// "net/http.(*Server).Serve".
+func (t *Table) LookupFunc(name string) (Func, error) {
+	fn := t.table.LookupFunc(name)
+	if fn == nil {
+		return Func{}, fmt.Errorf("%w: %s", ErrNoFunc, name)
+	}
+	return Func{Name: fn.Name, Entry: fn.Entry, End: fn.End}, nil
+}
+
+// Map an address back to the function covering it, which makes a Table a
+// gapstone.Symbolizer.
+func (t *Table) Lookup(addr uint64) (string, uint64, bool) {
+	i := sort.Search(len(t.funcs), func(i int) bool {
+		return t.funcs[i].Entry > addr
+	})
+	if i == 0 || addr >= t.funcs[i-1].End {
+		return "", 0, false
+	}
+	fn := t.funcs[i-1]
+	return fn.Name, addr - fn.Entry, true
+}
+
+// The source position of addr. Code inlined into a function is reported
+// at the call site, the pclntab exposed by debug/gosym has no inline tree.
+func (t *Table) LineInfo(addr uint64) (file string, line int, fn string, ok bool) {
+	file, line, f := t.table.PCToLine(addr)
+	if f == nil {
+		return "", 0, "", false
+	}
+	return file, line, f.Name, true
+}
+
+// An instruction together with its Go function and source position.
+type Instruction struct {
+	gapstone.Instruction
+	Func string
+	File string
+	Line int
+}
+
+// Attach function names and source positions to insns.
+func (t *Table) Annotate(insns []gapstone.Instruction) []Instruction {
+	out := make([]Instruction, len(insns))
+	for i, insn := range insns {
+		out[i].Instruction = insn
+		out[i].File, out[i].Line, out[i].Func, _ = t.LineInfo(uint64(insn.Address))
+	}
+	return out
+}
+
+// The parts of an elfdis or machodis File that disassembling needs.
+type loader interface {
+	Engine() *gapstone.Engine
+	Memory() gapstone.Memory
+	Close() error
+}
+
+// A Go executable, ELF or Mach-O, opened for disassembly.
+type File struct {
+	bin   loader
+	table *Table
+}
+
+// Open the named Go executable.
+func Open(name string) (*File, error) {
+	fd, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	magic := make([]byte, 4)
+	_, err = io.ReadFull(fd, magic)
+	fd.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	f := &File{}
+	var pclntab []byte
+	var text uint64
+	switch {
+	case bytes.Equal(magic, []byte("\x7fELF")):
+		var ef *elfdis.File
+		if ef, err = elfdis.Open(name); err != nil {
+			return nil, err
+		}
+		f.bin = ef
+		pclntab, text, err = elfPclntab(ef)
+	case isMacho(magic):
+		var mf *machodis.File
+		if mf, err = machodis.Open(name); err != nil {
+			return nil, err
+		}
+		f.bin = mf
+		pclntab, text, err = machoPclntab(mf)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrFormat, name)
+	}
+	if err == nil {
+		f.table, err = NewTable(pclntab, text)
+	}
+	if err != nil {
+		f.bin.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func isMacho(magic []byte) bool {
+	switch m := uint32(magic[0])<<24 | uint32(magic[1])<<16 | uint32(magic[2])<<8 | uint32(magic[3]); m {
+	case 0xfeedface, 0xfeedfacf, 0xcefaedfe, 0xcffaedfe, 0xcafebabe:
+		return true
+	}
+	return false
+}
+
+func elfPclntab(f *elfdis.File) ([]byte, uint64, error) {
+	text := f.ELF().Section(".text")
+	if text == nil {
+		return nil, 0, ErrNoPclntab
+	}
+	data, err := elfPclntabData(f)
+	if err != nil {
+		return nil, 0, err
+	}
+	if sym, err := f.LookupSymbol("runtime.text"); err == nil {
+		return data, sym.Addr, nil
+	}
+	return data, textStart(data, text.Addr), nil
+}
+
+// PIE and relro builds name the section .data.rel.ro.gopclntab, and external
+// linking can merge it into .data.rel.ro, leaving only the runtime.pclntab
+// and runtime.epclntab symbols to find it by.
+func elfPclntabData(f *elfdis.File) ([]byte, error) {
+	for _, name := range []string{".gopclntab", ".data.rel.ro.gopclntab"} {
+		if sec := f.ELF().Section(name); sec != nil {
+			return sec.Data()
+		}
+	}
+	start, err := f.LookupSymbol("runtime.pclntab")
+	if err != nil {
+		return nil, ErrNoPclntab
+	}
+	end, err := f.LookupSymbol("runtime.epclntab")
+	if err != nil || end.Addr <= start.Addr {
+		return nil, ErrNoPclntab
+	}
+	size := int(end.Addr - start.Addr)
+	data, err := f.Memory().ReadAt(start.Addr, size)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < size {
+		return nil, fmt.Errorf("%w: runtime.pclntab cut short at 0x%x", ErrNoPclntab, start.Addr+uint64(len(data)))
+	}
+	return data, nil
+}
+
+func machoPclntab(f *machodis.File) ([]byte, uint64, error) {
+	mf := f.Macho()
+	sec, text := mf.Section("__gopclntab"), mf.Section("__text")
+	if sec == nil || text == nil {
+		return nil, 0, ErrNoPclntab
+	}
+	data, err := sec.Data()
+	if err != nil {
+		return nil, 0, err
+	}
+	if sym, err := f.LookupSymbol("runtime.text"); err == nil {
+		return data, sym.Addr, nil
+	}
+	return data, textStart(data, text.Addr), nil
+}
+
+// Address of runtime.text for a stripped binary. With external linking C
+// code may come first in the text section, so the Go 1.18+ header field is
+// preferred. PIE leaves it to a dynamic relocation, reading as 0.
+func textStart(pclntab []byte, text uint64) uint64 {
+	if len(pclntab) < 8 {
+		return text
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	magic := order.Uint32(pclntab)
+	if magic != go118Magic && magic != go120Magic {
+		order = binary.BigEndian
+		if magic = order.Uint32(pclntab); magic != go118Magic && magic != go120Magic {
+			return text
+		}
+	}
+
+	ptrSize := int(pclntab[7])
+	off := 8 + 2*ptrSize
+	if len(pclntab) < off+ptrSize {
+		return text
+	}
+	var start uint64
+	switch ptrSize {
+	case 4:
+		start = uint64(order.Uint32(pclntab[off:]))
+	case 8:
+		start = order.Uint64(pclntab[off:])
+	}
+	if start == 0 {
+		return text
+	}
+	return start
+}
+
+// Close the underlying loader.
+func (f *File) Close() error { return f.bin.Close() }
+
+// The function and line table
+func (f *File) Table() *Table { return f.table }
+
+// The Engine picked by the loader for the executable's machine.
+func (f *File) Engine() *gapstone.Engine { return f.bin.Engine() }
+
+// The executable's sections, at their addresses.
+func (f *File) Memory() gapstone.Memory { return f.bin.Memory() }
+
+// Map an address back to its Go function, which makes a File a
+// gapstone.Symbolizer.
+func (f *File) Lookup(addr uint64) (string, uint64, bool) { return f.table.Lookup(addr) }
+
+// Disassemble the Go function called name, with source positions.
+func (f *File) DisasmFunc(name string) ([]Instruction, error) {
+	fn, err := f.table.LookupFunc(name)
+	if err != nil {
+		return nil, err
+	}
+	insns, err := f.Engine().DisasmRange(f.Memory(), fn.Entry, fn.End)
+	return f.table.Annotate(insns), err
+}
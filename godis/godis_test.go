@@ -0,0 +1,128 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package godis
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// The test binary is a Go program itself, and linked externally because of
+// cgo, which makes a good fixture.
+func TestDisasmFunc(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Skip(err)
+	}
+	f, err := Open(exe)
+	if errors.Is(err, ErrFormat) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	const name = "github.com/bpfsnoop/gapstone/godis.TestDisasmFunc"
+	fn, err := f.Table().LookupFunc(name)
+	if err != nil {
+		t.Fatalf("LookupFunc failed: %v", err)
+	}
+	if got, off, ok := f.Lookup(fn.Entry + 1); !ok || got != name || off != 1 {
+		t.Errorf("Lookup: want %s+0x1, got %s+0x%x (%v)", name, got, off, ok)
+	}
+
+	insns, err := f.DisasmFunc(name)
+	if err != nil {
+		t.Fatalf("DisasmFunc failed: %v", err)
+	}
+	if len(insns) == 0 {
+		t.Fatal("no instructions")
+	}
+	for _, insn := range insns {
+		if filepath.Base(insn.File) != "godis_test.go" || insn.Line == 0 {
+			t.Errorf("0x%x: want a line in godis_test.go, got %s:%d", insn.Address, insn.File, insn.Line)
+			break
+		}
+	}
+	if insns[0].Func != name {
+		t.Errorf("want %s, got %s", name, insns[0].Func)
+	}
+
+	if _, err := f.Table().LookupFunc("main.nonexistent"); !errors.Is(err, ErrNoFunc) {
+		t.Errorf("want ErrNoFunc, got %v", err)
+	}
+}
+
+func TestOpenPIE(t *testing.T) {
+	gobin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip(err)
+	}
+	objcopy, err := exec.LookPath("objcopy")
+	if err != nil {
+		t.Skip(err)
+	}
+	dir := t.TempDir()
+	pie := filepath.Join(dir, "pie")
+	build := exec.Command(gobin, "build", "-buildmode=pie", "-ldflags=-w", "-o", pie, "testdata/pie/main.go")
+	build.Env = append(os.Environ(), "GOOS=linux", "CGO_ENABLED=0")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Skipf("go build: %v\n%s", err, out)
+	}
+
+	// Found by section name, then by the runtime.pclntab symbols
+	for i, sec := range []string{".gopclntab", ".data.rel.ro.gopclntab", ".data.rel.ro"} {
+		bin := pie
+		if i > 0 {
+			bin = filepath.Join(dir, sec)
+			rename := exec.Command(objcopy, "--rename-section", ".gopclntab="+sec, pie, bin)
+			if out, err := rename.CombinedOutput(); err != nil {
+				t.Fatalf("objcopy: %v\n%s", err, out)
+			}
+		}
+		f, err := Open(bin)
+		if err != nil {
+			t.Errorf("%s: Open failed: %v", sec, err)
+			continue
+		}
+		if _, err := f.Table().LookupFunc("main.main"); err != nil {
+			t.Errorf("%s: LookupFunc failed: %v", sec, err)
+		}
+		f.Close()
+	}
+}
+
+func TestTextStart(t *testing.T) {
+	hdr := make([]byte, 40)
+	binary.LittleEndian.PutUint32(hdr, go120Magic)
+	hdr[6], hdr[7] = 1, 8
+	if got := textStart(hdr, 0x401000); got != 0x401000 {
+		t.Errorf("unrelocated header: want .text 0x401000, got 0x%x", got)
+	}
+	binary.LittleEndian.PutUint64(hdr[24:], 0x402300)
+	if got := textStart(hdr, 0x401000); got != 0x402300 {
+		t.Errorf("want runtime.text 0x402300, got 0x%x", got)
+	}
+	if got := textStart([]byte("not a pclntab"), 0x401000); got != 0x401000 {
+		t.Errorf("bad magic: want 0x401000, got 0x%x", got)
+	}
+}
+
+func TestOpenFormat(t *testing.T) {
+	if _, err := Open("godis_test.go"); !errors.Is(err, ErrFormat) {
+		t.Errorf("want ErrFormat, got %v", err)
+	}
+}
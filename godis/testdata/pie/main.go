@@ -0,0 +1,5 @@
+// Source of the PIE TestOpenPIE builds. The test renames its pclntab section
+// with objcopy the way relro builds and external linking leave it.
+package main
+
+func main() {}
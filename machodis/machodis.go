@@ -0,0 +1,358 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+// Package machodis disassembles Mach-O executables, dylibs, objects and
+// universal binaries, picking the Engine arch and mode from the CPU type.
+package machodis
+
+import (
+	"debug/macho"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/bpfsnoop/gapstone"
+)
+
+var (
+	ErrNoSymbol  = errors.New("symbol not found")
+	ErrNoSection = errors.New("section not found")
+	ErrMachine   = errors.New("unsupported Mach-O CPU")
+)
+
+// Not defined by debug/macho
+const (
+	nStab        = 0xe0
+	nType        = 0x0e
+	nSect        = 0x0e
+	nExt         = 0x01
+	nArmThumbDef = 0x0008
+
+	sectionType          = 0xff
+	sZerofill            = 0x01
+	sGBZerofill          = 0x0c
+	sThreadLocalZerofill = 0x12
+	sAttrInstructions    = 0x80000400 // S_ATTR_PURE_INSTRUCTIONS | S_ATTR_SOME_INSTRUCTIONS
+
+	vmProtRead    = 1
+	vmProtWrite   = 2
+	vmProtExecute = 4
+)
+
+// A symbol defined in a section. Mach-O symbols carry no size, so a symbol
+// extends to the next one in its section, or the end of the section.
+type Symbol struct {
+	Name     string // As in the symbol table, with the leading '_' of C names
+	Addr     uint64
+	Size     uint64
+	Exported bool // N_EXT
+	Thumb    bool // ARM function marked N_ARM_THUMB_DEF
+}
+
+// A Mach-O file, or one architecture of a universal binary, opened for
+// disassembly.
+type File struct {
+	macho   *macho.File
+	closer  io.Closer
+	engine  gapstone.Engine
+	thumb   *gapstone.Engine
+	mem     gapstone.SegmentedMemory
+	symbols []Symbol // Sorted by address
+	byName  map[string]Symbol
+}
+
+// Open the named Mach-O file for disassembly, see NewFile.
+func Open(name string) (*File, error) {
+	fd, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := NewFile(fd)
+	if err != nil {
+		fd.Close()
+		return nil, err
+	}
+	f.closer = fd
+	return f, nil
+}
+
+// Create a File from a Mach-O image. For a universal binary the first
+// architecture with a supported CPU is used, see NewFileCpu to pick one.
+// The Engine is created with CS_OPT_DETAIL turned on.
+func NewFile(r io.ReaderAt) (*File, error) {
+	return NewFileCpu(r, 0)
+}
+
+// Create a File from the cpu architecture of a universal binary, or from a
+// thin Mach-O image for cpu. A cpu of 0 accepts any supported CPU.
+func NewFileCpu(r io.ReaderAt, cpu macho.Cpu) (*File, error) {
+	var mf *macho.File
+	ff, err := macho.NewFatFile(r)
+	switch {
+	case err == nil:
+		for _, fa := range ff.Arches {
+			if _, _, err := ArchMode(fa.Cpu); err == nil && (cpu == 0 || fa.Cpu == cpu) {
+				mf = fa.File
+				break
+			}
+		}
+		if mf == nil {
+			return nil, fmt.Errorf("%w: no matching architecture in universal binary", ErrMachine)
+		}
+	case errors.Is(err, macho.ErrNotFat):
+		if mf, err = macho.NewFile(r); err != nil {
+			return nil, err
+		}
+		if cpu != 0 && mf.Cpu != cpu {
+			return nil, fmt.Errorf("%w: %v", ErrMachine, mf.Cpu)
+		}
+	default:
+		return nil, err
+	}
+
+	arch, mode, err := ArchMode(mf.Cpu)
+	if err != nil {
+		return nil, err
+	}
+	engine, err := gapstone.New(arch, mode)
+	if err != nil {
+		return nil, err
+	}
+	if err := engine.SetOption(gapstone.CS_OPT_DETAIL, gapstone.CS_OPT_ON); err != nil {
+		engine.Close()
+		return nil, err
+	}
+
+	f := &File{macho: mf, engine: engine}
+	f.layout()
+	f.loadSymbols()
+	return f, nil
+}
+
+// Pick the Engine arch and mode for a Mach-O CPU type.
+func ArchMode(cpu macho.Cpu) (arch, mode int, err error) {
+	switch cpu {
+	case macho.CpuAmd64:
+		return gapstone.CS_ARCH_X86, gapstone.CS_MODE_64, nil
+	case macho.Cpu386:
+		return gapstone.CS_ARCH_X86, gapstone.CS_MODE_32, nil
+	case macho.CpuArm64:
+		return gapstone.CS_ARCH_ARM64, gapstone.CS_MODE_LITTLE_ENDIAN, nil
+	case macho.CpuArm:
+		return gapstone.CS_ARCH_ARM, gapstone.CS_MODE_ARM, nil
+	case macho.CpuPpc:
+		return gapstone.CS_ARCH_PPC, gapstone.CS_MODE_32 | gapstone.CS_MODE_BIG_ENDIAN, nil
+	case macho.CpuPpc64:
+		return gapstone.CS_ARCH_PPC, gapstone.CS_MODE_64 | gapstone.CS_MODE_BIG_ENDIAN, nil
+	}
+	return 0, 0, fmt.Errorf("%w: %v", ErrMachine, cpu)
+}
+
+// Map every section with file contents at its address. Permissions come
+// from the segment, minus execute for sections without instructions.
+// Objects have a single unnamed segment, so __TEXT sections are taken as
+// read-only there.
+func (f *File) layout() {
+	for _, sec := range f.macho.Sections {
+		switch sec.Flags & sectionType {
+		case sZerofill, sGBZerofill, sThreadLocalZerofill:
+			continue
+		}
+		if sec.Size == 0 {
+			continue
+		}
+
+		var perm gapstone.Perm
+		if seg := f.macho.Segment(sec.Seg); seg != nil {
+			if seg.Prot&vmProtRead != 0 {
+				perm |= gapstone.PermRead
+			}
+			if seg.Prot&vmProtWrite != 0 {
+				perm |= gapstone.PermWrite
+			}
+			if seg.Prot&vmProtExecute != 0 {
+				perm |= gapstone.PermExec
+			}
+		} else {
+			perm = gapstone.PermRead | gapstone.PermExec
+			if sec.Seg != "__TEXT" {
+				perm |= gapstone.PermWrite
+			}
+		}
+		if sec.Flags&sAttrInstructions == 0 {
+			perm &^= gapstone.PermExec
+		}
+
+		region := gapstone.Region{Start: sec.Addr, Size: sec.Size, Perm: perm, Name: sec.Seg + "," + sec.Name}
+		f.mem.Map(gapstone.NewReaderAtMemory(sec.ReaderAt, 0, region))
+	}
+}
+
+// Collect the symbols defined in a section. Assembler temporaries (ltmp0,
+// l_str, L...) are left out, they alias real symbols.
+func (f *File) loadSymbols() {
+	f.byName = make(map[string]Symbol)
+	if f.macho.Symtab == nil {
+		return
+	}
+
+	for _, s := range f.macho.Symtab.Syms {
+		if s.Type&nStab != 0 || s.Type&nType != nSect || s.Sect == 0 || int(s.Sect) > len(f.macho.Sections) {
+			continue
+		}
+		if s.Name == "" || strings.HasPrefix(s.Name, "ltmp") || strings.HasPrefix(s.Name, "l_") || strings.HasPrefix(s.Name, "L") {
+			continue
+		}
+		sym := Symbol{
+			Name:     s.Name,
+			Addr:     s.Value,
+			Exported: s.Type&nExt != 0,
+			Thumb:    f.macho.Cpu == macho.CpuArm && s.Desc&nArmThumbDef != 0,
+		}
+		// The symbol ends at the next one in the same section, worked
+		// out below, or at the end of the section.
+		sec := f.macho.Sections[s.Sect-1]
+		sym.Size = sec.Addr + sec.Size - s.Value
+		f.symbols = append(f.symbols, sym)
+	}
+
+	sort.SliceStable(f.symbols, func(i, j int) bool {
+		return f.symbols[i].Addr < f.symbols[j].Addr
+	})
+	for i := range f.symbols {
+		s := &f.symbols[i]
+		for _, next := range f.symbols[i+1:] {
+			if next.Addr > s.Addr {
+				if next.Addr-s.Addr < s.Size {
+					s.Size = next.Addr - s.Addr
+				}
+				break
+			}
+		}
+		if _, ok := f.byName[s.Name]; !ok {
+			f.byName[s.Name] = *s
+		}
+	}
+}
+
+// Close the Engines and, for a File from Open, the underlying file.
+func (f *File) Close() error {
+	var err error
+	if cerr := f.engine.Close(); cerr != gapstone.ErrOK {
+		err = cerr
+	}
+	if f.thumb != nil {
+		f.thumb.Close()
+	}
+	if f.closer != nil {
+		if cerr := f.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// The parsed Mach-O file, the selected architecture for universal binaries
+func (f *File) Macho() *macho.File { return f.macho }
+
+// The Engine matching the CPU type. For ARM this is the ARM mode Engine,
+// Thumb symbols are handled by DisasmSymbol.
+func (f *File) Engine() *gapstone.Engine { return &f.engine }
+
+// Every section with file contents, at its address. Region names are
+// "segment,section", eg. "__TEXT,__text".
+func (f *File) Memory() gapstone.Memory { return &f.mem }
+
+// Symbols defined in a section, sorted by address.
+func (f *File) Symbols() []Symbol { return f.symbols }
+
+// Find a symbol by name, trying the C mangled "_name" as well.
+func (f *File) LookupSymbol(name string) (Symbol, error) {
+	if s, ok := f.byName[name]; ok {
+		return s, nil
+	}
+	if s, ok := f.byName["_"+name]; ok {
+		return s, nil
+	}
+	return Symbol{}, fmt.Errorf("%w: %s", ErrNoSymbol, name)
+}
+
+// Map an address back to the symbol covering it, which makes a File a
+// gapstone.Symbolizer.
+func (f *File) Lookup(addr uint64) (string, uint64, bool) {
+	i := sort.Search(len(f.symbols), func(i int) bool {
+		return f.symbols[i].Addr > addr
+	})
+	if i == 0 {
+		return "", 0, false
+	}
+	s := f.symbols[i-1]
+	if off := addr - s.Addr; off < s.Size || off == 0 {
+		return s.Name, off, true
+	}
+	return "", 0, false
+}
+
+// Disassemble the function called name.
+func (f *File) DisasmSymbol(name string) ([]gapstone.Instruction, error) {
+	sym, err := f.LookupSymbol(name)
+	if err != nil {
+		return nil, err
+	}
+	if sym.Size == 0 {
+		return nil, fmt.Errorf("symbol %s has no size", name)
+	}
+
+	engine := &f.engine
+	if sym.Thumb {
+		if engine, err = f.thumbEngine(); err != nil {
+			return nil, err
+		}
+	}
+	return engine.DisasmRange(&f.mem, sym.Addr, sym.Addr+sym.Size)
+}
+
+// Disassemble the named section, given as "__text" or "__TEXT,__text".
+func (f *File) DisasmSection(name string) ([]gapstone.Instruction, error) {
+	for _, sec := range f.macho.Sections {
+		if name != sec.Name && name != sec.Seg+","+sec.Name {
+			continue
+		}
+		if _, ok := gapstone.FindRegion(&f.mem, sec.Addr); !ok {
+			break
+		}
+		return f.engine.DisasmRange(&f.mem, sec.Addr, sec.Addr+sec.Size)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNoSection, name)
+}
+
+// Disassemble size bytes at addr.
+func (f *File) DisasmRange(addr, size uint64) ([]gapstone.Instruction, error) {
+	return f.engine.DisasmRange(&f.mem, addr, addr+size)
+}
+
+func (f *File) thumbEngine() (*gapstone.Engine, error) {
+	if f.thumb != nil {
+		return f.thumb, nil
+	}
+	engine, err := gapstone.New(gapstone.CS_ARCH_ARM, gapstone.CS_MODE_THUMB)
+	if err != nil {
+		return nil, err
+	}
+	if err := engine.SetOption(gapstone.CS_OPT_DETAIL, gapstone.CS_OPT_ON); err != nil {
+		engine.Close()
+		return nil, err
+	}
+	f.thumb = &engine
+	return f.thumb, nil
+}
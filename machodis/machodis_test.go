@@ -0,0 +1,110 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package machodis
+
+import (
+	"debug/macho"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/bpfsnoop/gapstone"
+)
+
+func TestArchMode(t *testing.T) {
+	tests := []struct {
+		cpu  macho.Cpu
+		arch int
+		mode int
+	}{
+		{macho.CpuAmd64, gapstone.CS_ARCH_X86, gapstone.CS_MODE_64},
+		{macho.Cpu386, gapstone.CS_ARCH_X86, gapstone.CS_MODE_32},
+		{macho.CpuArm64, gapstone.CS_ARCH_ARM64, gapstone.CS_MODE_LITTLE_ENDIAN},
+		{macho.CpuArm, gapstone.CS_ARCH_ARM, gapstone.CS_MODE_ARM},
+		{macho.CpuPpc64, gapstone.CS_ARCH_PPC, gapstone.CS_MODE_64 | gapstone.CS_MODE_BIG_ENDIAN},
+	}
+	for _, tt := range tests {
+		arch, mode, err := ArchMode(tt.cpu)
+		if err != nil || arch != tt.arch || mode != tt.mode {
+			t.Errorf("%v: want %d/0x%x, got %d/0x%x (%v)", tt.cpu, tt.arch, tt.mode, arch, mode, err)
+		}
+	}
+	if _, _, err := ArchMode(0x1234); !errors.Is(err, ErrMachine) {
+		t.Errorf("want ErrMachine, got %v", err)
+	}
+}
+
+func TestDisasmSymbol(t *testing.T) {
+	f, err := Open("testdata/arm64.o")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	// ltmp0 aliases _main and is left out.
+	if syms := f.Symbols(); len(syms) != 2 || syms[0].Name != "_main" || syms[1].Name != "_helper" {
+		t.Fatalf("want _main and _helper, got %+v", syms)
+	}
+	main, err := f.LookupSymbol("main")
+	if err != nil || main.Size != 0x14 || !main.Exported {
+		t.Errorf("want exported _main of size 0x14, got %+v (%v)", main, err)
+	}
+
+	insns, err := f.DisasmSymbol("_main")
+	if err != nil {
+		t.Fatalf("DisasmSymbol failed: %v", err)
+	}
+	if len(insns) != 5 || insns[4].Mnemonic != "ret" {
+		t.Fatalf("want 5 instructions ending in ret, got %v", insns)
+	}
+	if s := gapstone.Symbolize(insns[2], f); s != "_helper" {
+		t.Errorf("want bl _helper, got bl %s", s)
+	}
+
+	if insns, err := f.DisasmSection("__text"); err != nil || len(insns) != 7 {
+		t.Errorf("DisasmSection: want 7 instructions, got %d (%v)", len(insns), err)
+	}
+	if r, ok := gapstone.FindRegion(f.Memory(), 0x1c); !ok || r.Name != "__TEXT,__cstring" || r.Perm.String() != "r--" {
+		t.Errorf("want __TEXT,__cstring r-- at 0x1c, got %+v", r)
+	}
+}
+
+func TestUniversal(t *testing.T) {
+	fd, err := os.Open("testdata/fat.o")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+
+	// fat.o holds x86_64 first, then arm64.
+	f, err := NewFile(fd)
+	if err != nil {
+		t.Fatalf("NewFile failed: %v", err)
+	}
+	if cpu := f.Macho().Cpu; cpu != macho.CpuAmd64 {
+		t.Errorf("want the first architecture, got %v", cpu)
+	}
+	f.Close()
+
+	f, err = NewFileCpu(fd, macho.CpuArm64)
+	if err != nil {
+		t.Fatalf("NewFileCpu failed: %v", err)
+	}
+	defer f.Close()
+	insns, err := f.DisasmSymbol("main")
+	if err != nil || len(insns) != 5 || insns[0].Mnemonic != "stp" {
+		t.Errorf("want the arm64 _main, got %v (%v)", insns, err)
+	}
+
+	if _, err := NewFileCpu(fd, macho.CpuPpc); !errors.Is(err, ErrMachine) {
+		t.Errorf("want ErrMachine, got %v", err)
+	}
+}
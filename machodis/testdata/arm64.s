@@ -0,0 +1,27 @@
+# Source of arm64.o, built with:
+#
+#   llvm-mc -triple arm64-apple-macos11 -filetype=obj arm64.s -o arm64.o
+#
+# fat.o bundles it with x86_64.o:
+#
+#   llvm-mc -triple x86_64-apple-macos11 -filetype=obj x86_64.s -o x86_64.o
+#   llvm-lipo -create arm64.o x86_64.o -output fat.o
+
+	.section	__TEXT,__text,regular,pure_instructions
+	.globl	_main
+	.p2align	2
+_main:
+	stp	x29, x30, [sp, #-16]!
+	mov	x29, sp
+	bl	_helper
+	ldp	x29, x30, [sp], #16
+	ret
+
+	.p2align	2
+_helper:
+	add	w0, w0, #1
+	ret
+
+	.section	__TEXT,__cstring,cstring_literals
+l_str:
+	.asciz	"hello"
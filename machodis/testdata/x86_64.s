@@ -0,0 +1,10 @@
+# Second slice of fat.o, see arm64.s
+
+	.section	__TEXT,__text,regular,pure_instructions
+	.globl	_main
+_main:
+	pushq	%rbp
+	movq	%rsp, %rbp
+	xorl	%eax, %eax
+	popq	%rbp
+	retq
@@ -0,0 +1,287 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package gapstone
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+)
+
+var (
+	// Returned (wrapped) when nothing is mapped at the requested address
+	ErrUnmapped = errors.New("address not mapped")
+	// Returned (wrapped) when the bytes at an address don't decode
+	ErrInvalidInstruction = errors.New("invalid instruction")
+)
+
+// Access permissions of a memory Region
+type Perm uint8
+
+const (
+	PermRead Perm = 1 << iota
+	PermWrite
+	PermExec
+)
+
+func (p Perm) String() string {
+	s := []byte("---")
+	if p&PermRead != 0 {
+		s[0] = 'r'
+	}
+	if p&PermWrite != 0 {
+		s[1] = 'w'
+	}
+	if p&PermExec != 0 {
+		s[2] = 'x'
+	}
+	return string(s)
+}
+
+// A contiguous mapped range of a Memory
+type Region struct {
+	Start uint64
+	Size  uint64
+	Perm  Perm
+	Name  string // Optional, eg. the section or segment name
+}
+
+// First address past the end of the Region
+func (r Region) End() uint64 { return r.Start + r.Size }
+
+func (r Region) Contains(addr uint64) bool {
+	return addr >= r.Start && addr-r.Start < r.Size
+}
+
+// A Memory is a sparse, addressable view of code, used by the analysis
+// drivers instead of a single contiguous []byte plus base address.
+type Memory interface {
+	// ReadAt returns up to n bytes starting at addr. Fewer than n bytes are
+	// returned when the Region holding addr ends early; an error wrapping
+	// ErrUnmapped is returned when addr itself is not mapped.
+	ReadAt(addr uint64, n int) ([]byte, error)
+	// Regions lists everything that is mapped, sorted by address and
+	// without overlaps.
+	Regions() []Region
+}
+
+// Find the Region of mem that contains addr
+func FindRegion(mem Memory, addr uint64) (Region, bool) {
+	regions := mem.Regions()
+	i := sort.Search(len(regions), func(i int) bool {
+		return regions[i].End() > addr
+	})
+	if i < len(regions) && regions[i].Contains(addr) {
+		return regions[i], true
+	}
+	return Region{}, false
+}
+
+func unmapped(addr uint64) error {
+	return fmt.Errorf("%w: 0x%x", ErrUnmapped, addr)
+}
+
+// Read up to n bytes at addr, carrying on into the following Region when it
+// starts right where the previous one ends.
+func readContiguous(mem Memory, addr uint64, n int) ([]byte, error) {
+	buf, err := mem.ReadAt(addr, n)
+	if err != nil {
+		return nil, err
+	}
+	for len(buf) < n {
+		more, err := mem.ReadAt(addr+uint64(len(buf)), n-len(buf))
+		if err != nil || len(more) == 0 {
+			break
+		}
+		// Never append into the backing array of a Memory.
+		buf = append(buf[:len(buf):len(buf)], more...)
+	}
+	return buf, nil
+}
+
+// A Memory over a single in-memory buffer loaded at Base.
+type BytesMemory struct {
+	Base uint64
+	Data []byte
+	Perm Perm
+	Name string
+}
+
+func NewBytesMemory(base uint64, data []byte, perm Perm) *BytesMemory {
+	return &BytesMemory{Base: base, Data: data, Perm: perm}
+}
+
+func (m *BytesMemory) ReadAt(addr uint64, n int) ([]byte, error) {
+	if addr < m.Base || addr-m.Base >= uint64(len(m.Data)) {
+		return nil, unmapped(addr)
+	}
+	off := addr - m.Base
+	end := uint64(len(m.Data))
+	if n >= 0 && uint64(n) < end-off {
+		end = off + uint64(n)
+	}
+	return m.Data[off:end], nil
+}
+
+func (m *BytesMemory) Regions() []Region {
+	if len(m.Data) == 0 {
+		return nil
+	}
+	return []Region{{Start: m.Base, Size: uint64(len(m.Data)), Perm: m.Perm, Name: m.Name}}
+}
+
+// A Memory that maps one Region onto an io.ReaderAt, typically a file, so
+// nothing is read until it is disassembled.
+type ReaderAtMemory struct {
+	r      io.ReaderAt
+	off    int64
+	region Region
+}
+
+// Map region onto r, with region.Start corresponding to offset off.
+func NewReaderAtMemory(r io.ReaderAt, off int64, region Region) *ReaderAtMemory {
+	return &ReaderAtMemory{r: r, off: off, region: region}
+}
+
+func (m *ReaderAtMemory) ReadAt(addr uint64, n int) ([]byte, error) {
+	if !m.region.Contains(addr) {
+		return nil, unmapped(addr)
+	}
+	if left := m.region.End() - addr; n < 0 || uint64(n) > left {
+		n = int(left)
+	}
+	buf := make([]byte, n)
+	k, err := m.r.ReadAt(buf, m.off+int64(addr-m.region.Start))
+	if err != nil && !(err == io.EOF && k > 0) {
+		return nil, fmt.Errorf("reading 0x%x: %w", addr, err)
+	}
+	return buf[:k], nil
+}
+
+func (m *ReaderAtMemory) Regions() []Region {
+	if m.region.Size == 0 {
+		return nil
+	}
+	return []Region{m.region}
+}
+
+type segment struct {
+	region Region
+	mem    Memory
+}
+
+// A Memory stitched together from other Memory implementations, eg. one per
+// ELF segment. The zero value is an empty address space.
+type SegmentedMemory struct {
+	segs []segment
+}
+
+// Add every Region of mem to the address space. Regions must not overlap
+// anything already mapped, or each other. On error nothing is mapped.
+func (m *SegmentedMemory) Map(mem Memory) error {
+	segs := slices.Clone(m.segs)
+	for _, r := range mem.Regions() {
+		i := sort.Search(len(segs), func(i int) bool {
+			return segs[i].region.Start >= r.Start
+		})
+		if i > 0 && segs[i-1].region.End() > r.Start {
+			return fmt.Errorf("region 0x%x-0x%x overlaps 0x%x-0x%x",
+				r.Start, r.End(), segs[i-1].region.Start, segs[i-1].region.End())
+		}
+		if i < len(segs) && r.End() > segs[i].region.Start {
+			return fmt.Errorf("region 0x%x-0x%x overlaps 0x%x-0x%x",
+				r.Start, r.End(), segs[i].region.Start, segs[i].region.End())
+		}
+		segs = slices.Insert(segs, i, segment{region: r, mem: mem})
+	}
+	m.segs = segs
+	return nil
+}
+
+func (m *SegmentedMemory) ReadAt(addr uint64, n int) ([]byte, error) {
+	i := sort.Search(len(m.segs), func(i int) bool {
+		return m.segs[i].region.End() > addr
+	})
+	if i == len(m.segs) || !m.segs[i].region.Contains(addr) {
+		return nil, unmapped(addr)
+	}
+	r := m.segs[i].region
+	if left := r.End() - addr; n < 0 || uint64(n) > left {
+		n = int(left)
+	}
+	return m.segs[i].mem.ReadAt(addr, n)
+}
+
+func (m *SegmentedMemory) Regions() []Region {
+	regions := make([]Region, 0, len(m.segs))
+	for _, s := range m.segs {
+		regions = append(regions, s.region)
+	}
+	return regions
+}
+
+// Linear sweep over [start, end) of mem. Unlike Disasm the range may cross
+// from one Region into the next, as long as they are adjacent; running into
+// a gap in the mapping returns the instructions decoded so far and an error
+// wrapping ErrUnmapped. Bytes that don't decode are reported with
+// ErrInvalidInstruction. The last instruction may extend past end.
+func (e *Engine) DisasmRange(mem Memory, start, end uint64) ([]Instruction, error) {
+	insns := []Instruction{}
+	addr := start
+	for addr < end {
+		code, err := readContiguous(mem, addr, exploreWindow)
+		if err != nil {
+			return insns, err
+		}
+
+		next := e.disasmIter(code, addr, func(insn *Instruction) bool {
+			if uint64(insn.Address) >= end {
+				return false
+			}
+			insns = append(insns, *insn)
+			return true
+		})
+		if next != addr {
+			addr = next
+			continue
+		}
+
+		// No progress: either the instruction runs into a hole or the bytes
+		// are garbage. Only fewer bytes than the longest instruction can
+		// be one cut short.
+		if len(code) < e.maxInsnSize() {
+			hole := addr + uint64(len(code))
+			if _, err := mem.ReadAt(hole, 1); err != nil && errors.Is(err, ErrUnmapped) {
+				return insns, err
+			}
+		}
+		return insns, fmt.Errorf("%w at 0x%x", ErrInvalidInstruction, addr)
+	}
+	return insns, nil
+}
+
+// Longest instruction of the arch, as many bytes as DisasmRange reads at
+// once when it isn't known.
+func (e *Engine) maxInsnSize() int {
+	switch e.arch {
+	case CS_ARCH_X86:
+		return 15
+	case CS_ARCH_ARM, CS_ARCH_ARM64, CS_ARCH_MIPS, CS_ARCH_PPC, CS_ARCH_SPARC, CS_ARCH_RISCV:
+		return 4
+	case CS_ARCH_SYSZ:
+		return 6
+	case CS_ARCH_BPF:
+		return 16 // lddw
+	}
+	return exploreWindow
+}
@@ -0,0 +1,106 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package gapstone
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestSegmentedMemory(t *testing.T) {
+	var mem SegmentedMemory
+	file := bytes.NewReader([]byte("....\x55\x48\x8b\x05...."))
+
+	if err := mem.Map(NewReaderAtMemory(file, 4, Region{Start: 0x1000, Size: 4, Perm: PermRead | PermExec})); err != nil {
+		t.Fatalf("Map failed: %v", err)
+	}
+	if err := mem.Map(NewBytesMemory(0x1004, []byte("\xb8\x13\x00\x00\xc3"), PermRead|PermExec)); err != nil {
+		t.Fatalf("Map failed: %v", err)
+	}
+	if err := mem.Map(NewBytesMemory(0x1002, []byte("\x90"), PermRead)); err == nil {
+		t.Errorf("Map accepted an overlapping region")
+	}
+	// The second region overlaps, so the first must not be mapped either
+	var two SegmentedMemory
+	two.Map(NewBytesMemory(0x800, []byte("\xc3"), PermRead|PermExec))
+	two.Map(NewBytesMemory(0x1008, []byte("\xc3"), PermRead|PermExec))
+	if err := mem.Map(&two); err == nil {
+		t.Errorf("Map accepted an overlapping region")
+	}
+
+	regions := mem.Regions()
+	if len(regions) != 2 {
+		t.Fatalf("want 2 regions, got %v", regions)
+	}
+	assertEqual(t, "perm: want %v, got %v", "r-x", regions[0].Perm.String())
+
+	b, err := mem.ReadAt(0x1002, 8)
+	if err != nil {
+		t.Fatalf("ReadAt failed: %v", err)
+	}
+	assertEqual(t, "short read: want %q, got %q", "\x8b\x05", string(b))
+
+	b, err = readContiguous(&mem, 0x1002, 8)
+	if err != nil {
+		t.Fatalf("readContiguous failed: %v", err)
+	}
+	assertEqual(t, "contiguous read: want %q, got %q", "\x8b\x05\xb8\x13\x00\x00\xc3", string(b))
+
+	if _, err := mem.ReadAt(0x1009, 1); !errors.Is(err, ErrUnmapped) {
+		t.Errorf("want ErrUnmapped, got %v", err)
+	}
+	if r, ok := FindRegion(&mem, 0x1005); !ok || r.Start != 0x1004 {
+		t.Errorf("FindRegion: got %+v, %v", r, ok)
+	}
+}
+
+func TestDisasmRange(t *testing.T) {
+	engine, err := New(CS_ARCH_X86, CS_MODE_64)
+	if err != nil {
+		t.Fatalf("Failed to initialize engine %v", err)
+	}
+	defer engine.Close()
+
+	// push rbp; mov rax, [rip+0x13b8]; ret - with the mov split across two
+	// segments, and a nop further on after a hole.
+	var mem SegmentedMemory
+	mem.Map(NewBytesMemory(0x1000, []byte("\x55\x48\x8b"), PermExec))
+	mem.Map(NewBytesMemory(0x1003, []byte("\x05\xb8\x13\x00\x00\xc3"), PermExec))
+	mem.Map(NewBytesMemory(0x2000, []byte("\x90"), PermExec))
+
+	insns, err := engine.DisasmRange(&mem, 0x1000, 0x1009)
+	if err != nil {
+		t.Fatalf("DisasmRange failed: %v", err)
+	}
+	if len(insns) != 3 {
+		t.Fatalf("want 3 instructions, got %d", len(insns))
+	}
+	assertEqual(t, "mov size: want %v, got %v", uint(7), insns[1].Size)
+	assertEqual(t, "ret address: want 0x%x, got 0x%x", uint(0x1008), insns[2].Address)
+
+	insns, err = engine.DisasmRange(&mem, 0x1000, 0x2001)
+	if !errors.Is(err, ErrUnmapped) {
+		t.Errorf("want ErrUnmapped for the gap, got %v", err)
+	}
+	assertEqual(t, "partial: want %v instructions, got %v", 3, len(insns))
+
+	// An instruction running into the hole is a gap, not garbage.
+	mem.Map(NewBytesMemory(0x3000, []byte("\x48\x8b"), PermExec))
+	if _, err := engine.DisasmRange(&mem, 0x3000, 0x3002); !errors.Is(err, ErrUnmapped) {
+		t.Errorf("want ErrUnmapped for a truncated instruction, got %v", err)
+	}
+	// But not when more bytes than any instruction has don't decode.
+	mem.Map(NewBytesMemory(0x4000, bytes.Repeat([]byte{0xff}, 16), PermExec))
+	if _, err := engine.DisasmRange(&mem, 0x4000, 0x4010); !errors.Is(err, ErrInvalidInstruction) {
+		t.Errorf("want ErrInvalidInstruction for garbage before a hole, got %v", err)
+	}
+}
@@ -0,0 +1,206 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package gapstone
+
+import (
+	"strconv"
+	"strings"
+)
+
+// What Normalize abstracts on top of immediates and addresses
+type NormalizeFlags int
+
+const (
+	// Replace allocatable registers by their class, reg64, wreg and so on,
+	// so code that only differs in register allocation looks the same. The
+	// stack, frame and instruction pointers and zero registers are kept.
+	// x86 and arm64 only.
+	NormalizeRegs NormalizeFlags = 1 << iota
+)
+
+// Tokens of the canonical form
+const (
+	NormImm  = "IMM"  // Immediate
+	NormDisp = "DISP" // Memory displacement or offset
+	NormAddr = "ADDR" // Direct branch or call target
+)
+
+// Turn insn into a canonical form that stays the same from one build to the
+// next: the mnemonic and operands with direct branch targets replaced by
+// ADDR, displacements (numbers inside a memory operand, or right before the
+// parenthesis of an AT&T style one such as 0x10(%rbp)) by DISP and other
+// numbers by IMM, eg. `mov rax, qword ptr [rip + 0x1234]` becomes `mov rax,
+// qword ptr [rip + DISP]`. Signs are dropped, a negative displacement inside
+// brackets is rendered as added. x86 scale factors and numbers in
+// parentheses, such as the AT&T index and scale or st(1), are kept. Needs
+// CS_OPT_DETAIL for the branch targets.
+func Normalize(insn Instruction, flags NormalizeFlags) string {
+	flow := insn.Flow()
+	var regClass func(string) string
+	if flags&NormalizeRegs != 0 {
+		switch {
+		case insn.X86 != nil:
+			regClass = x86RegClass
+		case insn.Arm64 != nil:
+			regClass = arm64RegClass
+		}
+	}
+	att := isATT(insn)
+
+	out := []byte(insn.Mnemonic)
+	if insn.OpStr != "" {
+		out = append(out, ' ')
+	}
+	s := insn.OpStr
+	depth, parens := 0, 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if !isWordByte(c) {
+			switch c {
+			case '[':
+				depth++
+			case ']':
+				depth--
+			case '(':
+				parens++
+			case ')':
+				parens--
+			}
+			out = append(out, c)
+			i++
+			continue
+		}
+		j := i
+		for j < len(s) && isWordByte(s[j]) {
+			j++
+		}
+		tok := s[i:j]
+		i = j
+
+		switch {
+		case c >= '0' && c <= '9':
+			prev := strings.TrimRight(string(out), " #$")
+			if !att && strings.HasSuffix(prev, "*") || parens > 0 {
+				out = append(out, tok...) // Scale, or st(1)
+				continue
+			}
+			imm := att && strings.HasSuffix(strings.TrimSuffix(string(out), "-"), "$")
+			// Drop the sign, as a displacement may flip from one build
+			// to the next: rip - 0x10 becomes rip + DISP, #-8 #DISP and
+			// -0x10(%rbp) DISP(%rbp)
+			if strings.HasSuffix(prev, "-") {
+				k := len(prev) - 1
+				if depth > 0 && k > 0 && out[k-1] == ' ' {
+					out[k] = '+'
+				} else {
+					out = append(out[:k], out[k+1:]...)
+				}
+			}
+			v, err := strconv.ParseUint(tok, 0, 64)
+			switch {
+			case flow.Direct && err == nil && v == flow.Target:
+				out = append(out, NormAddr...)
+			case depth > 0, i < len(s) && s[i] == '(', att && !imm:
+				// In AT&T syntax only $ marks an immediate, a bare number
+				// is an absolute address
+				out = append(out, NormDisp...)
+			default:
+				out = append(out, NormImm...)
+			}
+		case regClass != nil:
+			out = append(out, regClass(tok)...)
+		default:
+			out = append(out, tok...)
+		}
+	}
+	return string(out)
+}
+
+// Is insn in x86 AT&T syntax? Registers there start with %, immediates with
+// $, and memory operands never have brackets.
+func isATT(insn Instruction) bool {
+	if insn.X86 == nil || strings.Contains(insn.OpStr, "[") {
+		return false
+	}
+	if strings.ContainsAny(insn.OpStr, "%$") {
+		return true
+	}
+	for _, op := range insn.X86.Operands {
+		if op.Type == X86_OP_MEM {
+			return true
+		}
+	}
+	return false
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c == '.' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// x86 register names by class, for NormalizeRegs
+var x86RegClasses = func() map[string]string {
+	m := make(map[string]string)
+	for _, r := range []string{"rax", "rbx", "rcx", "rdx", "rsi", "rdi", "rbp"} {
+		m[r] = "reg64"
+	}
+	for _, r := range []string{"eax", "ebx", "ecx", "edx", "esi", "edi", "ebp"} {
+		m[r] = "reg32"
+	}
+	for _, r := range []string{"ax", "bx", "cx", "dx", "si", "di", "bp"} {
+		m[r] = "reg16"
+	}
+	for _, r := range []string{"al", "bl", "cl", "dl", "ah", "bh", "ch", "dh", "sil", "dil", "bpl"} {
+		m[r] = "reg8"
+	}
+	for n := 8; n <= 15; n++ {
+		r := "r" + strconv.Itoa(n)
+		m[r], m[r+"d"], m[r+"w"], m[r+"b"] = "reg64", "reg32", "reg16", "reg8"
+	}
+	for n := 0; n < 32; n++ {
+		for _, v := range []string{"xmm", "ymm", "zmm"} {
+			m[v+strconv.Itoa(n)] = v
+		}
+	}
+	return m
+}()
+
+func x86RegClass(name string) string {
+	if c, ok := x86RegClasses[name]; ok {
+		return c
+	}
+	return name
+}
+
+// x0-x28 and w0-w28, the SIMD registers by width, keeping any arrangement
+// such as v0.16b. x29 and x30 are the frame pointer and link register.
+func arm64RegClass(name string) string {
+	reg, arrangement, _ := strings.Cut(name, ".")
+	if len(reg) < 2 {
+		return name
+	}
+	n, err := strconv.Atoi(reg[1:])
+	if err != nil || n < 0 || n > 31 {
+		return name
+	}
+	switch reg[0] {
+	case 'x', 'w':
+		if n > 28 {
+			return name
+		}
+	case 'v', 'q', 'd', 's', 'h', 'b':
+	default:
+		return name
+	}
+	if arrangement != "" {
+		return reg[:1] + "reg." + arrangement
+	}
+	return reg[:1] + "reg"
+}
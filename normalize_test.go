@@ -0,0 +1,82 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package gapstone
+
+import "testing"
+
+func checkNormalize(t *testing.T, engine Engine, code, want, wantRegs string) {
+	insns, err := engine.Disasm([]byte(code), 0x1000, 1)
+	if err != nil {
+		t.Fatalf("Disassembly error: %v", err)
+	}
+	if got := Normalize(insns[0], 0); got != want {
+		t.Errorf("%s %s: got %q, want %q", insns[0].Mnemonic, insns[0].OpStr, got, want)
+	}
+	if got := Normalize(insns[0], NormalizeRegs); got != wantRegs {
+		t.Errorf("%s %s with NormalizeRegs: got %q, want %q", insns[0].Mnemonic, insns[0].OpStr, got, wantRegs)
+	}
+}
+
+func TestNormalizeX86(t *testing.T) {
+	engine := entryEngine(t, CS_ARCH_X86, CS_MODE_64)
+	defer engine.Close()
+
+	for _, tc := range []struct{ code, want, wantRegs string }{
+		{"\x48\x8b\x05\x34\x12\x00\x00", "mov rax, qword ptr [rip + DISP]", "mov reg64, qword ptr [rip + DISP]"},
+		{"\x8b\x45\xec", "mov eax, dword ptr [rbp + DISP]", "mov reg32, dword ptr [reg64 + DISP]"},
+		{"\x48\x8d\x44\xcb\x10", "lea rax, [rbx + rcx*8 + DISP]", "lea reg64, [reg64 + reg64*8 + DISP]"},
+		{"\xe8\xfb\x0f\x00\x00", "call ADDR", "call ADDR"},
+		{"\x48\x83\xc4\x08", "add rsp, IMM", "add rsp, IMM"},
+		{"\xc3", "ret", "ret"},
+		{"\xd9\xc1", "fld st(1)", "fld st(1)"},
+	} {
+		checkNormalize(t, engine, tc.code, tc.want, tc.wantRegs)
+	}
+}
+
+func TestNormalizeATT(t *testing.T) {
+	engine := entryEngine(t, CS_ARCH_X86, CS_MODE_64)
+	defer engine.Close()
+	engine.SetOption(CS_OPT_SYNTAX, CS_OPT_SYNTAX_ATT)
+
+	code := "\x8b\x45\xec" + // movl -0x14(%rbp), %eax
+		"\x8b\x45\x14" + // movl 0x14(%rbp), %eax
+		"\x48\x83\xc4\x08" + // addq $8, %rsp
+		"\xd9\xc1" // fld %st(1)
+	insns, err := engine.Disasm([]byte(code), 0x1000, 0)
+	if err != nil {
+		t.Fatalf("Disassembly error: %v", err)
+	}
+	// The same slot whatever the sign
+	for i, want := range []string{" DISP(%rbp), %eax", " DISP(%rbp), %eax", " $IMM, %rsp", " %st(1)"} {
+		want = insns[i].Mnemonic + want
+		if got := Normalize(insns[i], 0); got != want {
+			t.Errorf("%s %s: got %q, want %q", insns[i].Mnemonic, insns[i].OpStr, got, want)
+		}
+	}
+	if got := Normalize(insns[0], NormalizeRegs); got != insns[0].Mnemonic+" DISP(%reg64), %reg32" {
+		t.Errorf("%s %s with NormalizeRegs: got %q", insns[0].Mnemonic, insns[0].OpStr, got)
+	}
+}
+
+func TestNormalizeArm64(t *testing.T) {
+	engine := entryEngine(t, CS_ARCH_ARM64, CS_MODE_ARM)
+	defer engine.Close()
+
+	for _, tc := range []struct{ code, want, wantRegs string }{
+		{"\x20\x04\x40\xf9", "ldr x0, [x1, #DISP]", "ldr xreg, [xreg, #DISP]"},
+		{"\xfd\x7b\xbf\xa9", "stp x29, x30, [sp, #DISP]!", "stp x29, x30, [sp, #DISP]!"},
+		{"\x00\x04\x00\x94", "bl #ADDR", "bl #ADDR"},
+		{"\xa0\x00\x80\x52", "mov w0, #IMM", "mov wreg, #IMM"},
+	} {
+		checkNormalize(t, engine, tc.code, tc.want, tc.wantRegs)
+	}
+}
@@ -0,0 +1,465 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+// Package pedis disassembles PE/COFF images and objects, such as Windows
+// executables, DLLs and drivers, picking the Engine arch and mode from the
+// COFF machine field.
+package pedis
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/bpfsnoop/gapstone"
+)
+
+var (
+	ErrNoSymbol  = errors.New("symbol not found")
+	ErrNoSection = errors.New("section not found")
+	ErrMachine   = errors.New("unsupported PE machine")
+)
+
+// Not defined by debug/pe
+const (
+	imageScnLnkRemove     = 0x800
+	imageSymClassExternal = 2
+	imageSymDtypeFunction = 2
+)
+
+// A function or data symbol, with its address resolved against the image
+// base. PE symbols carry no size: it comes from the .pdata entry of the
+// function when there is one, otherwise the symbol extends to the next one
+// or the end of its section.
+type Symbol struct {
+	Name     string
+	Addr     uint64
+	Size     uint64
+	Exported bool // From the export directory rather than the COFF table
+	Ordinal  uint32
+}
+
+// A PE file opened for disassembly. Objects have all their sections at
+// address 0, so their sections are laid out one after the other starting
+// from 0, the way a linker would place them.
+type File struct {
+	pe      *pe.File
+	closer  io.Closer
+	engine  gapstone.Engine
+	mem     gapstone.SegmentedMemory
+	base    uint64   // Image base, 0 for objects
+	bases   []uint64 // Load address of each section, by index
+	symbols []Symbol // Sorted by address
+	byName  map[string]Symbol
+}
+
+// Open the named PE file for disassembly.
+func Open(name string) (*File, error) {
+	fd, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := NewFile(fd)
+	if err != nil {
+		fd.Close()
+		return nil, err
+	}
+	f.closer = fd
+	return f, nil
+}
+
+// Create a File from a PE image or COFF object. The Engine is created with
+// CS_OPT_DETAIL turned on.
+func NewFile(r io.ReaderAt) (*File, error) {
+	pf, err := pe.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+
+	arch, mode, err := ArchMode(pf.Machine)
+	if err != nil {
+		return nil, err
+	}
+	engine, err := gapstone.New(arch, mode)
+	if err != nil {
+		return nil, err
+	}
+	if err := engine.SetOption(gapstone.CS_OPT_DETAIL, gapstone.CS_OPT_ON); err != nil {
+		engine.Close()
+		return nil, err
+	}
+
+	f := &File{pe: pf, engine: engine}
+	switch oh := pf.OptionalHeader.(type) {
+	case *pe.OptionalHeader64:
+		f.base = oh.ImageBase
+	case *pe.OptionalHeader32:
+		f.base = uint64(oh.ImageBase)
+	}
+	f.layout()
+	if err := f.loadSymbols(); err != nil {
+		engine.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// Pick the Engine arch and mode for a COFF machine. Windows on ARM is
+// Thumb-2 only.
+func ArchMode(machine uint16) (arch, mode int, err error) {
+	switch machine {
+	case pe.IMAGE_FILE_MACHINE_AMD64:
+		return gapstone.CS_ARCH_X86, gapstone.CS_MODE_64, nil
+	case pe.IMAGE_FILE_MACHINE_I386:
+		return gapstone.CS_ARCH_X86, gapstone.CS_MODE_32, nil
+	case pe.IMAGE_FILE_MACHINE_ARM64:
+		return gapstone.CS_ARCH_ARM64, gapstone.CS_MODE_LITTLE_ENDIAN, nil
+	case pe.IMAGE_FILE_MACHINE_ARMNT, pe.IMAGE_FILE_MACHINE_THUMB:
+		return gapstone.CS_ARCH_ARM, gapstone.CS_MODE_THUMB, nil
+	case pe.IMAGE_FILE_MACHINE_ARM:
+		return gapstone.CS_ARCH_ARM, gapstone.CS_MODE_ARM, nil
+	}
+	return 0, 0, fmt.Errorf("%w: 0x%x", ErrMachine, machine)
+}
+
+// Assign every section its load address and map its raw data. The part of
+// VirtualSize beyond the raw data is zero filled by the loader and left
+// unmapped, like SHT_NOBITS in ELF.
+func (f *File) layout() {
+	f.bases = make([]uint64, len(f.pe.Sections))
+	var next uint64
+	for i, sec := range f.pe.Sections {
+		if sec.Characteristics&imageScnLnkRemove != 0 {
+			continue
+		}
+
+		base := f.base + uint64(sec.VirtualAddress)
+		if f.pe.OptionalHeader == nil {
+			if n := sec.Characteristics >> 20 & 0xf; n > 0 {
+				align := uint64(1) << (n - 1)
+				next = (next + align - 1) &^ (align - 1)
+			}
+			base = next
+			next += uint64(sec.Size)
+		}
+		f.bases[i] = base
+
+		size := uint64(sec.Size)
+		if sec.VirtualSize != 0 && uint64(sec.VirtualSize) < size {
+			size = uint64(sec.VirtualSize)
+		}
+		if size == 0 || sec.Characteristics&pe.IMAGE_SCN_CNT_UNINITIALIZED_DATA != 0 {
+			continue
+		}
+		var perm gapstone.Perm
+		if sec.Characteristics&pe.IMAGE_SCN_MEM_READ != 0 {
+			perm |= gapstone.PermRead
+		}
+		if sec.Characteristics&pe.IMAGE_SCN_MEM_WRITE != 0 {
+			perm |= gapstone.PermWrite
+		}
+		if sec.Characteristics&pe.IMAGE_SCN_MEM_EXECUTE != 0 {
+			perm |= gapstone.PermExec
+		}
+		region := gapstone.Region{Start: base, Size: size, Perm: perm, Name: sec.Name}
+		f.mem.Map(gapstone.NewReaderAtMemory(sec.ReaderAt, 0, region))
+	}
+}
+
+// Collect the exports and the defined COFF symbols, then size them.
+func (f *File) loadSymbols() error {
+	exports, err := f.exports()
+	if err != nil {
+		return fmt.Errorf("export directory: %w", err)
+	}
+	f.symbols = exports
+
+	for _, s := range f.pe.Symbols {
+		if s.SectionNumber <= 0 || int(s.SectionNumber) > len(f.bases) || s.Name == "" {
+			continue
+		}
+		// Functions, and anything external. Static non-functions are
+		// mostly section and label symbols.
+		if s.StorageClass != imageSymClassExternal && s.Type>>4&3 != imageSymDtypeFunction {
+			continue
+		}
+		f.symbols = append(f.symbols, Symbol{
+			Name: s.Name,
+			Addr: f.bases[s.SectionNumber-1] + uint64(s.Value),
+		})
+	}
+
+	f.byName = make(map[string]Symbol)
+	seen := make(map[Symbol]bool)
+	symbols := f.symbols[:0]
+	for _, s := range f.symbols {
+		key := Symbol{Name: s.Name, Addr: s.Addr}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		symbols = append(symbols, s)
+	}
+	f.symbols = symbols
+	sort.SliceStable(f.symbols, func(i, j int) bool {
+		return f.symbols[i].Addr < f.symbols[j].Addr
+	})
+	f.sizeSymbols()
+
+	for _, s := range f.symbols {
+		if _, ok := f.byName[s.Name]; !ok {
+			f.byName[s.Name] = s
+		}
+	}
+	return nil
+}
+
+// Read the export directory: names, ordinals and RVAs. Forwarded exports
+// point into the export directory itself and are skipped.
+func (f *File) exports() ([]Symbol, error) {
+	dir, ok := f.dataDirectory(pe.IMAGE_DIRECTORY_ENTRY_EXPORT)
+	if !ok || dir.Size == 0 {
+		return nil, nil
+	}
+
+	var hdr struct {
+		Characteristics       uint32
+		TimeDateStamp         uint32
+		MajorVersion          uint16
+		MinorVersion          uint16
+		Name                  uint32
+		Base                  uint32
+		NumberOfFunctions     uint32
+		NumberOfNames         uint32
+		AddressOfFunctions    uint32
+		AddressOfNames        uint32
+		AddressOfNameOrdinals uint32
+	}
+	if err := f.readRVA(dir.VirtualAddress, &hdr); err != nil {
+		return nil, err
+	}
+	if hdr.NumberOfFunctions > 1<<16 || hdr.NumberOfNames > hdr.NumberOfFunctions {
+		return nil, errors.New("implausible export count")
+	}
+
+	funcs := make([]uint32, hdr.NumberOfFunctions)
+	names := make([]uint32, hdr.NumberOfNames)
+	ordinals := make([]uint16, hdr.NumberOfNames)
+	for _, err := range []error{
+		f.readRVA(hdr.AddressOfFunctions, funcs),
+		f.readRVA(hdr.AddressOfNames, names),
+		f.readRVA(hdr.AddressOfNameOrdinals, ordinals),
+	} {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	named := make(map[uint16]string, len(names))
+	for i, rva := range names {
+		name, err := f.stringRVA(rva)
+		if err != nil {
+			return nil, err
+		}
+		named[ordinals[i]] = name
+	}
+
+	var syms []Symbol
+	for i, rva := range funcs {
+		if rva == 0 || (rva >= dir.VirtualAddress && rva-dir.VirtualAddress < dir.Size) {
+			continue
+		}
+		s := Symbol{
+			Addr:     f.base + uint64(rva),
+			Exported: true,
+			Ordinal:  hdr.Base + uint32(i),
+		}
+		if s.Name = named[uint16(i)]; s.Name == "" {
+			s.Name = fmt.Sprintf("#%d", s.Ordinal)
+		}
+		syms = append(syms, s)
+	}
+	return syms, nil
+}
+
+// Give every symbol a size, from .pdata where possible.
+func (f *File) sizeSymbols() {
+	ends := f.functionEnds()
+	for i := range f.symbols {
+		s := &f.symbols[i]
+		if end, ok := ends[s.Addr]; ok {
+			s.Size = end - s.Addr
+			continue
+		}
+		r, ok := gapstone.FindRegion(&f.mem, s.Addr)
+		if !ok {
+			continue
+		}
+		end := r.End()
+		for _, next := range f.symbols[i+1:] {
+			if next.Addr > s.Addr {
+				if next.Addr < end {
+					end = next.Addr
+				}
+				break
+			}
+		}
+		s.Size = end - s.Addr
+	}
+}
+
+// Function start to end addresses from the x64 exception directory.
+func (f *File) functionEnds() map[uint64]uint64 {
+	ends := make(map[uint64]uint64)
+	dir, ok := f.dataDirectory(pe.IMAGE_DIRECTORY_ENTRY_EXCEPTION)
+	if !ok || dir.Size == 0 || f.pe.Machine != pe.IMAGE_FILE_MACHINE_AMD64 {
+		return ends
+	}
+	entries := make([]struct{ Begin, End, Unwind uint32 }, dir.Size/12)
+	if err := f.readRVA(dir.VirtualAddress, entries); err != nil {
+		return ends
+	}
+	for _, e := range entries {
+		if e.End > e.Begin {
+			ends[f.base+uint64(e.Begin)] = f.base + uint64(e.End)
+		}
+	}
+	return ends
+}
+
+func (f *File) dataDirectory(i int) (pe.DataDirectory, bool) {
+	switch oh := f.pe.OptionalHeader.(type) {
+	case *pe.OptionalHeader64:
+		if uint32(i) < oh.NumberOfRvaAndSizes {
+			return oh.DataDirectory[i], true
+		}
+	case *pe.OptionalHeader32:
+		if uint32(i) < oh.NumberOfRvaAndSizes {
+			return oh.DataDirectory[i], true
+		}
+	}
+	return pe.DataDirectory{}, false
+}
+
+// Decode the little endian data at an RVA into v.
+func (f *File) readRVA(rva uint32, v any) error {
+	n := binary.Size(v)
+	data, err := f.mem.ReadAt(f.base+uint64(rva), n)
+	if err != nil {
+		return err
+	}
+	if len(data) < n {
+		return fmt.Errorf("RVA 0x%x: %w", rva, io.ErrUnexpectedEOF)
+	}
+	return binary.Read(bytes.NewReader(data), binary.LittleEndian, v)
+}
+
+// Read the NUL terminated string at an RVA.
+func (f *File) stringRVA(rva uint32) (string, error) {
+	data, err := f.mem.ReadAt(f.base+uint64(rva), 512)
+	if err != nil {
+		return "", err
+	}
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		data = data[:i]
+	}
+	return string(data), nil
+}
+
+// Close the Engine and, for a File from Open, the underlying file.
+func (f *File) Close() error {
+	var err error
+	if cerr := f.engine.Close(); cerr != gapstone.ErrOK {
+		err = cerr
+	}
+	if f.closer != nil {
+		if cerr := f.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// The parsed PE file
+func (f *File) PE() *pe.File { return f.pe }
+
+// The Engine matching the COFF machine.
+func (f *File) Engine() *gapstone.Engine { return &f.engine }
+
+// Every section with raw data, at its load address. Region names are the
+// section names.
+func (f *File) Memory() gapstone.Memory { return &f.mem }
+
+// The preferred load address of the image, 0 for objects.
+func (f *File) ImageBase() uint64 { return f.base }
+
+// Exports and COFF symbols, sorted by address.
+func (f *File) Symbols() []Symbol { return f.symbols }
+
+// Find a symbol by name. Exports without a name are called "#ordinal".
+func (f *File) LookupSymbol(name string) (Symbol, error) {
+	if s, ok := f.byName[name]; ok {
+		return s, nil
+	}
+	return Symbol{}, fmt.Errorf("%w: %s", ErrNoSymbol, name)
+}
+
+// Map an address back to the symbol covering it, which makes a File a
+// gapstone.Symbolizer.
+func (f *File) Lookup(addr uint64) (string, uint64, bool) {
+	i := sort.Search(len(f.symbols), func(i int) bool {
+		return f.symbols[i].Addr > addr
+	})
+	if i == 0 {
+		return "", 0, false
+	}
+	s := f.symbols[i-1]
+	if off := addr - s.Addr; off < s.Size || off == 0 {
+		return s.Name, off, true
+	}
+	return "", 0, false
+}
+
+// Disassemble the function called name.
+func (f *File) DisasmSymbol(name string) ([]gapstone.Instruction, error) {
+	sym, err := f.LookupSymbol(name)
+	if err != nil {
+		return nil, err
+	}
+	if sym.Size == 0 {
+		return nil, fmt.Errorf("symbol %s has no size", name)
+	}
+	return f.engine.DisasmRange(&f.mem, sym.Addr, sym.Addr+sym.Size)
+}
+
+// Disassemble the mapped part of the named section.
+func (f *File) DisasmSection(name string) ([]gapstone.Instruction, error) {
+	for i, sec := range f.pe.Sections {
+		if sec.Name != name {
+			continue
+		}
+		r, ok := gapstone.FindRegion(&f.mem, f.bases[i])
+		if !ok {
+			break
+		}
+		return f.engine.DisasmRange(&f.mem, r.Start, r.End())
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNoSection, name)
+}
+
+// Disassemble size bytes at addr.
+func (f *File) DisasmRange(addr, size uint64) ([]gapstone.Instruction, error) {
+	return f.engine.DisasmRange(&f.mem, addr, addr+size)
+}
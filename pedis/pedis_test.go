@@ -0,0 +1,89 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package pedis
+
+import (
+	"debug/pe"
+	"errors"
+	"testing"
+
+	"github.com/bpfsnoop/gapstone"
+)
+
+func TestArchMode(t *testing.T) {
+	tests := []struct {
+		machine uint16
+		arch    int
+		mode    int
+	}{
+		{pe.IMAGE_FILE_MACHINE_AMD64, gapstone.CS_ARCH_X86, gapstone.CS_MODE_64},
+		{pe.IMAGE_FILE_MACHINE_I386, gapstone.CS_ARCH_X86, gapstone.CS_MODE_32},
+		{pe.IMAGE_FILE_MACHINE_ARM64, gapstone.CS_ARCH_ARM64, gapstone.CS_MODE_LITTLE_ENDIAN},
+		{pe.IMAGE_FILE_MACHINE_ARMNT, gapstone.CS_ARCH_ARM, gapstone.CS_MODE_THUMB},
+	}
+	for _, tt := range tests {
+		arch, mode, err := ArchMode(tt.machine)
+		if err != nil || arch != tt.arch || mode != tt.mode {
+			t.Errorf("0x%x: want %d/0x%x, got %d/0x%x (%v)", tt.machine, tt.arch, tt.mode, arch, mode, err)
+		}
+	}
+	if _, _, err := ArchMode(pe.IMAGE_FILE_MACHINE_RISCV64); !errors.Is(err, ErrMachine) {
+		t.Errorf("want ErrMachine, got %v", err)
+	}
+}
+
+func TestDisasmSymbol(t *testing.T) {
+	f, err := Open("testdata/driver.dll")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	// Stripped, so both symbols come from the export directory and their
+	// sizes from .pdata.
+	entry, err := f.LookupSymbol("DriverEntry")
+	if err != nil {
+		t.Fatalf("LookupSymbol failed: %v", err)
+	}
+	if entry.Addr != 0x140001000 || entry.Size != 0x10 || !entry.Exported || entry.Ordinal != 1 {
+		t.Errorf("want exported DriverEntry at 0x140001000, got %+v", entry)
+	}
+
+	insns, err := f.DisasmSymbol("DriverEntry")
+	if err != nil {
+		t.Fatalf("DisasmSymbol failed: %v", err)
+	}
+	if len(insns) != 5 || insns[4].Mnemonic != "ret" {
+		t.Fatalf("want 5 instructions ending in ret, got %v", insns)
+	}
+	if call := insns[1]; gapstone.Symbolize(call, f) != "helper" {
+		t.Errorf("want call helper, got %s %s", call.Mnemonic, gapstone.Symbolize(call, f))
+	}
+
+	if name, off, ok := f.Lookup(0x140001012); !ok || name != "helper" || off != 2 {
+		t.Errorf("Lookup: want helper+0x2, got %s+0x%x (%v)", name, off, ok)
+	}
+	if _, _, ok := f.Lookup(0x140001018); ok {
+		t.Errorf("Lookup: want nothing past the end of helper")
+	}
+
+	// ld ends .text with the constructor lists, all 0xff, which don't
+	// decode, so only the functions ahead of them are checked.
+	if insns, err := f.DisasmSection(".text"); len(insns) < 7 || insns[6].Address != 0x140001014 {
+		t.Errorf("DisasmSection: want both functions, got %d instructions (%v)", len(insns), err)
+	}
+	if _, err := f.DisasmSection(".nope"); !errors.Is(err, ErrNoSection) {
+		t.Errorf("want ErrNoSection, got %v", err)
+	}
+	if r, ok := gapstone.FindRegion(f.Memory(), 0x140001000); !ok || r.Name != ".text" || r.Perm.String() != "r-x" {
+		t.Errorf("want .text r-x at 0x140001000, got %+v", r)
+	}
+}
@@ -0,0 +1,26 @@
+# Source of driver.dll, built with:
+#
+#   llvm-mc -triple x86_64-pc-windows-msvc -filetype=obj driver.s -o driver.obj
+#   ld -m i386pep --dll -s --export-all-symbols -e DriverEntry \
+#       --image-base=0x140000000 -o driver.dll driver.obj
+
+	.text
+	.globl	DriverEntry
+	.seh_proc DriverEntry
+DriverEntry:
+	sub	$40, %rsp
+	.seh_stackalloc 40
+	.seh_endprologue
+	call	helper
+	xor	%eax, %eax
+	add	$40, %rsp
+	ret
+	.seh_endproc
+
+	.globl	helper
+	.seh_proc helper
+helper:
+	.seh_endprologue
+	lea	1(%rcx), %rax
+	ret
+	.seh_endproc
@@ -0,0 +1,128 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package gapstone
+
+import "sort"
+
+// An instruction start where a kprobe could go, see ProbeableOffsets.
+type ProbePoint struct {
+	Offset uint64 // From the first instruction
+	Addr   uint64
+	Safe   bool
+	Reason string // Why the instruction can't be probed, empty when Safe
+}
+
+// List every instruction start in insns, a function disassembled in order,
+// flagging the instructions a kprobe must not be placed on: those kprobes
+// rejects or can't single step (int3, iret, segment register loads, MSR
+// access and X86_GRP_PRIVILEGE on x86; exception generating instructions on
+// arm64), and on arm64 everything from a load exclusive to its store
+// exclusive, where the breakpoint exception would clear the monitor and
+// the store never succeed. Needs CS_OPT_DETAIL.
+func ProbeableOffsets(insns []Instruction) []ProbePoint {
+	if len(insns) == 0 {
+		return nil
+	}
+	start := uint64(insns[0].Address)
+	points := make([]ProbePoint, len(insns))
+	exclusive := false
+	for i, insn := range insns {
+		p := &points[i]
+		p.Addr = uint64(insn.Address)
+		p.Offset = p.Addr - start
+
+		switch {
+		case insn.X86 != nil:
+			p.Reason = x86ProbeReason(insn)
+		case insn.Arm64 != nil:
+			switch {
+			case arm64LoadExclusive(insn.Id):
+				p.Reason = "load exclusive"
+				exclusive = true
+			case arm64StoreExclusive(insn.Id):
+				p.Reason = "store exclusive"
+				exclusive = false
+			case exclusive:
+				p.Reason = "inside a load/store exclusive sequence"
+			default:
+				p.Reason = arm64ProbeReason(insn)
+			}
+		}
+		p.Safe = p.Reason == ""
+	}
+	return points
+}
+
+// Find the probe point at offset. ok is false when offset is not an
+// instruction boundary.
+func FindProbePoint(points []ProbePoint, offset uint64) (p ProbePoint, ok bool) {
+	i := sort.Search(len(points), func(i int) bool {
+		return points[i].Offset >= offset
+	})
+	if i < len(points) && points[i].Offset == offset {
+		return points[i], true
+	}
+	return ProbePoint{}, false
+}
+
+func x86ProbeReason(insn Instruction) string {
+	switch insn.Id {
+	case X86_INS_INT3, X86_INS_INT, X86_INS_INT1, X86_INS_INTO:
+		return "software interrupt"
+	case X86_INS_IRET, X86_INS_IRETD, X86_INS_IRETQ:
+		return "interrupt return"
+	case X86_INS_RDMSR, X86_INS_WRMSR:
+		return "MSR access"
+	case X86_INS_LDS, X86_INS_LES, X86_INS_LFS, X86_INS_LGS, X86_INS_LSS:
+		return "segment register load"
+	}
+	for _, op := range insn.X86.Operands {
+		if op.Type != X86_OP_REG || op.Access&CS_AC_WRITE == 0 {
+			continue
+		}
+		switch op.Reg {
+		case X86_REG_CS, X86_REG_DS, X86_REG_ES, X86_REG_FS, X86_REG_GS, X86_REG_SS:
+			return "segment register load"
+		}
+	}
+	if insn.InGroup(X86_GRP_PRIVILEGE) {
+		return "privileged instruction"
+	}
+	return ""
+}
+
+func arm64ProbeReason(insn Instruction) string {
+	switch insn.Id {
+	case ARM64_INS_BRK, ARM64_INS_HLT, ARM64_INS_SVC, ARM64_INS_HVC, ARM64_INS_SMC:
+		return "exception generating"
+	case ARM64_INS_ERET:
+		return "exception return"
+	}
+	return ""
+}
+
+func arm64LoadExclusive(id uint) bool {
+	switch id {
+	case ARM64_INS_LDXR, ARM64_INS_LDXRB, ARM64_INS_LDXRH, ARM64_INS_LDXP,
+		ARM64_INS_LDAXR, ARM64_INS_LDAXRB, ARM64_INS_LDAXRH, ARM64_INS_LDAXP:
+		return true
+	}
+	return false
+}
+
+func arm64StoreExclusive(id uint) bool {
+	switch id {
+	case ARM64_INS_STXR, ARM64_INS_STXRB, ARM64_INS_STXRH, ARM64_INS_STXP,
+		ARM64_INS_STLXR, ARM64_INS_STLXRB, ARM64_INS_STLXRH, ARM64_INS_STLXP:
+		return true
+	}
+	return false
+}
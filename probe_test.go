@@ -0,0 +1,88 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package gapstone
+
+import "testing"
+
+func checkProbePoints(t *testing.T, points []ProbePoint, want map[uint64]string) {
+	if len(points) != len(want) {
+		t.Errorf("%d probe points, want %d", len(points), len(want))
+	}
+	for off, reason := range want {
+		p, ok := FindProbePoint(points, off)
+		if !ok {
+			t.Errorf("no probe point at +%d", off)
+			continue
+		}
+		if p.Reason != reason || p.Safe != (reason == "") {
+			t.Errorf("+%d: safe %v reason %q, want %q", off, p.Safe, p.Reason, reason)
+		}
+	}
+}
+
+func TestProbeableOffsetsX86(t *testing.T) {
+	engine := entryEngine(t, CS_ARCH_X86, CS_MODE_64)
+	defer engine.Close()
+
+	code := "\x55" + // push rbp
+		"\xfa" + // cli
+		"\x0f\x32" + // rdmsr
+		"\x8e\xd8" + // mov ds, eax
+		"\x0f\xa1" + // pop fs
+		"\xcc" + // int3
+		"\x48\xcf" + // iretq
+		"\xc3" // ret
+	insns, err := engine.Disasm([]byte(code), 0x1000, 0)
+	if err != nil {
+		t.Fatalf("Disassembly error: %v", err)
+	}
+	points := ProbeableOffsets(insns)
+	checkProbePoints(t, points, map[uint64]string{
+		0:  "",
+		1:  "privileged instruction",
+		2:  "MSR access",
+		4:  "segment register load",
+		6:  "segment register load",
+		8:  "software interrupt",
+		9:  "interrupt return",
+		11: "",
+	})
+	if _, ok := FindProbePoint(points, 3); ok {
+		t.Error("+3, inside rdmsr, is a probe point")
+	}
+	if p, _ := FindProbePoint(points, 11); p.Addr != 0x100b {
+		t.Errorf("+11 at 0x%x", p.Addr)
+	}
+}
+
+func TestProbeableOffsetsArm64(t *testing.T) {
+	engine := entryEngine(t, CS_ARCH_ARM64, CS_MODE_ARM)
+	defer engine.Close()
+
+	code := "\x08\xfc\x5f\x88" + // ldaxr w8, [x0]
+		"\x08\x05\x00\x11" + // add w8, w8, #1
+		"\x08\xfc\x09\x88" + // stlxr w9, w8, [x0]
+		"\xa9\xff\xff\x35" + // cbnz w9, 0x1000
+		"\x01\x00\x00\xd4" + // svc #0
+		"\xc0\x03\x5f\xd6" // ret
+	insns, err := engine.Disasm([]byte(code), 0x1000, 0)
+	if err != nil {
+		t.Fatalf("Disassembly error: %v", err)
+	}
+	checkProbePoints(t, ProbeableOffsets(insns), map[uint64]string{
+		0:  "load exclusive",
+		4:  "inside a load/store exclusive sequence",
+		8:  "store exclusive",
+		12: "",
+		16: "exception generating",
+		20: "",
+	})
+}
@@ -0,0 +1,204 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package gapstone
+
+import "fmt"
+
+// What a register is for, see RegInfo
+type RegClass int
+
+const (
+	RegOther   RegClass = iota
+	RegGPR              // General purpose, including the stack pointer
+	RegVector           // SIMD and floating point
+	RegFlags            // Condition codes
+	RegSegment          // x86 segment selectors
+	RegSystem           // Control, debug and special purpose
+	RegPC               // Instruction pointer
+)
+
+func (c RegClass) String() string {
+	switch c {
+	case RegOther:
+		return "other"
+	case RegGPR:
+		return "gpr"
+	case RegVector:
+		return "vector"
+	case RegFlags:
+		return "flags"
+	case RegSegment:
+		return "segment"
+	case RegSystem:
+		return "system"
+	case RegPC:
+		return "pc"
+	}
+	return fmt.Sprintf("RegClass(%d)", int(c))
+}
+
+// Where a register lives: bits [Offset, Offset+Width) of Full
+type RegisterInfo struct {
+	Full   uint // The containing full-width register, the register itself if it is one
+	Offset uint // In bits, from the least significant
+	Width  uint // In bits
+	Class  RegClass
+}
+
+// Describe reg, an arch *_REG_* constant. x86 registers live in their 64
+// bit register whatever the mode, eax in rax. Known for x86, arm64, arm and
+// PPC.
+func RegInfo(arch int, reg uint) (RegisterInfo, bool) {
+	info, ok := regInfos[arch][reg]
+	return info, ok
+}
+
+// The full-width register containing reg, or reg when it is not known.
+func Canonical(arch int, reg uint) uint {
+	if info, ok := RegInfo(arch, reg); ok {
+		return info.Full
+	}
+	return reg
+}
+
+// Check if writing a changes b or the other way round: al and ax overlap,
+// al and ah don't. Registers RegInfo doesn't know only overlap themselves.
+func Overlaps(arch int, a, b uint) bool {
+	if a == b {
+		return true
+	}
+	ia, ok := RegInfo(arch, a)
+	if !ok {
+		return false
+	}
+	ib, ok := RegInfo(arch, b)
+	if !ok {
+		return false
+	}
+	return ia.Full == ib.Full && ia.Offset < ib.Offset+ib.Width && ib.Offset < ia.Offset+ia.Width
+}
+
+// Register tables by arch
+var regInfos = map[int]regTable{
+	CS_ARCH_X86:   x86RegInfos(),
+	CS_ARCH_ARM64: arm64RegInfos(),
+	CS_ARCH_ARM:   armRegInfos(),
+	CS_ARCH_PPC:   ppcRegInfos(),
+}
+
+type regTable map[uint]RegisterInfo
+
+// Add the full-width register and its parts, each as reg, offset, width
+func (t regTable) add(class RegClass, full, width uint, parts ...uint) {
+	t[full] = RegisterInfo{Full: full, Width: width, Class: class}
+	for i := 0; i+2 < len(parts); i += 3 {
+		t[parts[i]] = RegisterInfo{Full: full, Offset: parts[i+1], Width: parts[i+2], Class: class}
+	}
+}
+
+func x86RegInfos() regTable {
+	t := make(regTable)
+	t.add(RegGPR, X86_REG_RAX, 64, X86_REG_EAX, 0, 32, X86_REG_AX, 0, 16, X86_REG_AH, 8, 8, X86_REG_AL, 0, 8)
+	t.add(RegGPR, X86_REG_RBX, 64, X86_REG_EBX, 0, 32, X86_REG_BX, 0, 16, X86_REG_BH, 8, 8, X86_REG_BL, 0, 8)
+	t.add(RegGPR, X86_REG_RCX, 64, X86_REG_ECX, 0, 32, X86_REG_CX, 0, 16, X86_REG_CH, 8, 8, X86_REG_CL, 0, 8)
+	t.add(RegGPR, X86_REG_RDX, 64, X86_REG_EDX, 0, 32, X86_REG_DX, 0, 16, X86_REG_DH, 8, 8, X86_REG_DL, 0, 8)
+	t.add(RegGPR, X86_REG_RSI, 64, X86_REG_ESI, 0, 32, X86_REG_SI, 0, 16, X86_REG_SIL, 0, 8)
+	t.add(RegGPR, X86_REG_RDI, 64, X86_REG_EDI, 0, 32, X86_REG_DI, 0, 16, X86_REG_DIL, 0, 8)
+	t.add(RegGPR, X86_REG_RBP, 64, X86_REG_EBP, 0, 32, X86_REG_BP, 0, 16, X86_REG_BPL, 0, 8)
+	t.add(RegGPR, X86_REG_RSP, 64, X86_REG_ESP, 0, 32, X86_REG_SP, 0, 16, X86_REG_SPL, 0, 8)
+	for n := uint(0); n < 8; n++ {
+		t.add(RegGPR, X86_REG_R8+n, 64, X86_REG_R8D+n, 0, 32, X86_REG_R8W+n, 0, 16, X86_REG_R8B+n, 0, 8)
+	}
+	t.add(RegPC, X86_REG_RIP, 64, X86_REG_EIP, 0, 32, X86_REG_IP, 0, 16)
+	t.add(RegFlags, X86_REG_EFLAGS, 32)
+	t.add(RegFlags, X86_REG_FPSW, 16)
+	for _, r := range []uint{X86_REG_CS, X86_REG_DS, X86_REG_ES, X86_REG_FS, X86_REG_GS, X86_REG_SS} {
+		t.add(RegSegment, r, 16)
+	}
+	for n := uint(0); n < 16; n++ {
+		t.add(RegSystem, X86_REG_CR0+n, 64)
+		t.add(RegSystem, X86_REG_DR0+n, 64)
+	}
+	for n := uint(0); n < 32; n++ {
+		t.add(RegVector, X86_REG_ZMM0+n, 512, X86_REG_YMM0+n, 0, 256, X86_REG_XMM0+n, 0, 128)
+	}
+	// MMX registers alias the mantissa of the x87 ones. Capstone names
+	// those st0-st7, so mm2 is taken to be in st2, which holds as long as
+	// the x87 stack top is 0, as it is in MMX code.
+	for n := uint(0); n < 8; n++ {
+		t.add(RegVector, X86_REG_ST0+n, 80, X86_REG_MM0+n, 0, 64)
+		t.add(RegVector, X86_REG_K0+n, 64)
+	}
+	return t
+}
+
+func arm64RegInfos() regTable {
+	t := make(regTable)
+	for n := uint(0); n <= 28; n++ {
+		t.add(RegGPR, ARM64_REG_X0+n, 64, ARM64_REG_W0+n, 0, 32)
+	}
+	t.add(RegGPR, ARM64_REG_X29, 64, ARM64_REG_W29, 0, 32)
+	t.add(RegGPR, ARM64_REG_X30, 64, ARM64_REG_W30, 0, 32)
+	t.add(RegGPR, ARM64_REG_SP, 64, ARM64_REG_WSP, 0, 32)
+	t.add(RegGPR, ARM64_REG_XZR, 64, ARM64_REG_WZR, 0, 32)
+	for n := uint(0); n < 32; n++ {
+		t.add(RegVector, ARM64_REG_V0+n, 128,
+			ARM64_REG_Q0+n, 0, 128, ARM64_REG_D0+n, 0, 64, ARM64_REG_S0+n, 0, 32,
+			ARM64_REG_H0+n, 0, 16, ARM64_REG_B0+n, 0, 8)
+	}
+	t.add(RegFlags, ARM64_REG_NZCV, 32)
+	return t
+}
+
+func armRegInfos() regTable {
+	t := make(regTable)
+	for n := uint(0); n <= 12; n++ {
+		t.add(RegGPR, ARM_REG_R0+n, 32)
+	}
+	t.add(RegGPR, ARM_REG_SP, 32)
+	t.add(RegGPR, ARM_REG_LR, 32)
+	t.add(RegPC, ARM_REG_PC, 32)
+	// s0-s31 pair up into d0-d15, d0-d31 into q0-q15
+	for n := uint(0); n < 16; n++ {
+		parts := []uint{ARM_REG_D0 + 2*n, 0, 64, ARM_REG_D0 + 2*n + 1, 64, 64}
+		for i := uint(0); n < 8 && i < 4; i++ {
+			parts = append(parts, ARM_REG_S0+4*n+i, 32*i, 32)
+		}
+		t.add(RegVector, ARM_REG_Q0+n, 128, parts...)
+	}
+	t.add(RegFlags, ARM_REG_CPSR, 32, ARM_REG_APSR, 0, 32, ARM_REG_APSR_NZCV, 28, 4)
+	t.add(RegSystem, ARM_REG_SPSR, 32)
+	t.add(RegSystem, ARM_REG_FPSCR, 32)
+	return t
+}
+
+func ppcRegInfos() regTable {
+	t := make(regTable)
+	for n := uint(0); n < 32; n++ {
+		t.add(RegGPR, PPC_REG_R0+n, 64)
+		// The FPRs are the high halves of vs0-vs31, the vector
+		// registers vs32-vs63
+		t.add(RegVector, PPC_REG_VS0+n, 128, PPC_REG_F0+n, 64, 64)
+		t.add(RegVector, PPC_REG_VS32+n, 128, PPC_REG_V0+n, 0, 128)
+	}
+	// cr0-cr7 are fields of the condition register, which Capstone has no
+	// name for, so each stands for itself with its lt, gt, eq and so bits
+	for n := uint(0); n < 8; n++ {
+		t.add(RegFlags, PPC_REG_CR0+n, 4,
+			PPC_REG_CR0LT+n, 3, 1, PPC_REG_CR0GT+n, 2, 1,
+			PPC_REG_CR0EQ+n, 1, 1, PPC_REG_CR0UN+n, 0, 1)
+	}
+	t.add(RegFlags, PPC_REG_XER, 64, PPC_REG_CARRY, 29, 1)
+	t.add(RegSystem, PPC_REG_LR8, 64, PPC_REG_LR, 0, 32)
+	t.add(RegSystem, PPC_REG_CTR8, 64, PPC_REG_CTR, 0, 32)
+	t.add(RegSystem, PPC_REG_VRSAVE, 32)
+	return t
+}
@@ -0,0 +1,80 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package gapstone
+
+import "testing"
+
+func TestRegInfo(t *testing.T) {
+	info, ok := RegInfo(CS_ARCH_X86, X86_REG_AH)
+	want := RegisterInfo{Full: X86_REG_RAX, Offset: 8, Width: 8, Class: RegGPR}
+	if !ok || info != want {
+		t.Errorf("RegInfo(ah) = %+v, want %+v", info, want)
+	}
+	if info, _ := RegInfo(CS_ARCH_X86, X86_REG_FS); info.Class != RegSegment || info.Class.String() != "segment" {
+		t.Errorf("RegInfo(fs) = %+v", info)
+	}
+	if _, ok := RegInfo(CS_ARCH_MIPS, 1); ok {
+		t.Error("RegInfo knows mips")
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	for _, tt := range []struct {
+		arch      int
+		reg, want uint
+	}{
+		{CS_ARCH_X86, X86_REG_R9B, X86_REG_R9},
+		{CS_ARCH_X86, X86_REG_EIP, X86_REG_RIP},
+		{CS_ARCH_X86, X86_REG_XMM17, X86_REG_ZMM17},
+		{CS_ARCH_ARM64, ARM64_REG_W3, ARM64_REG_X3},
+		{CS_ARCH_ARM64, ARM64_REG_W30, ARM64_REG_X30},
+		{CS_ARCH_ARM64, ARM64_REG_S5, ARM64_REG_V5},
+		{CS_ARCH_ARM, ARM_REG_S5, ARM_REG_Q1},
+		{CS_ARCH_ARM, ARM_REG_D31, ARM_REG_Q15},
+		{CS_ARCH_PPC, PPC_REG_F3, PPC_REG_VS3},
+		{CS_ARCH_PPC, PPC_REG_CR6GT, PPC_REG_CR6},
+		{CS_ARCH_MIPS, 5, 5},
+	} {
+		if got := Canonical(tt.arch, tt.reg); got != tt.want {
+			t.Errorf("Canonical(%d, %d) = %d, want %d", tt.arch, tt.reg, got, tt.want)
+		}
+	}
+}
+
+func TestOverlaps(t *testing.T) {
+	for _, tt := range []struct {
+		arch int
+		a, b uint
+		want bool
+	}{
+		{CS_ARCH_X86, X86_REG_AL, X86_REG_AX, true},
+		{CS_ARCH_X86, X86_REG_AL, X86_REG_AH, false},
+		{CS_ARCH_X86, X86_REG_EAX, X86_REG_RAX, true},
+		{CS_ARCH_X86, X86_REG_EAX, X86_REG_EBX, false},
+		{CS_ARCH_X86, X86_REG_XMM1, X86_REG_ZMM1, true},
+		{CS_ARCH_X86, X86_REG_MM2, X86_REG_ST2, true},
+		{CS_ARCH_ARM64, ARM64_REG_W0, ARM64_REG_X0, true},
+		{CS_ARCH_ARM64, ARM64_REG_B1, ARM64_REG_Q1, true},
+		{CS_ARCH_ARM64, ARM64_REG_B1, ARM64_REG_Q2, false},
+		{CS_ARCH_ARM, ARM_REG_S1, ARM_REG_D0, true},
+		{CS_ARCH_ARM, ARM_REG_S2, ARM_REG_D0, false},
+		{CS_ARCH_ARM, ARM_REG_D3, ARM_REG_Q1, true},
+		{CS_ARCH_PPC, PPC_REG_CR2EQ, PPC_REG_CR2, true},
+		{CS_ARCH_PPC, PPC_REG_CR2EQ, PPC_REG_CR2LT, false},
+		{CS_ARCH_PPC, PPC_REG_F3, PPC_REG_V3, false},
+		{CS_ARCH_MIPS, 5, 5, true},
+		{CS_ARCH_MIPS, 5, 6, false},
+	} {
+		if got := Overlaps(tt.arch, tt.a, tt.b); got != tt.want {
+			t.Errorf("Overlaps(%d, %d, %d) = %v, want %v", tt.arch, tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package gapstone
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+var (
+	ErrOutOfRange     = errors.New("relocated target out of range")
+	ErrNotRelocatable = errors.New("instruction can't be relocated")
+)
+
+// Re-encode insn to run at newAddr, as when copying it into a trampoline,
+// so that PC-relative operands still refer to the same place: x86 rel8,
+// rel16 and rel32 branches and RIP-relative displacements, and arm64 b, bl,
+// b.cond, cbz, tbz, adr, adrp and ldr (literal). A rel8 branch that no
+// longer reaches is widened to rel32; loop and jrcxz, which have no rel32
+// form, become a rel8 hop over a jmp onto a jmp rel32 to the target.
+// Anything else is copied as is. Needs CS_OPT_DETAIL.
+func Relocate(insn Instruction, newAddr uint64) ([]byte, error) {
+	switch {
+	case insn.X86 != nil:
+		return relocateX86(insn, newAddr)
+	case insn.Arm64 != nil:
+		return relocateArm64(insn, newAddr)
+	}
+	return nil, fmt.Errorf("%w: unsupported arch", ErrNotRelocatable)
+}
+
+// Does v fit a signed field of bits?
+func fitsSigned(v int64, bits uint) bool {
+	return v >= -(1<<(bits-1)) && v < 1<<(bits-1)
+}
+
+func putSigned(b []byte, v int64) {
+	switch len(b) {
+	case 1:
+		b[0] = byte(v)
+	case 2:
+		binary.LittleEndian.PutUint16(b, uint16(v))
+	case 4:
+		binary.LittleEndian.PutUint32(b, uint32(v))
+	}
+}
+
+func relocateX86(insn Instruction, newAddr uint64) ([]byte, error) {
+	out := slices.Clone(insn.Bytes)
+	enc := insn.X86.Encoding
+	size := uint64(insn.Size)
+
+	if flow := insn.Flow(); flow.Direct && enc.ImmSize > 0 {
+		rel := int64(flow.Target - (newAddr + size))
+		field := out[enc.ImmOffset : enc.ImmOffset+enc.ImmSize]
+		if fitsSigned(rel, uint(enc.ImmSize)*8) {
+			putSigned(field, rel)
+			return out, nil
+		}
+		if enc.ImmSize != 1 {
+			return nil, fmt.Errorf("%w: 0x%x from 0x%x", ErrOutOfRange, flow.Target, newAddr)
+		}
+		return widenX86(insn, out[:enc.ImmOffset-1], out[enc.ImmOffset-1], flow.Target, newAddr)
+	}
+
+	for _, op := range insn.X86.Operands {
+		if op.Type != X86_OP_MEM || op.Mem.Base != X86_REG_RIP || enc.DispSize != 4 {
+			continue
+		}
+		target := uint64(insn.Address) + size + uint64(op.Mem.Disp)
+		disp := int64(target - (newAddr + size))
+		if !fitsSigned(disp, 32) {
+			return nil, fmt.Errorf("%w: 0x%x from 0x%x", ErrOutOfRange, target, newAddr)
+		}
+		putSigned(out[enc.DispOffset:enc.DispOffset+4], disp)
+		return out, nil
+	}
+	return out, nil
+}
+
+// Rewrite a rel8 branch, prefix and opcode, as rel32.
+func widenX86(insn Instruction, prefix []byte, opcode byte, target, newAddr uint64) ([]byte, error) {
+	out := slices.Clone(prefix)
+	switch {
+	case opcode == 0xeb: // jmp
+		out = append(out, 0xe9)
+	case opcode >= 0x70 && opcode <= 0x7f: // jcc
+		out = append(out, 0x0f, opcode+0x10)
+	case opcode >= 0xe0 && opcode <= 0xe3: // loopne, loope, loop, jrcxz
+		// op +2; jmp +5; jmp target
+		out = append(out, opcode, 0x02, 0xeb, 0x05, 0xe9)
+	default:
+		return nil, fmt.Errorf("%w: %s with a rel8 target out of range", ErrNotRelocatable, insn.Mnemonic)
+	}
+	rel := int64(target - (newAddr + uint64(len(out)) + 4))
+	if !fitsSigned(rel, 32) {
+		return nil, fmt.Errorf("%w: 0x%x from 0x%x", ErrOutOfRange, target, newAddr)
+	}
+	return binary.LittleEndian.AppendUint32(out, uint32(rel)), nil
+}
+
+// PC-relative arm64 encodings: mask, value, the offset field's shift and
+// width, and how far the offset is scaled
+var arm64PCRel = []struct {
+	mask, value  uint32
+	shift, width uint
+	scale        uint
+}{
+	{0x7c000000, 0x14000000, 0, 26, 2}, // b, bl
+	{0xff000010, 0x54000000, 5, 19, 2}, // b.cond
+	{0x7e000000, 0x34000000, 5, 19, 2}, // cbz, cbnz
+	{0x7e000000, 0x36000000, 5, 14, 2}, // tbz, tbnz
+	{0x3b000000, 0x18000000, 5, 19, 2}, // ldr (literal), ldrsw, prfm
+}
+
+func relocateArm64(insn Instruction, newAddr uint64) ([]byte, error) {
+	if len(insn.Bytes) != 4 {
+		return nil, fmt.Errorf("%w: %d byte instruction", ErrNotRelocatable, len(insn.Bytes))
+	}
+	word := binary.LittleEndian.Uint32(insn.Bytes)
+	addr := uint64(insn.Address)
+
+	// adr and adrp split their offset into immlo, bits 29-30, and immhi,
+	// bits 5-23
+	if word&0x1f000000 == 0x10000000 {
+		imm := int64(word>>29&3 | (word>>5&0x7ffff)<<2)
+		imm = imm << 43 >> 43
+		var target uint64
+		var off int64
+		if word&0x80000000 != 0 { // adrp
+			target = addr&^0xfff + uint64(imm<<12)
+			off = int64(target>>12 - newAddr>>12)
+		} else {
+			target = addr + uint64(imm)
+			off = int64(target - newAddr)
+		}
+		if !fitsSigned(off, 21) {
+			return nil, fmt.Errorf("%w: 0x%x from 0x%x", ErrOutOfRange, target, newAddr)
+		}
+		word = word&^(3<<29|0x7ffff<<5) | uint32(off&3)<<29 | uint32(off>>2&0x7ffff)<<5
+		return binary.LittleEndian.AppendUint32(nil, word), nil
+	}
+
+	for _, e := range arm64PCRel {
+		if word&e.mask != e.value {
+			continue
+		}
+		fieldMask := uint32(1)<<e.width - 1
+		imm := int64(word >> e.shift & fieldMask)
+		imm = imm << (64 - e.width) >> (64 - e.width)
+		target := addr + uint64(imm<<e.scale)
+		off := int64(target - newAddr)
+		if off&(1<<e.scale-1) != 0 || !fitsSigned(off>>e.scale, e.width) {
+			return nil, fmt.Errorf("%w: 0x%x from 0x%x", ErrOutOfRange, target, newAddr)
+		}
+		word = word&^(fieldMask<<e.shift) | uint32(off>>e.scale)&fieldMask<<e.shift
+		return binary.LittleEndian.AppendUint32(nil, word), nil
+	}
+	return slices.Clone(insn.Bytes), nil
+}
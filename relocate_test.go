@@ -0,0 +1,91 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package gapstone
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func checkRelocate(t *testing.T, engine Engine, code string, newAddr uint64, want string) {
+	insns, err := engine.Disasm([]byte(code), 0x1000, 1)
+	if err != nil {
+		t.Fatalf("Disassembly error: %v", err)
+	}
+	got, err := Relocate(insns[0], newAddr)
+	if err != nil {
+		t.Errorf("%s %s to 0x%x: %v", insns[0].Mnemonic, insns[0].OpStr, newAddr, err)
+		return
+	}
+	if !bytes.Equal(got, []byte(want)) {
+		t.Errorf("%s %s to 0x%x: got % x, want % x", insns[0].Mnemonic, insns[0].OpStr, newAddr, got, []byte(want))
+	}
+}
+
+func TestRelocateX86(t *testing.T) {
+	engine := entryEngine(t, CS_ARCH_X86, CS_MODE_64)
+	defer engine.Close()
+
+	for _, tc := range []struct {
+		code    string
+		newAddr uint64
+		want    string
+	}{
+		{"\xe8\xfb\x0f\x00\x00", 0x3000, "\xe8\xfb\xef\xff\xff"},                                         // call 0x2000
+		{"\xeb\x10", 0x1008, "\xeb\x08"},                                                                 // jmp 0x1012, still rel8
+		{"\xeb\x10", 0x1100, "\xe9\x0d\xff\xff\xff"},                                                     // jmp 0x1012, widened
+		{"\x75\x10", 0x1100, "\x0f\x85\x0c\xff\xff\xff"},                                                 // jne 0x1012
+		{"\xe3\x10", 0x1100, "\xe3\x02\xeb\x05\xe9\x09\xff\xff\xff"},                                     // jrcxz 0x1012
+		{"\x48\x8b\x05\x10\x00\x00\x00", 0x2000, "\x48\x8b\x05\x10\xf0\xff\xff"},                         // mov rax, [rip + 0x10]
+		{"\xc7\x05\x10\x00\x00\x00\x01\x00\x00\x00", 0x2000, "\xc7\x05\x10\xf0\xff\xff\x01\x00\x00\x00"}, // mov dword ptr [rip + 0x10], 1
+		{"\x55", 0x2000, "\x55"},                                                                         // push rbp
+	} {
+		checkRelocate(t, engine, tc.code, tc.newAddr, tc.want)
+	}
+
+	insns, err := engine.Disasm([]byte("\xe8\xfb\x0f\x00\x00"), 0x1000, 1)
+	if err != nil {
+		t.Fatalf("Disassembly error: %v", err)
+	}
+	if _, err := Relocate(insns[0], 0x100000000); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("call 4GB away: want ErrOutOfRange, got %v", err)
+	}
+}
+
+func TestRelocateArm64(t *testing.T) {
+	engine := entryEngine(t, CS_ARCH_ARM64, CS_MODE_ARM)
+	defer engine.Close()
+
+	for _, tc := range []struct {
+		code string
+		want string
+	}{
+		{"\x10\x00\x00\x94", "\x10\xfc\xff\x97"}, // bl 0x1040
+		{"\x80\x00\x00\x54", "\x80\x80\xff\x54"}, // b.eq 0x1010
+		{"\x40\x00\x00\xb4", "\x40\x80\xff\xb4"}, // cbz x0, 0x1008
+		{"\x60\x00\x08\x36", "\x60\x80\x0f\x36"}, // tbz w0, #1, 0x100c
+		{"\x51\x00\x00\x58", "\x51\x80\xff\x58"}, // ldr x17, 0x1008
+		{"\x82\x00\x00\x10", "\x82\x80\xff\x10"}, // adr x2, 0x1010
+		{"\x70\x00\x00\xf0", "\x70\x00\x00\xd0"}, // adrp x16, 0x10000
+		{"\xfd\x7b\xbf\xa9", "\xfd\x7b\xbf\xa9"}, // stp x29, x30, [sp, #-0x10]!
+	} {
+		checkRelocate(t, engine, tc.code, 0x2000, tc.want)
+	}
+
+	insns, err := engine.Disasm([]byte("\x80\x00\x00\x54"), 0x1000, 1)
+	if err != nil {
+		t.Fatalf("Disassembly error: %v", err)
+	}
+	if _, err := Relocate(insns[0], 0x200000); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("b.eq 2MB away: want ErrOutOfRange, got %v", err)
+	}
+}
@@ -0,0 +1,245 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package gapstone
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrSignature = errors.New("malformed signature")
+
+// A byte pattern with wildcards, as in IDA and YARA: 48 8B 05 ?? ?? ?? ??
+type Signature struct {
+	Bytes []byte
+	Mask  []byte // Per byte, the bits of Bytes that have to match
+	Sizes []int  // Instruction sizes, when known, to validate matches against
+}
+
+// Build a signature from insns, masking the parts that change from one
+// build to the next: displacements, immediates and relative branch
+// targets. x86 uses X86Encoding, arm64 a table of instruction fields;
+// elsewhere direct branches are wildcarded whole and the rest kept. Needs
+// CS_OPT_DETAIL.
+func MakeSignature(insns []Instruction) Signature {
+	var sig Signature
+	for _, insn := range insns {
+		mask := bytes.Repeat([]byte{0xff}, len(insn.Bytes))
+		switch {
+		case insn.X86 != nil:
+			enc := insn.X86.Encoding
+			wildcard(mask, int(enc.DispOffset), int(enc.DispSize))
+			wildcard(mask, int(enc.ImmOffset), int(enc.ImmSize))
+		case insn.Arm64 != nil && len(insn.Bytes) == 4:
+			m := arm64FieldMask(binary.LittleEndian.Uint32(insn.Bytes))
+			binary.LittleEndian.PutUint32(mask, m)
+		case insn.Flow().Direct:
+			wildcard(mask, 0, len(mask))
+		}
+		sig.Bytes = append(sig.Bytes, insn.Bytes...)
+		sig.Mask = append(sig.Mask, mask...)
+		sig.Sizes = append(sig.Sizes, len(insn.Bytes))
+	}
+	for i := range sig.Bytes {
+		sig.Bytes[i] &= sig.Mask[i]
+	}
+	return sig
+}
+
+func wildcard(mask []byte, off, n int) {
+	if n > 0 && off+n <= len(mask) {
+		clear(mask[off : off+n])
+	}
+}
+
+// arm64 instructions with a variable field: mask, value and the field
+var arm64Fields = []struct {
+	mask, value, field uint32
+}{
+	{0x7c000000, 0x14000000, 0x03ffffff}, // b, bl: imm26
+	{0xff000010, 0x54000000, 0x00ffffe0}, // b.cond: imm19
+	{0x7e000000, 0x34000000, 0x00ffffe0}, // cbz, cbnz: imm19
+	{0x7e000000, 0x36000000, 0x0007ffe0}, // tbz, tbnz: imm14
+	{0x3b000000, 0x18000000, 0x00ffffe0}, // ldr (literal): imm19
+	{0x1f000000, 0x10000000, 0x60ffffe0}, // adr, adrp: immlo, immhi
+	{0x1f000000, 0x11000000, 0x003ffc00}, // add, sub (immediate): imm12
+	{0x3b000000, 0x39000000, 0x003ffc00}, // ldr, str (unsigned offset): imm12
+	{0x3a000000, 0x28000000, 0x003f8000}, // ldp, stp: imm7
+	{0x1f800000, 0x12800000, 0x001fffe0}, // movn, movz, movk: imm16
+}
+
+// The bits of an arm64 instruction word to keep in a signature
+func arm64FieldMask(word uint32) uint32 {
+	for _, f := range arm64Fields {
+		if word&f.mask == f.value {
+			return ^f.field
+		}
+	}
+	return 0xffffffff
+}
+
+// Render the signature IDA style, uppercase hex with ?? for wildcards. Bytes
+// with some bits masked are rendered as a nibble wildcard, A? or ?A, when
+// they can be, and as ?? otherwise.
+func (s Signature) String() string {
+	var b strings.Builder
+	for i, c := range s.Bytes {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		switch s.Mask[i] {
+		case 0xff:
+			fmt.Fprintf(&b, "%02X", c)
+		case 0xf0:
+			fmt.Fprintf(&b, "%X?", c>>4)
+		case 0x0f:
+			fmt.Fprintf(&b, "?%X", c&0xf)
+		default:
+			b.WriteString("??")
+		}
+	}
+	return b.String()
+}
+
+// Parse an IDA or YARA style pattern: hex bytes separated by spaces, ?? or ?
+// for a wildcard byte, and A? or ?A for a nibble wildcard. YARA braces
+// around the pattern are allowed.
+func ParseSignature(pattern string) (Signature, error) {
+	var sig Signature
+	pattern = strings.TrimSpace(pattern)
+	pattern = strings.TrimSuffix(strings.TrimPrefix(pattern, "{"), "}")
+	for _, tok := range strings.Fields(pattern) {
+		var b, m byte
+		switch {
+		case tok == "?" || tok == "??":
+		case len(tok) == 2 && (tok[0] == '?' || tok[1] == '?'):
+			hex, shift := tok[1:], 0
+			if tok[1] == '?' {
+				hex, shift = tok[:1], 4
+			}
+			v, err := strconv.ParseUint(hex, 16, 8)
+			if err != nil {
+				return Signature{}, fmt.Errorf("%w: %q", ErrSignature, tok)
+			}
+			b, m = byte(v)<<shift, 0x0f<<shift
+		case len(tok) == 2:
+			v, err := strconv.ParseUint(tok, 16, 8)
+			if err != nil {
+				return Signature{}, fmt.Errorf("%w: %q", ErrSignature, tok)
+			}
+			b, m = byte(v), 0xff
+		default:
+			return Signature{}, fmt.Errorf("%w: %q", ErrSignature, tok)
+		}
+		sig.Bytes = append(sig.Bytes, b)
+		sig.Mask = append(sig.Mask, m)
+	}
+	if len(sig.Bytes) == 0 {
+		return Signature{}, fmt.Errorf("%w: empty", ErrSignature)
+	}
+	return sig, nil
+}
+
+// Check if data starts with the signature.
+func (s Signature) Match(data []byte) bool {
+	if len(data) < len(s.Bytes) {
+		return false
+	}
+	for i, c := range s.Bytes {
+		if data[i]&s.Mask[i] != c {
+			return false
+		}
+	}
+	return true
+}
+
+// The longest run of fully fixed bytes, to search for with bytes.Index
+func (s Signature) anchor() (off, n int) {
+	for i := 0; i < len(s.Mask); {
+		j := i
+		for j < len(s.Mask) && s.Mask[j] == 0xff {
+			j++
+		}
+		if j-i > n {
+			off, n = i, j-i
+		}
+		i = j + 1
+	}
+	return off, n
+}
+
+// Search the executable Regions of mem for sig, returning the addresses of
+// the matches, sorted. A match only counts when the bytes disassemble into
+// whole instructions ending right at the end of the signature, of the same
+// sizes when sig comes from MakeSignature, and on arm64 and other fixed
+// width archs starting on an instruction boundary.
+func (e *Engine) ScanSignature(mem Memory, sig Signature) ([]uint64, error) {
+	if len(sig.Bytes) == 0 {
+		return nil, fmt.Errorf("%w: empty", ErrSignature)
+	}
+	var matches []uint64
+	aoff, alen := sig.anchor()
+	anchor := sig.Bytes[aoff : aoff+alen]
+	align := e.insnAlign()
+
+	for _, r := range mem.Regions() {
+		if r.Perm&PermExec == 0 {
+			continue
+		}
+		data, err := mem.ReadAt(r.Start, int(r.Size))
+		if err != nil {
+			return matches, err
+		}
+		for pos := 0; pos+len(sig.Bytes) <= len(data); pos++ {
+			if alen > 0 {
+				i := bytes.Index(data[pos+aoff:], anchor)
+				if i < 0 {
+					break
+				}
+				pos += i
+				if pos+len(sig.Bytes) > len(data) {
+					break
+				}
+			}
+			addr := r.Start + uint64(pos)
+			if addr%align != 0 || !sig.Match(data[pos:]) {
+				continue
+			}
+			if e.validate(data[pos:pos+len(sig.Bytes)], addr, sig.Sizes) {
+				matches = append(matches, addr)
+			}
+		}
+	}
+	return matches, nil
+}
+
+// Do code and the instructions it decodes into line up with sizes?
+func (e *Engine) validate(code []byte, addr uint64, sizes []int) bool {
+	insns, err := e.Disasm(code, addr, 0)
+	if err != nil {
+		return false
+	}
+	if sizes != nil && len(insns) != len(sizes) {
+		return false
+	}
+	total := 0
+	for i, insn := range insns {
+		if sizes != nil && int(insn.Size) != sizes[i] {
+			return false
+		}
+		total += int(insn.Size)
+	}
+	return total == len(code)
+}
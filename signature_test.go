@@ -0,0 +1,98 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package gapstone
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMakeSignatureX86(t *testing.T) {
+	engine := entryEngine(t, CS_ARCH_X86, CS_MODE_64)
+	defer engine.Close()
+
+	code := "\x48\x8b\x05\x10\x00\x00\x00" + // mov rax, [rip + 0x10]
+		"\xe8\xfb\x0f\x00\x00" + // call
+		"\x55" + // push rbp
+		"\xb8\x05\x00\x00\x00" // mov eax, 5
+	insns, err := engine.Disasm([]byte(code), 0x1000, 0)
+	if err != nil {
+		t.Fatalf("Disassembly error: %v", err)
+	}
+	sig := MakeSignature(insns)
+	want := "48 8B 05 ?? ?? ?? ?? E8 ?? ?? ?? ?? 55 B8 ?? ?? ?? ??"
+	if sig.String() != want {
+		t.Errorf("got %s, want %s", sig, want)
+	}
+	if !reflect.DeepEqual(sig.Sizes, []int{7, 5, 1, 5}) {
+		t.Errorf("Sizes = %v", sig.Sizes)
+	}
+
+	var mem SegmentedMemory
+	text := bytes.Repeat([]byte{0x90}, 0x80)
+	copy(text[0x01:], code)
+	// Another build: other displacement, call target and constant
+	copy(text[0x40:], "\x48\x8b\x05\x20\x30\x00\x00\xe8\x00\x01\x00\x00\x55\xb8\x07\x00\x00\x00")
+	mem.Map(NewBytesMemory(0x1000, text, PermRead|PermExec))
+	mem.Map(NewBytesMemory(0x2000, []byte(code), PermRead))
+
+	matches, err := engine.ScanSignature(&mem, sig)
+	if err != nil {
+		t.Fatalf("ScanSignature failed: %v", err)
+	}
+	if !reflect.DeepEqual(matches, []uint64{0x1001, 0x1040}) {
+		t.Errorf("matches = %x", matches)
+	}
+}
+
+func TestMakeSignatureArm64(t *testing.T) {
+	engine := entryEngine(t, CS_ARCH_ARM64, CS_MODE_ARM)
+	defer engine.Close()
+
+	code := "\xfd\x7b\xbf\xa9" + // stp x29, x30, [sp, #-0x10]!
+		"\x10\x00\x00\x94" + // bl
+		"\xe0\x03\x1f\xaa" // mov x0, xzr
+	insns, err := engine.Disasm([]byte(code), 0x1000, 0)
+	if err != nil {
+		t.Fatalf("Disassembly error: %v", err)
+	}
+	want := "FD ?? ?? A9 ?? ?? ?? ?? E0 03 1F AA"
+	if sig := MakeSignature(insns); sig.String() != want {
+		t.Errorf("got %s, want %s", sig, want)
+	}
+}
+
+func TestParseSignature(t *testing.T) {
+	sig, err := ParseSignature("{ 48 8b ? ?? 4? ?5 }")
+	if err != nil {
+		t.Fatalf("ParseSignature failed: %v", err)
+	}
+	if s := sig.String(); s != "48 8B ?? ?? 4? ?5" {
+		t.Errorf("String() = %s", s)
+	}
+	if !sig.Match([]byte{0x48, 0x8b, 0x01, 0x02, 0x4f, 0xa5, 0xff}) {
+		t.Error("no match")
+	}
+	if sig.Match([]byte{0x48, 0x8b, 0x01, 0x02, 0x5f, 0xa5}) {
+		t.Error("nibble wildcard matched 5f")
+	}
+	if sig.Match([]byte{0x48, 0x8b}) {
+		t.Error("short data matched")
+	}
+
+	for _, bad := range []string{"", "48 8", "48 zz", "48 ???"} {
+		if _, err := ParseSignature(bad); !errors.Is(err, ErrSignature) {
+			t.Errorf("%q: want ErrSignature, got %v", bad, err)
+		}
+	}
+}
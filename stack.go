@@ -0,0 +1,443 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package gapstone
+
+import (
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Stack pointer before an instruction, see StackFrame
+type SPDelta struct {
+	Addr  uint64
+	Delta int64 // The stack pointer minus its value on entry
+	Known bool
+}
+
+// A stack location the function accesses through a memory operand based on
+// the stack or frame pointer
+type StackSlot struct {
+	Offset int64    // From the stack pointer on entry: on x86 the return address is at 0, stack arguments start at 8
+	Size   uint     // In bytes, 0 when unknown
+	Access uint8    // CS_AC_READ, CS_AC_WRITE or both
+	Insns  []uint64 // Addresses of the instructions accessing it
+}
+
+// Stack layout of a function, see CFG.StackFrame. To find a slot from a
+// probe at addr, add Slot.Offset minus the SPDelta at addr to the stack
+// pointer.
+type StackFrame struct {
+	Deltas      []SPDelta   // One per instruction, in address order
+	Size        int64       // The most the function grows the stack by, not counting the x86 return address
+	FrameReg    uint        // rbp or x29 when set up as frame pointer, 0 otherwise
+	FrameOffset int64       // FrameReg minus the stack pointer on entry
+	Slots       []StackSlot // Sorted by Offset, then Size
+}
+
+// Analyze the stack pointer of the function in insns, disassembled in
+// address order, see CFG.StackFrame.
+func AnalyzeStack(insns []Instruction) *StackFrame {
+	return BuildCFG(insns).StackFrame()
+}
+
+// Follow the stack pointer through the function from its entry, where it
+// is taken as 0, and the frame pointer once it is set from the stack
+// pointer. Understands push, pop, add and sub of an immediate, lea, mov
+// between the two, enter and leave on x86, and add, sub, mov and pre and
+// post indexed writeback on arm64. The stack pointer is unknown after
+// anything else writing it, or where paths with different values meet.
+// Calls are taken to leave it as it was. Other archs only get the entry.
+// Needs CS_OPT_DETAIL.
+func (g *CFG) StackFrame() *StackFrame {
+	in := make([]*stackState, len(g.Blocks))
+	var work []int
+	if len(g.Blocks) > 0 {
+		in[0] = &stackState{spKnown: true}
+		work = append(work, 0)
+	}
+	for len(work) > 0 {
+		b := work[len(work)-1]
+		work = work[:len(work)-1]
+		if in[b] == nil {
+			continue
+		}
+		st := *in[b]
+		for _, insn := range g.Blocks[b].Instructions {
+			st.step(insn)
+		}
+		for _, s := range g.Blocks[b].Succs {
+			if in[s] == nil {
+				next := st
+				in[s] = &next
+				work = append(work, s)
+			} else if in[s].merge(st) {
+				work = append(work, s)
+			}
+		}
+	}
+
+	f := &StackFrame{}
+	slots := make(map[stackSlotKey]int)
+	for b, blk := range g.Blocks {
+		var st stackState
+		if in[b] != nil {
+			st = *in[b]
+		}
+		for _, insn := range blk.Instructions {
+			f.Deltas = append(f.Deltas, SPDelta{Addr: uint64(insn.Address), Delta: st.sp, Known: st.spKnown})
+			for _, a := range st.accesses(insn) {
+				k := stackSlotKey{a.Offset, a.Size}
+				i, ok := slots[k]
+				if !ok {
+					i = len(f.Slots)
+					slots[k] = i
+					f.Slots = append(f.Slots, StackSlot{Offset: a.Offset, Size: a.Size})
+				}
+				f.Slots[i].Access |= a.Access
+				f.Slots[i].Insns = append(f.Slots[i].Insns, uint64(insn.Address))
+			}
+			fpKnown := st.fpKnown
+			st.step(insn)
+			if st.spKnown {
+				f.Size = max(f.Size, -st.sp)
+			}
+			if st.fpKnown && !fpKnown && f.FrameReg == 0 {
+				f.FrameReg, f.FrameOffset = stackRegs(insn).fp, st.fp
+			}
+		}
+	}
+	sort.SliceStable(f.Slots, func(i, j int) bool {
+		a, b := f.Slots[i], f.Slots[j]
+		return a.Offset < b.Offset || a.Offset == b.Offset && a.Size < b.Size
+	})
+	return f
+}
+
+// Stack pointer before the instruction at addr.
+func (f *StackFrame) SPDelta(addr uint64) (int64, bool) {
+	i := sort.Search(len(f.Deltas), func(i int) bool { return f.Deltas[i].Addr >= addr })
+	if i == len(f.Deltas) || f.Deltas[i].Addr != addr || !f.Deltas[i].Known {
+		return 0, false
+	}
+	return f.Deltas[i].Delta, true
+}
+
+type stackSlotKey struct {
+	offset int64
+	size   uint
+}
+
+// The stack and frame pointers, relative to the stack pointer on entry
+type stackState struct {
+	sp, fp           int64
+	spKnown, fpKnown bool
+}
+
+// Fold in the state of another path, reporting whether st changed
+func (st *stackState) merge(o stackState) bool {
+	old := *st
+	if st.spKnown && (!o.spKnown || o.sp != st.sp) {
+		st.spKnown = false
+	}
+	if st.fpKnown && (!o.fpKnown || o.fp != st.fp) {
+		st.fpKnown = false
+	}
+	return *st != old
+}
+
+// The stack and frame pointer registers for the arch of an instruction
+type stackRegSet struct {
+	arch   int
+	sp, fp uint
+}
+
+func stackRegs(insn Instruction) stackRegSet {
+	switch arch := insnArch(insn); arch {
+	case CS_ARCH_X86:
+		return stackRegSet{arch, X86_REG_RSP, X86_REG_RBP}
+	case CS_ARCH_ARM64:
+		return stackRegSet{arch, ARM64_REG_SP, ARM64_REG_X29}
+	default:
+		return stackRegSet{arch: arch}
+	}
+}
+
+func (st *stackState) get(regs stackRegSet, reg uint) (int64, bool) {
+	switch Canonical(regs.arch, reg) {
+	case regs.sp:
+		return st.sp, st.spKnown
+	case regs.fp:
+		return st.fp, st.fpKnown
+	}
+	return 0, false
+}
+
+func (st *stackState) set(regs stackRegSet, reg uint, v int64, known bool) {
+	switch Canonical(regs.arch, reg) {
+	case regs.sp:
+		st.sp, st.spKnown = v, known
+	case regs.fp:
+		st.fp, st.fpKnown = v, known
+	}
+}
+
+// Run insn on the state
+func (st *stackState) step(insn Instruction) {
+	regs := stackRegs(insn)
+	if regs.sp == 0 {
+		st.spKnown, st.fpKnown = false, false
+		return
+	}
+	var done []uint // Registers whose new value is accounted for
+	switch regs.arch {
+	case CS_ARCH_X86:
+		done = st.stepX86(regs, insn)
+	case CS_ARCH_ARM64:
+		done = st.stepArm64(regs, insn)
+	}
+
+	written := slices.Concat(insn.AllRegistersWritten, insn.RegistersWritten, insnRegOperands(insn))
+	for _, r := range written {
+		r = Canonical(regs.arch, r)
+		if (r == regs.sp || r == regs.fp) && !slices.Contains(done, r) {
+			st.set(regs, r, 0, false)
+		}
+	}
+}
+
+// Registers the explicit operands of insn write
+func insnRegOperands(insn Instruction) []uint {
+	var regs []uint
+	switch {
+	case insn.X86 != nil:
+		for _, op := range insn.X86.Operands {
+			if op.Type == X86_OP_REG && op.Access&CS_AC_WRITE != 0 {
+				regs = append(regs, op.Reg)
+			}
+		}
+	case insn.Arm64 != nil:
+		for _, op := range insn.Arm64.Operands {
+			if op.Type == ARM64_OP_REG && op.Access&CS_AC_WRITE != 0 {
+				regs = append(regs, op.Reg)
+			}
+		}
+	}
+	return regs
+}
+
+// The word size of x86 code, from the stack pointer Capstone reports
+func x86WordSize(insn Instruction) int64 {
+	for _, r := range slices.Concat(insn.AllRegistersRead, insn.RegistersRead) {
+		switch r {
+		case X86_REG_ESP:
+			return 4
+		case X86_REG_SP:
+			return 2
+		}
+	}
+	return 8
+}
+
+func (st *stackState) stepX86(regs stackRegSet, insn Instruction) []uint {
+	ops := insn.X86.Operands
+	word := x86WordSize(insn)
+	isReg := func(i int, reg uint) bool {
+		return i < len(ops) && ops[i].Type == X86_OP_REG && Canonical(regs.arch, ops[i].Reg) == reg
+	}
+	sp := []uint{regs.sp}
+
+	switch insn.Id {
+	case X86_INS_PUSH, X86_INS_POP:
+		size := word
+		if len(ops) == 1 && ops[0].Size > 0 {
+			size = int64(ops[0].Size)
+		}
+		if insn.Id == X86_INS_PUSH {
+			st.sp -= size
+			return sp
+		}
+		st.sp += size
+		if isReg(0, regs.sp) {
+			st.spKnown = false
+		}
+		return sp
+	case X86_INS_PUSHF:
+		st.sp -= 2
+		return sp
+	case X86_INS_PUSHFD:
+		st.sp -= 4
+		return sp
+	case X86_INS_PUSHFQ:
+		st.sp -= 8
+		return sp
+	case X86_INS_POPF:
+		st.sp += 2
+		return sp
+	case X86_INS_POPFD:
+		st.sp += 4
+		return sp
+	case X86_INS_POPFQ:
+		st.sp += 8
+		return sp
+	case X86_INS_CALL:
+		return sp
+	case X86_INS_ADD, X86_INS_SUB:
+		if isReg(0, regs.sp) && len(ops) == 2 && ops[1].Type == X86_OP_IMM {
+			if insn.Id == X86_INS_ADD {
+				st.sp += ops[1].Imm
+			} else {
+				st.sp -= ops[1].Imm
+			}
+			return sp
+		}
+	case X86_INS_LEA:
+		if len(ops) == 2 && ops[1].Mem.Index == X86_REG_INVALID && (isReg(0, regs.sp) || isReg(0, regs.fp)) {
+			v, known := st.get(regs, ops[1].Mem.Base)
+			st.set(regs, ops[0].Reg, v+ops[1].Mem.Disp, known)
+			return []uint{Canonical(regs.arch, ops[0].Reg)}
+		}
+	case X86_INS_MOV:
+		if isReg(0, regs.sp) && isReg(1, regs.fp) || isReg(0, regs.fp) && isReg(1, regs.sp) {
+			v, known := st.get(regs, ops[1].Reg)
+			st.set(regs, ops[0].Reg, v, known)
+			return []uint{Canonical(regs.arch, ops[0].Reg)}
+		}
+	case X86_INS_LEAVE:
+		// mov rsp, rbp; pop rbp
+		st.sp, st.spKnown = st.fp+word, st.fpKnown
+		st.fpKnown = false
+		return []uint{regs.sp, regs.fp}
+	case X86_INS_ENTER:
+		// push rbp; mov rbp, rsp; sub rsp, size, without nesting
+		if len(ops) == 2 && ops[1].Imm == 0 {
+			st.sp -= word
+			st.fp, st.fpKnown = st.sp, st.spKnown
+			st.sp -= ops[0].Imm
+			return []uint{regs.sp, regs.fp}
+		}
+	}
+	return nil
+}
+
+func (st *stackState) stepArm64(regs stackRegSet, insn Instruction) []uint {
+	ops := insn.Arm64.Operands
+	isReg := func(i int) bool {
+		if i >= len(ops) || ops[i].Type != ARM64_OP_REG {
+			return false
+		}
+		r := Canonical(regs.arch, ops[i].Reg)
+		return r == regs.sp || r == regs.fp
+	}
+
+	// ldp x29, x30, [sp], #0x10 and stp x29, x30, [sp, #-0x10]!
+	if insn.Arm64.Writeback {
+		for i, op := range ops {
+			if op.Type != ARM64_OP_MEM || Canonical(regs.arch, op.Mem.Base) != regs.sp {
+				continue
+			}
+			if i+1 < len(ops) && ops[i+1].Type == ARM64_OP_IMM {
+				st.sp += ops[i+1].Imm
+			} else {
+				st.sp += int64(op.Mem.Disp)
+			}
+			return []uint{regs.sp}
+		}
+	}
+
+	switch insn.Id {
+	case ARM64_INS_ADD, ARM64_INS_SUB:
+		if len(ops) == 3 && isReg(0) && isReg(1) && ops[2].Type == ARM64_OP_IMM {
+			imm := ops[2].Imm
+			if ops[2].Shift.Type == ARM64_SFT_LSL {
+				imm <<= ops[2].Shift.Value
+			}
+			if insn.Id == ARM64_INS_SUB {
+				imm = -imm
+			}
+			v, known := st.get(regs, ops[1].Reg)
+			st.set(regs, ops[0].Reg, v+imm, known)
+			return []uint{Canonical(regs.arch, ops[0].Reg)}
+		}
+	case ARM64_INS_MOV:
+		if len(ops) == 2 && isReg(0) && isReg(1) {
+			v, known := st.get(regs, ops[1].Reg)
+			st.set(regs, ops[0].Reg, v, known)
+			return []uint{Canonical(regs.arch, ops[0].Reg)}
+		}
+	}
+	return nil
+}
+
+// The stack slots insn accesses, with the state before it
+func (st *stackState) accesses(insn Instruction) []StackSlot {
+	regs := stackRegs(insn)
+	var slots []StackSlot
+	add := func(base uint, disp int64, size uint, access uint8) {
+		if v, known := st.get(regs, base); known {
+			slots = append(slots, StackSlot{Offset: v + disp, Size: size, Access: access})
+		}
+	}
+	switch {
+	case insn.X86 != nil:
+		if insn.Id == X86_INS_LEA {
+			break
+		}
+		for _, op := range insn.X86.Operands {
+			if op.Type == X86_OP_MEM && op.Mem.Index == X86_REG_INVALID {
+				add(op.Mem.Base, op.Mem.Disp, uint(op.Size), op.Access)
+			}
+		}
+	case insn.Arm64 != nil:
+		for _, op := range insn.Arm64.Operands {
+			if op.Type == ARM64_OP_MEM && op.Mem.Index == ARM64_REG_INVALID {
+				access := uint8(op.Access)
+				if access == 0 && strings.HasPrefix(insn.Mnemonic, "ld") {
+					access = CS_AC_READ
+				} else if access == 0 && strings.HasPrefix(insn.Mnemonic, "st") {
+					access = CS_AC_WRITE
+				}
+				add(op.Mem.Base, int64(op.Mem.Disp), arm64AccessSize(insn), access)
+			}
+		}
+	}
+	return slots
+}
+
+// Loads and stores narrower than their registers, by mnemonic
+var arm64NarrowAccess = func() map[string]uint {
+	m := map[string]uint{"ldrsw": 4, "ldursw": 4, "ldtrsw": 4, "ldapursw": 4, "ldpsw": 8}
+	for _, base := range []string{
+		"ldr", "str", "ldrs", "ldur", "stur", "ldurs", "ldtr", "sttr", "ldtrs",
+		"ldar", "stlr", "ldaxr", "stlxr", "ldxr", "stxr", "ldapr", "ldapur", "stlur", "ldapurs",
+	} {
+		m[base+"b"], m[base+"h"] = 1, 2
+	}
+	return m
+}()
+
+// Bytes an arm64 load or store moves: by mnemonic for the narrow ones, from
+// the registers transferred otherwise
+func arm64AccessSize(insn Instruction) uint {
+	if size, ok := arm64NarrowAccess[insn.Mnemonic]; ok {
+		return size
+	}
+	var size uint
+	for _, op := range insn.Arm64.Operands {
+		if op.Type == ARM64_OP_MEM {
+			break
+		}
+		if info, ok := RegInfo(CS_ARCH_ARM64, op.Reg); ok && op.Type == ARM64_OP_REG {
+			size += info.Width / 8
+		}
+	}
+	return size
+}
@@ -0,0 +1,157 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package gapstone
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStackFrameX86(t *testing.T) {
+	engine := entryEngine(t, CS_ARCH_X86, CS_MODE_64)
+	defer engine.Close()
+
+	code := "\x55" + // push rbp
+		"\x48\x89\xe5" + // mov rbp, rsp
+		"\x48\x83\xec\x20" + // sub rsp, 0x20
+		"\x89\x7d\xec" + // mov dword ptr [rbp - 0x14], edi
+		"\x48\x89\x34\x24" + // mov qword ptr [rsp], rsi
+		"\x8b\x45\xec" + // mov eax, dword ptr [rbp - 0x14]
+		"\xc9" + // leave
+		"\xc3" // ret
+	insns, err := engine.Disasm([]byte(code), 0x1000, 0)
+	if err != nil {
+		t.Fatalf("Disassembly error: %v", err)
+	}
+	f := AnalyzeStack(insns)
+
+	want := []SPDelta{
+		{0x1000, 0, true}, {0x1001, -8, true}, {0x1004, -8, true}, {0x1008, -0x28, true},
+		{0x100b, -0x28, true}, {0x100f, -0x28, true}, {0x1012, -0x28, true}, {0x1013, 0, true},
+	}
+	if !reflect.DeepEqual(f.Deltas, want) {
+		t.Errorf("Deltas = %v, want %v", f.Deltas, want)
+	}
+	if f.Size != 0x28 || f.FrameReg != X86_REG_RBP || f.FrameOffset != -8 {
+		t.Errorf("Size %#x, FrameReg %d at %d", f.Size, f.FrameReg, f.FrameOffset)
+	}
+	slots := []StackSlot{
+		{Offset: -0x28, Size: 8, Access: CS_AC_WRITE, Insns: []uint64{0x100b}},
+		{Offset: -0x1c, Size: 4, Access: CS_AC_READ | CS_AC_WRITE, Insns: []uint64{0x1008, 0x100f}},
+	}
+	if !reflect.DeepEqual(f.Slots, slots) {
+		t.Errorf("Slots = %+v, want %+v", f.Slots, slots)
+	}
+	if d, ok := f.SPDelta(0x100f); !ok || d != -0x28 {
+		t.Errorf("SPDelta(0x100f) = %d, %v", d, ok)
+	}
+	if _, ok := f.SPDelta(0x1002); ok {
+		t.Error("SPDelta(0x1002) found an instruction")
+	}
+}
+
+func TestStackFrameEmpty(t *testing.T) {
+	f := AnalyzeStack(nil)
+	if len(f.Deltas) != 0 || len(f.Slots) != 0 || f.Size != 0 {
+		t.Errorf("AnalyzeStack(nil) = %+v", f)
+	}
+}
+
+func TestStackFrameX86Unknown(t *testing.T) {
+	engine := entryEngine(t, CS_ARCH_X86, CS_MODE_64)
+	defer engine.Close()
+
+	code := "\x85\xff" + // test edi, edi
+		"\x74\x01" + // je 0x1005
+		"\x50" + // push rax
+		"\x48\x83\xe4\xf0" + // and rsp, -0x10
+		"\xc3" // ret
+	insns, err := engine.Disasm([]byte(code), 0x1000, 0)
+	if err != nil {
+		t.Fatalf("Disassembly error: %v", err)
+	}
+	f := AnalyzeStack(insns)
+	// The paths meet with different stack pointers
+	if _, ok := f.SPDelta(0x1005); ok {
+		t.Error("stack pointer known after the paths meet")
+	}
+	if d, ok := f.SPDelta(0x1004); !ok || d != 0 {
+		t.Errorf("SPDelta(0x1004) = %d, %v", d, ok)
+	}
+	if f.Size != 8 {
+		t.Errorf("Size = %d, want 8", f.Size)
+	}
+}
+
+func TestStackFrameArm64(t *testing.T) {
+	engine := entryEngine(t, CS_ARCH_ARM64, CS_MODE_ARM)
+	defer engine.Close()
+
+	code := "\xfd\x7b\xbe\xa9" + // stp x29, x30, [sp, #-0x20]!
+		"\xfd\x03\x00\x91" + // mov x29, sp
+		"\xe0\x1f\x00\xb9" + // str w0, [sp, #0x1c]
+		"\xa0\x1f\x40\xb9" + // ldr w0, [x29, #0x1c]
+		"\xfd\x7b\xc2\xa8" + // ldp x29, x30, [sp], #0x20
+		"\xc0\x03\x5f\xd6" // ret
+	insns, err := engine.Disasm([]byte(code), 0x1000, 0)
+	if err != nil {
+		t.Fatalf("Disassembly error: %v", err)
+	}
+	f := AnalyzeStack(insns)
+
+	var deltas []int64
+	for _, d := range f.Deltas {
+		if !d.Known {
+			t.Fatalf("stack pointer unknown at 0x%x", d.Addr)
+		}
+		deltas = append(deltas, d.Delta)
+	}
+	if !reflect.DeepEqual(deltas, []int64{0, -0x20, -0x20, -0x20, -0x20, 0}) {
+		t.Errorf("deltas = %v", deltas)
+	}
+	if f.Size != 0x20 || f.FrameReg != ARM64_REG_X29 || f.FrameOffset != -0x20 {
+		t.Errorf("Size %#x, FrameReg %d at %d", f.Size, f.FrameReg, f.FrameOffset)
+	}
+	slots := []StackSlot{
+		{Offset: -0x20, Size: 16, Access: CS_AC_READ | CS_AC_WRITE, Insns: []uint64{0x1000, 0x1010}},
+		{Offset: -4, Size: 4, Access: CS_AC_READ | CS_AC_WRITE, Insns: []uint64{0x1008, 0x100c}},
+	}
+	if !reflect.DeepEqual(f.Slots, slots) {
+		t.Errorf("Slots = %+v, want %+v", f.Slots, slots)
+	}
+}
+
+func TestStackFrameArm64Sizes(t *testing.T) {
+	engine := entryEngine(t, CS_ARCH_ARM64, CS_MODE_ARM)
+	defer engine.Close()
+
+	code := "\xff\x83\x00\xd1" + // sub sp, sp, #0x20
+		"\xe0\x07\x41\x69" + // ldpsw x0, x1, [sp, #8]
+		"\xe2\x43\x40\x39" + // ldrb w2, [sp, #0x10]
+		"\xe3\x17\x80\xb9" + // ldrsw x3, [sp, #0x14]
+		"\xe4\x37\x20\xf8" + // ldraa x4, [sp, #0x18]
+		"\xff\x83\x00\x91" + // add sp, sp, #0x20
+		"\xc0\x03\x5f\xd6" // ret
+	insns, err := engine.Disasm([]byte(code), 0x1000, 0)
+	if err != nil {
+		t.Fatalf("Disassembly error: %v", err)
+	}
+	f := AnalyzeStack(insns)
+	slots := []StackSlot{
+		{Offset: -0x18, Size: 8, Access: CS_AC_READ, Insns: []uint64{0x1004}},
+		{Offset: -0x10, Size: 1, Access: CS_AC_READ, Insns: []uint64{0x1008}},
+		{Offset: -0xc, Size: 4, Access: CS_AC_READ, Insns: []uint64{0x100c}},
+		{Offset: -8, Size: 8, Access: CS_AC_READ, Insns: []uint64{0x1010}},
+	}
+	if !reflect.DeepEqual(f.Slots, slots) {
+		t.Errorf("Slots = %+v, want %+v", f.Slots, slots)
+	}
+}
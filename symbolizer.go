@@ -0,0 +1,205 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package gapstone
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A Symbolizer maps addresses back to symbol names, see Symbolize.
+type Symbolizer interface {
+	// Lookup returns the symbol covering addr and how far into it addr is.
+	Lookup(addr uint64) (name string, offset uint64, ok bool)
+}
+
+// A named address range. Size 0 means unknown, the symbol then extends to
+// the next one.
+type Symbol struct {
+	Name   string
+	Addr   uint64
+	Size   uint64
+	Module string // Kernel module, empty for vmlinux and non-kernel symbols
+}
+
+// A Symbolizer over a sorted in-memory table.
+type SymbolTable struct {
+	syms   []Symbol
+	byName map[string]int
+}
+
+// Build a SymbolTable, syms is copied and sorted by address.
+func NewSymbolTable(syms []Symbol) *SymbolTable {
+	t := &SymbolTable{
+		syms:   append([]Symbol(nil), syms...),
+		byName: make(map[string]int, len(syms)),
+	}
+	sort.SliceStable(t.syms, func(i, j int) bool {
+		return t.syms[i].Addr < t.syms[j].Addr
+	})
+	for i, s := range t.syms {
+		if _, ok := t.byName[s.Name]; !ok {
+			t.byName[s.Name] = i
+		}
+	}
+	return t
+}
+
+// The symbols of the table, sorted by address.
+func (t *SymbolTable) Symbols() []Symbol { return t.syms }
+
+// Find a symbol by name. With duplicate names the lowest address wins.
+func (t *SymbolTable) Find(name string) (Symbol, bool) {
+	i, ok := t.byName[name]
+	if !ok {
+		return Symbol{}, false
+	}
+	return t.syms[i], true
+}
+
+func (t *SymbolTable) Lookup(addr uint64) (string, uint64, bool) {
+	i := sort.Search(len(t.syms), func(i int) bool {
+		return t.syms[i].Addr > addr
+	})
+	if i == 0 {
+		return "", 0, false
+	}
+	i--
+	// Of several aliases at one address report the first.
+	for i > 0 && t.syms[i-1].Addr == t.syms[i].Addr {
+		i--
+	}
+
+	s := t.syms[i]
+	off := addr - s.Addr
+	if s.Size > 0 && off >= s.Size {
+		return "", 0, false
+	}
+	return s.Name, off, true
+}
+
+// Parse a /proc/kallsyms style listing: "address type name [module]" per
+// line. Reading /proc/kallsyms without CAP_SYSLOG yields all-zero addresses,
+// which is reported as an error rather than producing a useless table.
+func ParseKallsyms(r io.Reader) (*SymbolTable, error) {
+	var syms []Symbol
+	nonzero := false
+
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("kallsyms line %d: too few fields", line)
+		}
+		addr, err := strconv.ParseUint(fields[0], 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("kallsyms line %d: %w", line, err)
+		}
+		s := Symbol{Name: fields[2], Addr: addr}
+		if len(fields) > 3 {
+			s.Module = strings.Trim(fields[3], "[]")
+		}
+		nonzero = nonzero || addr != 0
+		syms = append(syms, s)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(syms) > 0 && !nonzero {
+		return nil, errors.New("kallsyms addresses are hidden, check kptr_restrict")
+	}
+	return NewSymbolTable(syms), nil
+}
+
+// Render name+0x10 for a symbol and offset
+func symbolExpr(name string, off uint64) string {
+	if off == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s+0x%x", name, off)
+}
+
+// Render the operands of insn with direct branch and call targets, x86
+// RIP-relative memory references and ARM64 adr targets replaced by symbol
+// names, eg. `call 0xffffffff81234560` becomes `call sym+0x10`. Anything
+// the Symbolizer doesn't know is left as is. Needs CS_OPT_DETAIL.
+func Symbolize(insn Instruction, s Symbolizer) string {
+	opStr := insn.OpStr
+
+	if flow := insn.Flow(); flow.Direct {
+		if name, off, ok := s.Lookup(flow.Target); ok {
+			opStr = replaceTarget(opStr, flow.Target, symbolExpr(name, off))
+		}
+		return opStr
+	}
+
+	switch {
+	case insn.X86 != nil:
+		next := uint64(insn.Address + insn.Size)
+		for _, op := range insn.X86.Operands {
+			if op.Type != X86_OP_MEM || op.Mem.Base != X86_REG_RIP || op.Mem.Index != X86_REG_INVALID {
+				continue
+			}
+			name, off, ok := s.Lookup(next + uint64(op.Mem.Disp))
+			if !ok {
+				continue
+			}
+			sym := symbolExpr(name, off)
+			disp := op.Mem.Disp
+			sign := "+"
+			if disp < 0 {
+				disp, sign = -disp, "-"
+			}
+			// Intel: [rip + 0x10], AT&T: 0x10(%rip)
+			opStr = strings.Replace(opStr, fmt.Sprintf("rip %s 0x%x", sign, disp), sym, 1)
+			opStr = strings.Replace(opStr, fmt.Sprintf("%s0x%x(%%rip)", strings.Trim(sign, "+"), disp), sym+"(%rip)", 1)
+		}
+	case insn.Arm64 != nil && insn.Id == ARM64_INS_ADR:
+		ops := insn.Arm64.Operands
+		if len(ops) == 2 && ops[1].Type == ARM64_OP_IMM {
+			target := uint64(ops[1].Imm)
+			if name, off, ok := s.Lookup(target); ok {
+				opStr = replaceTarget(opStr, target, symbolExpr(name, off))
+			}
+		}
+	}
+	return opStr
+}
+
+// Replace the last hex rendering of target in opStr, along with an ARM
+// style '#' in front of it, by sym.
+func replaceTarget(opStr string, target uint64, sym string) string {
+	hex := fmt.Sprintf("0x%x", target)
+	for end := len(opStr); end > 0; {
+		i := strings.LastIndex(opStr[:end], hex)
+		if i < 0 {
+			break
+		}
+		j := i + len(hex)
+		if j < len(opStr) && strings.IndexByte("0123456789abcdefABCDEF", opStr[j]) >= 0 {
+			end = i
+			continue
+		}
+		if i > 0 && opStr[i-1] == '#' {
+			i--
+		}
+		return opStr[:i] + sym + opStr[j:]
+	}
+	return opStr
+}
@@ -0,0 +1,68 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package gapstone
+
+import (
+	"strings"
+	"testing"
+)
+
+var kallsyms = `ffffffff81000000 T _stext
+ffffffff81000000 T startup_64
+ffffffff81000100 t helper
+ffffffffc0000000 t mod_fn	[nf_tables]
+`
+
+func TestKallsyms(t *testing.T) {
+	table, err := ParseKallsyms(strings.NewReader(kallsyms))
+	if err != nil {
+		t.Fatalf("ParseKallsyms failed: %v", err)
+	}
+
+	name, off, ok := table.Lookup(0xffffffff81000010)
+	if !ok || name != "_stext" || off != 0x10 {
+		t.Errorf("Lookup: want _stext+0x10, got %s+0x%x (%v)", name, off, ok)
+	}
+	if _, _, ok := table.Lookup(0xffffffff80000000); ok {
+		t.Errorf("Lookup: found a symbol below the first one")
+	}
+	if s, ok := table.Find("mod_fn"); !ok || s.Module != "nf_tables" {
+		t.Errorf("Find: want mod_fn in nf_tables, got %+v", s)
+	}
+
+	if _, err := ParseKallsyms(strings.NewReader("0000000000000000 T _stext\n")); err == nil {
+		t.Errorf("ParseKallsyms accepted hidden addresses")
+	}
+}
+
+func TestSymbolize(t *testing.T) {
+	engine, err := New(CS_ARCH_X86, CS_MODE_64)
+	if err != nil {
+		t.Fatalf("Failed to initialize engine %v", err)
+	}
+	defer engine.Close()
+	engine.SetOption(CS_OPT_DETAIL, CS_OPT_ON)
+
+	// push rbp; mov rax, qword ptr [rip + 0x13b8]; call 0x1000
+	code := "\x55\x48\x8b\x05\xb8\x13\x00\x00\xe8\xf3\xff\xff\xff"
+	insns, err := engine.Disasm([]byte(code), 0x1000, 0)
+	if err != nil {
+		t.Fatalf("Disassembly error: %v", err)
+	}
+
+	table := NewSymbolTable([]Symbol{
+		{Name: "func", Addr: 0x1000, Size: 0x10},
+		{Name: "data", Addr: 0x23b0, Size: 0x20},
+	})
+	assertEqual(t, "rip-relative: want %q, got %q", "rax, qword ptr [data+0x10]", Symbolize(insns[1], table))
+	assertEqual(t, "call: want %q, got %q", "func", Symbolize(insns[2], table))
+	assertEqual(t, "untouched: want %q, got %q", "rbp", Symbolize(insns[0], table))
+}
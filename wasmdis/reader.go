@@ -0,0 +1,141 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package wasmdis
+
+import (
+	"errors"
+	"fmt"
+)
+
+var errTruncated = errors.New("truncated")
+
+// A cursor over module bytes. The first error sticks and turns every later
+// read into a zero value, so parsers only check err once per item.
+type reader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *reader) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *reader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	if r.pos >= len(r.data) {
+		r.fail(errTruncated)
+		return 0
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b
+}
+
+// LEB128 encoded u32
+func (r *reader) u32() uint32 {
+	var v uint64
+	for shift := 0; shift < 35; shift += 7 {
+		b := r.byte()
+		if r.err != nil {
+			return 0
+		}
+		v |= uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			if v > 0xffffffff {
+				break
+			}
+			return uint32(v)
+		}
+	}
+	r.fail(fmt.Errorf("bad u32 at 0x%x", r.pos))
+	return 0
+}
+
+// LEB128 encoded u64, as used by memory64 limits
+func (r *reader) u64() uint64 {
+	var v uint64
+	for shift := 0; shift < 70; shift += 7 {
+		b := r.byte()
+		if r.err != nil {
+			return 0
+		}
+		v |= uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return v
+		}
+	}
+	r.fail(fmt.Errorf("bad u64 at 0x%x", r.pos))
+	return 0
+}
+
+func (r *reader) bytes(n uint32) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if uint64(n) > uint64(len(r.data)-r.pos) {
+		r.fail(errTruncated)
+		return nil
+	}
+	b := r.data[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b
+}
+
+func (r *reader) name() string {
+	return string(r.bytes(r.u32()))
+}
+
+func (r *reader) valTypes() []ValType {
+	n := r.u32()
+	var types []ValType
+	for ; n > 0 && r.err == nil; n-- {
+		types = append(types, ValType(r.byte()))
+	}
+	return types
+}
+
+func (r *reader) limits() {
+	flags := r.byte()
+	r.u64()
+	if flags&1 != 0 {
+		r.u64()
+	}
+}
+
+// A code section entry: the size, the locals declarations, then code up to
+// the end of the entry.
+func (r *reader) body(index, typ uint32) Func {
+	fn := Func{Index: index, Type: typ}
+	size := r.u32()
+	end := r.pos + int(size)
+	if r.err == nil && (size == 0 || uint64(size) > uint64(len(r.data)-r.pos)) {
+		r.fail(fmt.Errorf("function %d: %w", index, errTruncated))
+	}
+
+	for n := r.u32(); n > 0 && r.err == nil; n-- {
+		fn.Locals = append(fn.Locals, Local{Count: r.u32(), Type: ValType(r.byte())})
+	}
+	if r.err == nil && r.pos >= end {
+		r.fail(fmt.Errorf("function %d: locals overrun the body", index))
+	}
+	if r.err != nil {
+		return fn
+	}
+	fn.Offset = uint64(r.pos)
+	fn.Size = uint64(end - r.pos)
+	r.pos = end
+	return fn
+}
@@ -0,0 +1,382 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+// Package wasmdis parses WebAssembly binary modules and disassembles their
+// function bodies with CS_ARCH_WASM. Instruction addresses are offsets into
+// the module, as used by browser devtools and wasm-objdump.
+package wasmdis
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/bpfsnoop/gapstone"
+)
+
+var (
+	ErrFormat = errors.New("not a WebAssembly module")
+	ErrNoFunc = errors.New("function not found")
+)
+
+// Section ids
+const (
+	sectionCustom   = 0
+	sectionType     = 1
+	sectionImport   = 2
+	sectionFunction = 3
+	sectionExport   = 7
+	sectionCode     = 10
+)
+
+// Import and export kinds
+const (
+	KindFunc   = 0
+	KindTable  = 1
+	KindMemory = 2
+	KindGlobal = 3
+	KindTag    = 4
+)
+
+// A value type, eg. 0x7f for i32.
+type ValType byte
+
+func (v ValType) String() string {
+	switch v {
+	case 0x7f:
+		return "i32"
+	case 0x7e:
+		return "i64"
+	case 0x7d:
+		return "f32"
+	case 0x7c:
+		return "f64"
+	case 0x7b:
+		return "v128"
+	case 0x70:
+		return "funcref"
+	case 0x6f:
+		return "externref"
+	}
+	return fmt.Sprintf("type(0x%02x)", byte(v))
+}
+
+// A function signature
+type FuncType struct {
+	Params  []ValType
+	Results []ValType
+}
+
+func (t FuncType) String() string {
+	return fmt.Sprintf("%v -> %v", t.Params, t.Results)
+}
+
+type Import struct {
+	Module string
+	Name   string
+	Kind   byte
+	Type   uint32 // Type index, for KindFunc and KindTag
+}
+
+type Export struct {
+	Name  string
+	Kind  byte
+	Index uint32
+}
+
+// A run of locals of one type, as declared at the start of a body.
+type Local struct {
+	Count uint32
+	Type  ValType
+}
+
+// A function, imported or defined by the module. Index is in the function
+// index space, where imports come first.
+type Func struct {
+	Index    uint32
+	Name     string // From the name section, an export, the import, or "func[N]"
+	Type     uint32
+	Imported bool
+	Locals   []Local
+	Offset   uint64 // Module offset of the first instruction, past the locals
+	Size     uint64 // Bytes of code, up to and including the final end
+}
+
+// A parsed module
+type Module struct {
+	Types   []FuncType
+	Imports []Import
+	Exports []Export
+	Funcs   []Func // Every function, by index
+}
+
+// A module opened for disassembly.
+type File struct {
+	Module
+	engine gapstone.Engine
+	mem    *gapstone.BytesMemory
+	byName map[string]int
+}
+
+// Open the named .wasm file for disassembly.
+func Open(name string) (*File, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return NewFile(data)
+}
+
+// Parse a module and create a CS_ARCH_WASM Engine for it.
+func NewFile(data []byte) (*File, error) {
+	m, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	engine, err := gapstone.New(gapstone.CS_ARCH_WASM, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &File{
+		Module: *m,
+		engine: engine,
+		mem:    gapstone.NewBytesMemory(0, data, gapstone.PermRead|gapstone.PermExec),
+		byName: make(map[string]int),
+	}
+	f.mem.Name = "wasm"
+	for i, fn := range f.Funcs {
+		if _, ok := f.byName[fn.Name]; !ok {
+			f.byName[fn.Name] = i
+		}
+	}
+	return f, nil
+}
+
+// Parse the type, import, function, export, code and name sections of a
+// binary module. Other sections are skipped.
+func Parse(data []byte) (*Module, error) {
+	if len(data) < 8 || !bytes.Equal(data[:4], []byte("\x00asm")) {
+		return nil, ErrFormat
+	}
+	if v := data[4:8]; !bytes.Equal(v, []byte{1, 0, 0, 0}) {
+		return nil, fmt.Errorf("%w: version %x", ErrFormat, v)
+	}
+
+	m := &Module{}
+	var funcTypes []uint32
+	names := make(map[uint32]string)
+	importNames := make(map[uint32]string)
+	codeSeen := false
+
+	r := &reader{data: data, pos: 8}
+	for r.pos < len(data) {
+		id := r.byte()
+		size := r.u32()
+		start := r.pos
+		if r.err != nil || size > uint32(len(data)-start) {
+			return nil, fmt.Errorf("section at 0x%x: %w", start, errTruncated)
+		}
+		s := &reader{data: data[:start+int(size)], pos: start}
+
+		switch id {
+		case sectionCustom:
+			if s.name() == "name" {
+				parseNames(s, names)
+				s.err = nil // A broken name section only costs names
+			}
+		case sectionType:
+			for n := s.u32(); n > 0 && s.err == nil; n-- {
+				if form := s.byte(); form != 0x60 {
+					s.fail(fmt.Errorf("function type form 0x%02x", form))
+				}
+				m.Types = append(m.Types, FuncType{Params: s.valTypes(), Results: s.valTypes()})
+			}
+		case sectionImport:
+			for n := s.u32(); n > 0 && s.err == nil; n-- {
+				imp := Import{Module: s.name(), Name: s.name(), Kind: s.byte()}
+				switch imp.Kind {
+				case KindFunc:
+					imp.Type = s.u32()
+					importNames[uint32(len(m.Funcs))] = imp.Module + "." + imp.Name
+					m.Funcs = append(m.Funcs, Func{Index: uint32(len(m.Funcs)), Type: imp.Type, Imported: true})
+				case KindTable:
+					s.byte()
+					s.limits()
+				case KindMemory:
+					s.limits()
+				case KindGlobal:
+					s.byte()
+					s.byte()
+				case KindTag:
+					s.byte()
+					imp.Type = s.u32()
+				default:
+					s.fail(fmt.Errorf("import kind 0x%02x", imp.Kind))
+				}
+				m.Imports = append(m.Imports, imp)
+			}
+		case sectionFunction:
+			for n := s.u32(); n > 0 && s.err == nil; n-- {
+				funcTypes = append(funcTypes, s.u32())
+			}
+		case sectionExport:
+			for n := s.u32(); n > 0 && s.err == nil; n-- {
+				m.Exports = append(m.Exports, Export{Name: s.name(), Kind: s.byte(), Index: s.u32()})
+			}
+		case sectionCode:
+			codeSeen = true
+			n := s.u32()
+			if s.err == nil && int(n) != len(funcTypes) {
+				s.fail(fmt.Errorf("%d bodies for %d functions", n, len(funcTypes)))
+			}
+			for i := 0; i < int(n) && s.err == nil; i++ {
+				m.Funcs = append(m.Funcs, s.body(uint32(len(m.Funcs)), funcTypes[i]))
+			}
+		}
+
+		if s.err != nil {
+			return nil, fmt.Errorf("section %d at 0x%x: %w", id, start, s.err)
+		}
+		r.pos = start + int(size)
+	}
+	if !codeSeen && len(funcTypes) > 0 {
+		return nil, fmt.Errorf("%w: function section without code section", ErrFormat)
+	}
+
+	for _, e := range m.Exports {
+		if e.Kind == KindFunc && int(e.Index) < len(m.Funcs) && m.Funcs[e.Index].Name == "" {
+			m.Funcs[e.Index].Name = e.Name
+		}
+	}
+	for i := range m.Funcs {
+		fn := &m.Funcs[i]
+		if name, ok := names[fn.Index]; ok {
+			fn.Name = name
+		}
+		if fn.Name == "" {
+			fn.Name = importNames[fn.Index]
+		}
+		if fn.Name == "" {
+			fn.Name = fmt.Sprintf("func[%d]", fn.Index)
+		}
+	}
+	return m, nil
+}
+
+// Read the function names subsection of the name section.
+func parseNames(s *reader, names map[uint32]string) {
+	for s.pos < len(s.data) && s.err == nil {
+		id := s.byte()
+		size := s.u32()
+		end := s.pos + int(size)
+		if s.err != nil || end > len(s.data) {
+			return
+		}
+		if id == 1 {
+			for n := s.u32(); n > 0 && s.err == nil; n-- {
+				idx := s.u32()
+				names[idx] = s.name()
+			}
+		}
+		s.pos = end
+	}
+}
+
+// Close the Engine.
+func (f *File) Close() error {
+	if err := f.engine.Close(); err != gapstone.ErrOK {
+		return err
+	}
+	return nil
+}
+
+// The CS_ARCH_WASM Engine
+func (f *File) Engine() *gapstone.Engine { return &f.engine }
+
+// The whole module, mapped at address 0.
+func (f *File) Memory() gapstone.Memory { return f.mem }
+
+// Find a function by name.
+func (f *File) LookupFunc(name string) (Func, error) {
+	if i, ok := f.byName[name]; ok {
+		return f.Funcs[i], nil
+	}
+	return Func{}, fmt.Errorf("%w: %s", ErrNoFunc, name)
+}
+
+// Map a module offset back to the defined function whose code covers it,
+// which makes a File a gapstone.Symbolizer.
+func (f *File) Lookup(addr uint64) (string, uint64, bool) {
+	for _, fn := range f.Funcs {
+		if !fn.Imported && addr >= fn.Offset && addr-fn.Offset < fn.Size {
+			return fn.Name, addr - fn.Offset, true
+		}
+	}
+	return "", 0, false
+}
+
+// A function with its disassembled body.
+type Function struct {
+	Func
+	Instructions []gapstone.Instruction
+}
+
+// Disassemble the body of a defined function.
+func (f *File) Disasm(fn Func) ([]gapstone.Instruction, error) {
+	if fn.Imported {
+		return nil, fmt.Errorf("function %s is imported", fn.Name)
+	}
+	insns, err := f.engine.DisasmRange(f.mem, fn.Offset, fn.Offset+fn.Size)
+	if err != nil {
+		return insns, fmt.Errorf("function %s: %w", fn.Name, err)
+	}
+	return insns, nil
+}
+
+// Disassemble the function called name.
+func (f *File) DisasmFunc(name string) ([]gapstone.Instruction, error) {
+	fn, err := f.LookupFunc(name)
+	if err != nil {
+		return nil, err
+	}
+	return f.Disasm(fn)
+}
+
+// Disassemble every function the module defines, in index order.
+func (f *File) DisasmAll() ([]Function, error) {
+	var out []Function
+	for _, fn := range f.Funcs {
+		if fn.Imported {
+			continue
+		}
+		insns, err := f.Disasm(fn)
+		if err != nil {
+			return out, err
+		}
+		out = append(out, Function{Func: fn, Instructions: insns})
+	}
+	return out, nil
+}
+
+// The function a call instruction targets. Capstone has no operand detail
+// for wasm, so the index is decoded from the instruction bytes.
+func (f *File) Callee(insn gapstone.Instruction) (Func, bool) {
+	if insn.Id != gapstone.WASM_INS_CALL || len(insn.Bytes) < 2 {
+		return Func{}, false
+	}
+	r := &reader{data: insn.Bytes, pos: 1}
+	idx := r.u32()
+	if r.err != nil || int(idx) >= len(f.Funcs) {
+		return Func{}, false
+	}
+	return f.Funcs[idx], true
+}
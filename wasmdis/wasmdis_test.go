@@ -0,0 +1,143 @@
+/*
+Gapstone is a Go binding for the Capstone disassembly library. For examples,
+try reading the *_test.go files.
+
+	Library Author: Nguyen Anh Quynh
+	Binding Author: Ben Nagy
+	License: BSD style - see LICENSE file for details
+    (c) 2013 COSEINC. All Rights Reserved.
+*/
+
+package wasmdis
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bpfsnoop/gapstone"
+)
+
+func wasmVec(items ...[]byte) []byte {
+	out := []byte{byte(len(items))}
+	for _, it := range items {
+		out = append(out, it...)
+	}
+	return out
+}
+
+func wasmName(s string) []byte {
+	return append([]byte{byte(len(s))}, s...)
+}
+
+func wasmSection(id byte, payload ...[]byte) []byte {
+	var body []byte
+	for _, p := range payload {
+		body = append(body, p...)
+	}
+	return append([]byte{id, byte(len(body))}, body...)
+}
+
+func wasmCat(parts ...[]byte) []byte {
+	var out []byte
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
+
+// A module importing env.log (i32), exporting add (i32, i32) -> i32 as
+// local.get 0; local.get 1; i32.add, and with helper (i32), named by the name
+// section, declaring locals i32, i64, i64 and doing local.get 0; call 0.
+func testModule() []byte {
+	addBody := []byte{0x00, 0x20, 0x00, 0x20, 0x01, 0x6a, 0x0b}
+	helperBody := []byte{0x02, 0x01, 0x7f, 0x02, 0x7e, 0x20, 0x00, 0x10, 0x00, 0x0b}
+	return wasmCat(
+		[]byte("\x00asm\x01\x00\x00\x00"),
+		wasmSection(sectionType, wasmVec(
+			[]byte{0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7f},
+			[]byte{0x60, 0x01, 0x7f, 0x00},
+		)),
+		wasmSection(sectionImport, wasmVec(wasmCat(wasmName("env"), wasmName("log"), []byte{KindFunc, 0x01}))),
+		wasmSection(sectionFunction, wasmVec([]byte{0x00}, []byte{0x01})),
+		wasmSection(sectionExport, wasmVec(wasmCat(wasmName("add"), []byte{KindFunc, 0x01}))),
+		wasmSection(sectionCode, wasmVec(
+			wasmCat([]byte{byte(len(addBody))}, addBody),
+			wasmCat([]byte{byte(len(helperBody))}, helperBody),
+		)),
+		wasmSection(sectionCustom, wasmName("name"), []byte{0x01, 0x09}, wasmVec(wasmCat([]byte{0x02}, wasmName("helper")))),
+	)
+}
+
+func TestParse(t *testing.T) {
+	m, err := Parse(testModule())
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(m.Types) != 2 || m.Types[0].String() != "[i32 i32] -> [i32]" {
+		t.Errorf("want 2 types starting with [i32 i32] -> [i32], got %v", m.Types)
+	}
+
+	names := []string{"env.log", "add", "helper"}
+	if len(m.Funcs) != len(names) {
+		t.Fatalf("want %d functions, got %+v", len(names), m.Funcs)
+	}
+	for i, name := range names {
+		if m.Funcs[i].Name != name || m.Funcs[i].Index != uint32(i) {
+			t.Errorf("function %d: want %s, got %+v", i, name, m.Funcs[i])
+		}
+	}
+	helper := m.Funcs[2]
+	if len(helper.Locals) != 2 || helper.Locals[1] != (Local{2, 0x7e}) || helper.Size != 5 {
+		t.Errorf("helper: want locals i32, 2 x i64 and 5 bytes of code, got %+v", helper)
+	}
+
+	if _, err := Parse([]byte("\x7fELF")); !errors.Is(err, ErrFormat) {
+		t.Errorf("want ErrFormat, got %v", err)
+	}
+	truncated := testModule()
+	if _, err := Parse(truncated[:len(truncated)-20]); err == nil {
+		t.Errorf("want an error for a truncated module")
+	}
+}
+
+func TestDisasmAll(t *testing.T) {
+	f, err := NewFile(testModule())
+	if err != nil {
+		t.Fatalf("NewFile failed: %v", err)
+	}
+	defer f.Close()
+
+	funcs, err := f.DisasmAll()
+	if err != nil {
+		t.Fatalf("DisasmAll failed: %v", err)
+	}
+	if len(funcs) != 2 || funcs[0].Name != "add" || funcs[1].Name != "helper" {
+		t.Fatalf("want add and helper, got %+v", funcs)
+	}
+
+	add := funcs[0]
+	if len(add.Instructions) != 4 || add.Instructions[2].Id != gapstone.WASM_INS_I32_ADD {
+		t.Fatalf("add: want local.get, local.get, i32.add, end, got %v", add.Instructions)
+	}
+	if add.Instructions[0].Address != uint(add.Offset) {
+		t.Errorf("add: want code at module offset 0x%x, got 0x%x", add.Offset, add.Instructions[0].Address)
+	}
+
+	helper := funcs[1]
+	if len(helper.Instructions) != 3 {
+		t.Fatalf("helper: want 3 instructions, got %v", helper.Instructions)
+	}
+	if callee, ok := f.Callee(helper.Instructions[1]); !ok || callee.Name != "env.log" {
+		t.Errorf("helper: want a call to env.log, got %+v", callee)
+	}
+	if name, off, ok := f.Lookup(helper.Offset + 2); !ok || name != "helper" || off != 2 {
+		t.Errorf("Lookup: want helper+0x2, got %s+0x%x", name, off)
+	}
+
+	if _, err := f.DisasmFunc("env.log"); err == nil {
+		t.Errorf("want an error disassembling an import")
+	}
+	if _, err := f.DisasmFunc("missing"); !errors.Is(err, ErrNoFunc) {
+		t.Errorf("want ErrNoFunc, got %v", err)
+	}
+}